@@ -1,28 +1,127 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"text/template"
+	"time"
 
 	"github.com/tangthinker/watchman/internal/backup"
 	"github.com/tangthinker/watchman/internal/client"
 	"github.com/tangthinker/watchman/internal/daemon"
+	"github.com/tangthinker/watchman/internal/ipc"
 )
 
+// stringList 可重复指定的字符串参数
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 var (
-	configFile = flag.String("config", filepath.Join(os.Getenv("HOME"), ".watchman", "config.json"), "配置文件路径")
-	interval   = flag.Int("n", 0, "备份间隔（分钟）")
+	configFile  = flag.String("config", filepath.Join(os.Getenv("HOME"), ".watchman", "config.json"), "配置文件路径")
+	interval    = flag.Int("n", 0, "备份间隔（分钟）")
+	boostFor    = flag.Duration("for", 0, "临时加速或暂停备份的持续时间（用于 boost 和 pause-run 命令）")
+	revertAfter = flag.Duration("revert-after", 0, "临时目标的持续时间，到期后自动改回原目标（用于 set-target 命令）")
+	since       = flag.Duration("since", 0, "只显示最近一段时间内的备份记录，如 24h（用于 history 命令）")
+	failedOnly  = flag.Bool("failed-only", false, "只显示失败的备份记录（用于 history 命令）")
+	globalLimit = flag.String("global-limit", "", "守护进程所有任务合计写入目标的速度上限（每秒），如 10MB，与任务的 -limit 同时生效")
+	auditLog    = flag.String("audit-log", "", "守护进程以 JSON 行追加记录任务事件的审计日志（默认为配置文件所在目录下的 audit.log）")
+	auditLast   = flag.Int("last", 20, "显示的审计记录条数，为 0 时显示全部（用于 audit 命令）")
+	connTimeout = flag.Duration("connect-timeout", client.DefaultConnectTimeout, "客户端命令在守护进程的 socket 尚未就绪时重试连接的最长时间，为 0 时只尝试一次")
+	socketRetry = flag.Duration("socket-retry", 0, "守护进程无法创建控制 socket 时不退出，继续按计划备份并以该间隔重试，如 1m（默认直接退出）")
+	verifyStart = flag.Bool("verify-on-start", false, "守护进程启动后快速比较每个任务的源目录和目标的文件数和总大小，不一致或目标不存在时将任务标记为 Drifted")
+	concurrency = flag.Int("max-concurrent", 0, "守护进程同时进行的备份数上限，超出的备份按任务的优先级排队（默认不限制）")
+	healthAddr  = flag.String("health-addr", "", "守护进程在该地址提供 HTTP 健康检查 /healthz 和 /readyz，如 :8080（默认不开启）")
+	logDir      = flag.String("log-dir", "", "守护进程将每个任务的日志另外写入该目录下的 <任务名>.log，如 ~/.watchman/logs（默认不写入）")
+	logMaxSize  = flag.String("log-max-size", "10MB", "每个任务日志文件的大小上限，超过后轮转（用于 -log-dir）")
+	logKeep     = flag.Int("log-keep", 5, "每个任务保留的已轮转日志文件数（用于 -log-dir）")
+	jitter      = flag.Duration("jitter", 0, "守护进程启动任务定时器时随机推迟的最长时间，如 5m，用于错开相同间隔的任务")
+	progressOut = flag.String("progress", "", "前台运行的守护进程将备份进度输出到标准输出的格式，目前只支持 json：每次进度更新输出一行 JSON 对象（默认不输出）")
+	rescanNow   = flag.Bool("now", false, "立即执行备份（用于 rescan 和 full 命令）")
+	assumeYes   = flag.Bool("yes", false, "第一次备份会删除目标中的文件时不询问直接添加（用于 add 命令）")
+	replace     = flag.Bool("replace", false, "任务已存在时更新该任务而不是报错（用于 add 命令）")
+	force       = flag.Bool("force", false, "其他任务已将同一源目录备份到同一目标时仍然添加（用于 add 命令）")
+	logLevel    = flag.String("level", "", "只显示该级别及以上的日志：info、warn 或 error（用于 tail 命令）")
+	listFormat  = flag.String("format", "", "以 Go 模板输出每个任务，字段名与任务的 json 字段相同，如 '{{.name}} {{.status}}'（用于 list 命令）")
+	human       = flag.Bool("human", false, "以 KB、MB、GB 等单位显示大小（用于 usage 命令）")
+
+	// 任务选项（用于 add 命令）
+	mtimePrecision = flag.Duration("mtime-precision", 0, "比较修改时间的精度，如 2s（默认根据目标文件系统自动检测）")
+	unreadable     = flag.String("unreadable", "", "无法读取的源文件的处理策略：skip、warn（默认）或 fail")
+	dedup          = flag.Bool("dedup", false, "备份后将目标目录中内容相同的文件替换为硬链接")
+	noDelete       = flag.Bool("no-delete", false, "从不删除目标目录中源目录已不存在的文件")
+	deleteRate     = flag.Int("delete-rate", 0, "每秒最多删除的目标条目数，避免大量删除拖垮较慢的目标（默认不限速）")
+	deleteBatch    = flag.Int("delete-batch", 0, "每批删除的目标条目数，每批之间检查暂停和删除限速（默认 100）")
+	minAge         = flag.Duration("min-age", 0, "跳过修改时间距今不足该时长的文件，如 60s，留到之后的备份")
+	quiesce        = flag.Duration("quiesce", 0, "源目录在该时长内有修改时跳过本次备份，如 5m，等它静止后再复制")
+	maxDepth       = flag.Int("max-depth", 0, "只备份源目录下该层数以内的文件和目录（直接子项为第 1 层）")
+	scrubEvery     = flag.Duration("scrub", 0, "定期重新校验目标中文件哈希的间隔，如 168h，发现损坏时从源目录重新复制")
+	retryEvery     = flag.Duration("retry-interval", 0, "备份失败后改用的较短间隔，如 10m，重试 -retry-max 次仍失败后恢复正常间隔（默认按正常间隔重试）")
+	retryMax       = flag.Int("retry-max", 0, "按 -retry-interval 重试的最多次数（默认 3）")
+	allowEmpty     = flag.Bool("allow-empty-source", false, "源目录为空时仍然备份（默认视为未挂载而跳过）")
+	noDeleteFirst  = flag.Bool("no-delete-first-run", false, "第一次成功备份之前不删除目标目录中的文件")
+	reflink        = flag.Bool("reflink", false, "在支持的文件系统上通过写时复制克隆文件")
+	caseFold       = flag.Bool("case-insensitive-target", false, "目标文件系统不区分大小写，只差大小写的路径视为同一个文件")
+	direction      = flag.String("direction", "", "同步方向：push（默认，将源目录备份到目标目录）或 pull（将目标目录拉取到源目录）")
+	rehashTarget   = flag.Bool("rehash-target", false, "每次备份都重新计算目标文件的哈希，不使用缓存")
+	compress       = flag.Bool("compress", false, "将每个文件单独以 gzip 压缩后写入目标（文件名追加 .gz）")
+	compressLevel  = flag.Int("compress-level", 0, "gzip 压缩级别 1-9（默认 6）")
+	scanWorkers    = flag.Int("scan-workers", 0, "扫描使用的工作协程数，启用 -adaptive-scan 时为上限（默认 8）")
+	maxParallel    = flag.Int("max-parallel", 0, "同时计算哈希和复制的协程数上限，限制备份占用的 CPU 核数")
+	adaptiveScan   = flag.Bool("adaptive-scan", false, "根据存储的吞吐量自动调整扫描的工作协程数")
+	incremental    = flag.Bool("incremental-scan", false, "修改时间未变的源目录复用上次扫描的结果，不读取其中的文件")
+	priority       = flag.Int("priority", 0, "守护进程限制了同时进行的备份数（-max-concurrent）时的排队优先级，数值大的先开始")
+	streaming      = flag.Bool("streaming", false, "逐个目录比较源目录和目标并立即同步，不在内存中保存完整的文件列表，用于文件数量极多的源目录")
+	skipTargetScan = flag.Bool("skip-target-scan", false, "不扫描目标目录，按上次备份后缓存的目标文件列表只复制变化的文件")
+	fileMode       = flag.String("file-mode", "", "写入目标的文件的权限，如 0640（默认由 umask 决定）")
+	dirMode        = flag.String("dir-mode", "", "在目标中创建的目录的权限，如 0750（默认由 umask 决定）")
+	rateLimit      = flag.String("limit", "", "写入目标的速度上限（每秒），如 10MB")
+	minFree        = flag.String("min-free", "", "目标的最小可用空间，如 5GB，低于该值时跳过备份")
+	maxFiles       = flag.Int("max-files", 0, "目标中文件数的上限，超出时备份失败且不修改目标")
+	maxSize        = flag.String("max-size", "", "目标中文件总大小的上限，如 50GB，超出时备份失败且不修改目标")
+	excludeTypes   = flag.String("exclude-type", "", "按文件类型分组排除，多个分组以逗号分隔，如 video,cache（可用分组："+strings.Join(backup.ExcludeTypeNames(), ", ")+"）")
+	keepInTarget   stringList
+	exclude        stringList
+	mirrors        stringList
+	pathMap        stringList
+	dependsOn      stringList
 )
 
+func init() {
+	flag.Var(&keepInTarget, "keep", "目标目录中永不删除的文件的通配符，可重复指定")
+	flag.Var(&exclude, "exclude", "源目录中不参与备份的文件或目录的通配符，可重复指定")
+	flag.Var(&mirrors, "mirror", "同时备份到的其他目标目录，可重复指定")
+	flag.Var(&pathMap, "map", "将源目录中的路径前缀改写为目标中的路径，格式为 源前缀=目标前缀，如 src=archive/source；可重复指定，按顺序使用第一条匹配的规则")
+	flag.Var(&dependsOn, "depends-on", "必须先成功备份的任务，正在备份时等待其完成，可重复指定")
+}
+
+// 守护进程的 PID 文件
+const pidFile = "/tmp/watchman.pid"
+
 // 检查是否已有守护进程在运行
 func checkRunningDaemon() bool {
-	output, err := os.ReadFile("/tmp/watchman.pid")
+	output, err := os.ReadFile(pidFile)
 	if err != nil {
 		return false
 	}
@@ -36,20 +135,20 @@ func checkRunningDaemon() bool {
 	pidNum := 0
 	fmt.Sscanf(pid, "%d", &pidNum)
 	if pidNum <= 0 {
-		os.Remove("/tmp/watchman.pid")
+		os.Remove(pidFile)
 		return false
 	}
 
 	process, err := os.FindProcess(pidNum)
 	if err != nil {
-		os.Remove("/tmp/watchman.pid")
+		os.Remove(pidFile)
 		return false
 	}
 
 	// 在Unix系统中，发送信号0用于检查进程是否存在
 	err = process.Signal(syscall.Signal(0))
 	if err != nil {
-		os.Remove("/tmp/watchman.pid")
+		os.Remove(pidFile)
 		return false
 	}
 
@@ -59,18 +158,37 @@ func checkRunningDaemon() bool {
 // 创建进程锁
 func createPIDFile() error {
 	pid := fmt.Sprintf("%d", os.Getpid())
-	return os.WriteFile("/tmp/watchman.pid", []byte(pid), 0644)
+	return os.WriteFile(pidFile, []byte(pid), 0644)
 }
 
 // 清理进程锁
 func cleanupPIDFile() {
-	os.Remove("/tmp/watchman.pid")
+	os.Remove(pidFile)
 }
 
 func main() {
 	// 解析命令行参数
 	flag.Parse()
 
+	// 本地命令不需要连接守护进程
+	switch flag.Arg(0) {
+	case "validate":
+		runValidate()
+		return
+	case "reset":
+		runReset()
+		return
+	case "probe":
+		runProbe()
+		return
+	case "audit":
+		runAudit()
+		return
+	case "migrate-config":
+		runMigrateConfig(flag.Args()[1:])
+		return
+	}
+
 	// 如果有命令行参数，作为客户端运行
 	if len(flag.Args()) > 0 {
 		handleClientCommand()
@@ -81,9 +199,171 @@ func main() {
 	runAsDaemon()
 }
 
+// 校验配置文件，不启动守护进程；有任何问题时以非零状态退出
+func runValidate() {
+	reports, migration, err := backup.ValidateConfig(*configFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if migration != nil {
+		fmt.Printf("Schema version %d, will be upgraded to %d when the daemon loads it\n", migration.From, migration.To)
+		for _, change := range migration.Changes {
+			fmt.Printf("  - %s\n", change)
+		}
+	} else {
+		fmt.Printf("Schema version %d\n", backup.SchemaVersion)
+	}
+
+	failed := 0
+	for i, report := range reports {
+		name := report.Name
+		if name == "" {
+			name = fmt.Sprintf("(task #%d)", i+1)
+		}
+
+		if len(report.Problems) == 0 {
+			fmt.Printf("OK     %s\n", name)
+			continue
+		}
+
+		failed++
+		fmt.Printf("ERROR  %s\n", name)
+		for _, problem := range report.Problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+	}
+
+	fmt.Printf("%d tasks checked, %d with problems\n", len(reports), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// 审计日志的路径，未指定时位于配置文件所在目录
+func auditLogPath() string {
+	if *auditLog != "" {
+		return *auditLog
+	}
+	return filepath.Join(filepath.Dir(*configFile), "audit.log")
+}
+
+// 直接读取审计日志，输出最近的记录，不需要守护进程
+func runAudit() {
+	if len(flag.Args()) > 2 {
+		fmt.Println("Usage: watchman [-last <n>] audit [task_name]")
+		os.Exit(1)
+	}
+
+	events, err := backup.ReadAudit(auditLogPath(), flag.Arg(1), *auditLast)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(events) == 0 {
+		fmt.Println("No audit records found")
+		return
+	}
+
+	format := "%-20s\t%-20s\t%-10s\t%-12s\t%s\n"
+	fmt.Printf(format, "TIME", "TASK", "EVENT", "STATUS", "DETAILS")
+	for _, event := range events {
+		var details []string
+		if event.Type == backup.EventFinished || event.Type == backup.EventFailed {
+			details = append(details, fmt.Sprintf("copied=%d deleted=%d bytes=%s",
+				event.FilesCopied, event.FilesDeleted, formatBytes(float64(event.BytesTransferred))))
+		}
+		if event.Error != "" {
+			details = append(details, event.Error)
+		}
+		fmt.Printf(format, event.Time.Local().Format("2006-01-02 15:04:05"), event.Task, event.Type,
+			event.Status, strings.Join(details, " "))
+	}
+}
+
+// runProbe 测试目标目录是否可写，以及它的延迟、吞吐量和修改时间精度
+func runProbe() {
+	if len(flag.Args()) != 2 {
+		fmt.Println("Usage: watchman probe <target_path>")
+		os.Exit(1)
+	}
+
+	report, err := backup.ProbeTarget(flag.Arg(1))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fsType := report.FSType
+	if fsType == "" {
+		fsType = "unknown filesystem"
+	}
+	fmt.Printf("Target %s (%s) is writable\n", report.Path, fsType)
+
+	format := "%-10s\t%-24s\t%-24s\t%-10s\n"
+	fmt.Printf(format, "SIZE", "WRITE", "READ", "DELETE")
+	for _, r := range report.Results {
+		fmt.Printf(format,
+			formatBytes(float64(r.Size)),
+			fmt.Sprintf("%s (%s/s)", r.Write.Round(time.Microsecond), formatBytes(r.WriteRate)),
+			fmt.Sprintf("%s (%s/s)", r.Read.Round(time.Microsecond), formatBytes(r.ReadRate)),
+			r.Delete.Round(time.Microsecond).String(),
+		)
+	}
+
+	if report.MtimePreserved {
+		fmt.Printf("Modification times: preserved, %s granularity\n", report.MtimeGranularity)
+	} else {
+		fmt.Println("Modification times: not preserved")
+	}
+	fmt.Printf("Backups will compare modification times with %s precision\n", report.MtimePrecision)
+	for _, warning := range report.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+}
+
+// 清理异常退出的守护进程遗留的 PID 文件和 socket；检测到守护进程仍在运行时拒绝清理
+func runReset() {
+	if output, err := os.ReadFile(pidFile); err == nil {
+		pidNum := 0
+		fmt.Sscanf(strings.TrimSpace(string(output)), "%d", &pidNum)
+		if pidNum > 0 {
+			// 信号0只检查进程是否存在；EPERM 表示进程存在但属于其他用户
+			process, err := os.FindProcess(pidNum)
+			if err == nil {
+				err = process.Signal(syscall.Signal(0))
+			}
+			if err == nil || errors.Is(err, syscall.EPERM) {
+				fmt.Printf("Error: daemon is still running (pid %d), refusing to reset\n", pidNum)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// 没有 PID 文件时仍可能有守护进程在监听 socket
+	if conn, err := net.Dial("unix", ipc.SockAddr); err == nil {
+		conn.Close()
+		fmt.Println("Error: a daemon is accepting connections on the socket, refusing to reset")
+		os.Exit(1)
+	}
+
+	for _, path := range []string{pidFile, ipc.SockAddr} {
+		err := os.Remove(path)
+		switch {
+		case err == nil:
+			fmt.Printf("Removed stale %s\n", path)
+		case !os.IsNotExist(err):
+			fmt.Printf("Error: failed to remove %s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+	fmt.Println("Reset complete, the daemon can be started again")
+}
+
 func handleClientCommand() {
 	// 创建客户端连接
-	c, err := client.NewClient()
+	c, err := client.Dial(*connTimeout)
 	if err != nil {
 		log.Fatalf("Failed to connect to daemon: %v", err)
 	}
@@ -95,163 +375,1384 @@ func handleClientCommand() {
 	// 处理命令
 	switch flag.Arg(0) {
 	case "add":
-		if len(flag.Args()) != 4 {
+		var name, sourcePath, targetPath, schedule string
+		var options map[string]any
+		switch {
+		case len(flag.Args()) == 2 && flag.Arg(1) == "-":
+			// 从标准输入读取完整的任务 JSON，可以包含所有选项
+			tasks, batch, readErr := readTasksJSON(os.Stdin)
+			if readErr != nil {
+				fmt.Printf("Error: %v\n", readErr)
+				os.Exit(1)
+			}
+			if batch {
+				addTasks(c, tasks)
+				return
+			}
+			name, sourcePath, targetPath, schedule, options = splitTaskJSON(tasks[0])
+		case len(flag.Args()) == 4:
+			if *interval <= 0 {
+				fmt.Println("Error: interval (-n) must be greater than 0")
+				os.Exit(1)
+			}
+			name, sourcePath, targetPath = flag.Arg(1), flag.Arg(2), flag.Arg(3)
+			schedule = fmt.Sprintf("%d", *interval)
+			options = taskOptions()
+		default:
 			fmt.Println("Usage: watchman -n <minutes> add <name> <source_path> <target_path>")
+			fmt.Println("       watchman add - < task.json")
+			fmt.Println("       watchman add - < tasks.json (a JSON array of tasks, all added or none)")
 			fmt.Println("Note: The -n flag must come before the 'add' command")
 			os.Exit(1)
 		}
 
-		if *interval <= 0 {
-			fmt.Println("Error: interval (-n) must be greater than 0")
-			os.Exit(1)
-		}
-
-		log.Printf("Adding task: name=%s, source=%s, target=%s, interval=%d",
-			flag.Arg(1), flag.Arg(2), flag.Arg(3), *interval)
+		log.Printf("Adding task: name=%s, source=%s, target=%s, interval=%s",
+			name, sourcePath, targetPath, schedule)
 
-		err = c.AddTask(
-			flag.Arg(1),                  // name
-			flag.Arg(2),                  // source_path
-			flag.Arg(3),                  // target_path
-			fmt.Sprintf("%d", *interval), // schedule
-		)
+		if *replace {
+			options["replace"] = true
+		}
+		if *force {
+			options["force"] = true
+		}
+		if !*assumeYes && !confirmFirstRun(name, sourcePath, targetPath, schedule, options) {
+			fmt.Println("Aborted")
+			return
+		}
+		task, err := c.AddTask(name, sourcePath, targetPath, schedule, options)
 		if err != nil {
 			log.Fatalf("Failed to add task: %v", err)
 		}
-		log.Printf("Task added successfully")
+		printAdded(name, task)
+		warnUnsaved(task)
+
+	case "migrate":
+		err = runMigrate(c, flag.Args()[1:])
 
 	case "list":
+		// 先解析模板，模板有误时不请求任务列表
+		var tmpl *template.Template
+		if *listFormat != "" {
+			var parseErr error
+			if tmpl, parseErr = template.New("list").Parse(*listFormat); parseErr != nil {
+				fmt.Printf("Error: invalid format: %v\n", parseErr)
+				os.Exit(1)
+			}
+		}
 		tasks, err := c.ListTasks()
-		if err == nil {
+		if err == nil && tmpl != nil {
+			err = printTasksTemplate(tasks, tmpl)
+		} else if err == nil {
 			printTasks(tasks)
+		}
+		if err == nil {
 			return
 		}
+		log.Fatalf("Command failed: %v", err)
 
-	case "delete":
+	case "get":
 		if len(flag.Args()) != 2 {
-			fmt.Println("Usage: watchman delete <task_name>")
+			fmt.Println("Usage: watchman get <task_name>")
 			os.Exit(1)
 		}
-		err = c.DeleteTask(flag.Arg(1))
+		task, err := c.GetTask(flag.Arg(1))
+		if err == nil {
+			printJSON(task)
+			return
+		}
+		log.Fatalf("Command failed: %v", err)
 
-	case "stop":
+	case "history":
 		if len(flag.Args()) != 2 {
-			fmt.Println("Usage: watchman stop <task_name>")
+			fmt.Println("Usage: watchman [-since <duration>] [-failed-only] history <task_name>")
 			os.Exit(1)
 		}
-		err = c.StopTask(flag.Arg(1))
+		result, err := c.History(flag.Arg(1), *since, *failedOnly)
+		if err == nil {
+			printHistory(result)
+			return
+		}
+		log.Fatalf("Command failed: %v", err)
 
-	default:
-		fmt.Println("Available commands:")
-		fmt.Println("  watchman -n <minutes> add <name> <source_path> <target_path> - Add a new backup task")
-		fmt.Println("  watchman list - List all backup tasks")
-		fmt.Println("  watchman stop <task_name> - Stop a backup task")
-		fmt.Println("  watchman delete <task_name> - Delete a backup task")
-		fmt.Println("\nNote: When using flags (like -n), they must come before the command")
-		os.Exit(1)
-	}
+	case "inspect":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman inspect <task_name>")
+			os.Exit(1)
+		}
+		status, err := c.Inspect(flag.Arg(1))
+		if err == nil {
+			printInspect(status)
+			return
+		}
+		log.Fatalf("Command failed: %v", err)
 
-	if err != nil {
+	case "plan":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman plan <task_name>")
+			os.Exit(1)
+		}
+		result, err := c.Plan(flag.Arg(1))
+		if err == nil {
+			printPlan(result)
+			return
+		}
 		log.Fatalf("Command failed: %v", err)
-	}
-}
 
-func printTasks(tasks interface{}) {
-	// 首先尝试将 interface{} 转换为 []interface{}
-	taskList, ok := tasks.([]interface{})
-	if !ok {
-		log.Printf("Failed to convert tasks: %T", tasks)
-		fmt.Println("No backup tasks found")
+	case "upcoming":
+		if len(flag.Args()) > 2 {
+			fmt.Println("Usage: watchman upcoming [duration]")
+			os.Exit(1)
+		}
+		within := time.Hour
+		if flag.NArg() == 2 {
+			d, parseErr := time.ParseDuration(flag.Arg(1))
+			if parseErr != nil || d <= 0 {
+				fmt.Println("Error: duration must be a positive duration such as 60m")
+				os.Exit(1)
+			}
+			within = d
+		}
+		result, err := c.Upcoming(within)
+		if err == nil {
+			printUpcoming(result, within)
+			return
+		}
+		log.Fatalf("Command failed: %v", err)
+
+	case "usage":
+		if len(flag.Args()) != 1 {
+			fmt.Println("Usage: watchman [-human] usage")
+			os.Exit(1)
+		}
+		result, err := c.Usage()
+		if err == nil {
+			printUsage(result, *human)
+			return
+		}
+		log.Fatalf("Command failed: %v", err)
+
+	case "events":
+		if len(flag.Args()) != 1 {
+			fmt.Println("Usage: watchman events")
+			os.Exit(1)
+		}
+		events, err := c.Subscribe()
+		if err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		// 每行输出一个 JSON 格式的事件，便于其他程序解析
+		for event := range events {
+			data, _ := json.Marshal(event)
+			fmt.Println(string(data))
+		}
 		return
-	}
 
-	if len(taskList) == 0 {
-		fmt.Println("No backup tasks found")
+	case "tail":
+		if len(flag.Args()) != 1 {
+			fmt.Println("Usage: watchman [-level info|warn|error] tail")
+			os.Exit(1)
+		}
+		lines, err := c.TailLog(*logLevel)
+		if err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		// 日志行已包含守护进程记录的时间
+		for line := range lines {
+			fmt.Println(getStringValue(line, "line"))
+		}
 		return
-	}
 
-	// 定义表格格式
-	format := "%-20s\t%-30s\t%-30s\t%-10s\t%-10s\t%-10s\t%-25s\n"
+	case "watch":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman watch <task_name>")
+			os.Exit(1)
+		}
+		err = c.Watch(flag.Arg(1), printWatchEvent)
 
-	// 打印表头
-	fmt.Printf(format, "NAME", "SOURCE", "TARGET", "INTERVAL", "STATUS", "PROGRESS", "LAST BACKUP")
+	case "delete":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman delete <task_name>")
+			os.Exit(1)
+		}
+		var task map[string]interface{}
+		if task, err = c.DeleteTask(flag.Arg(1)); err == nil {
+			fmt.Printf("Task %s deleted (%s -> %s), files in the target were kept\n", flag.Arg(1),
+				getStringValue(task, "source_path"), getStringValue(task, "target_path"))
+			warnUnsaved(task)
+		}
 
-	// 打印任务信息
-	for _, t := range taskList {
-		// 将每个任务转换为 map[string]interface{}
-		task, ok := t.(map[string]interface{})
-		if !ok {
-			log.Printf("Failed to convert task to map: %T", t)
-			continue
+	case "full":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman [-now] full <task_name>")
+			os.Exit(1)
 		}
+		err = c.FullBackup(flag.Arg(1), *rescanNow)
 
-		// 安全地获取字段值
-		name := getStringValue(task, "name")
-		sourcePath := getStringValue(task, "source_path")
-		targetPath := getStringValue(task, "target_path")
-		schedule := getStringValue(task, "schedule")
-		status := getStringValue(task, "status")
-		progress := getFloatValue(task, "progress")
-		lastBackup := getStringValue(task, "last_backup")
-		if lastBackup == "" {
-			lastBackup = "-"
+	case "rescan":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman [-now] rescan <task_name>")
+			os.Exit(1)
 		}
+		err = c.RescanTask(flag.Arg(1), *rescanNow)
 
-		// 如果路径太长，截断并添加...
-		if len(sourcePath) > 27 {
-			sourcePath = sourcePath[:24] + "..."
+	case "scrub":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman scrub <task_name>")
+			os.Exit(1)
 		}
-		if len(targetPath) > 27 {
-			targetPath = targetPath[:24] + "..."
+		err = c.ScrubTask(flag.Arg(1))
+
+	case "debug":
+		if len(flag.Args()) != 3 || (flag.Arg(2) != "on" && flag.Arg(2) != "off") {
+			fmt.Println("Usage: watchman debug <task_name> on|off")
+			os.Exit(1)
 		}
+		err = c.SetDebug(flag.Arg(1), flag.Arg(2) == "on")
 
-		fmt.Printf(format,
-			name,
-			sourcePath,
-			targetPath,
-			schedule+"m",
-			status,
-			fmt.Sprintf("%.1f%%", progress),
-			lastBackup,
-		)
+	case "stop":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman stop <task_name>")
+			os.Exit(1)
+		}
+		var task map[string]interface{}
+		if task, err = c.StopTask(flag.Arg(1)); err == nil {
+			fmt.Printf("Task %s stopped, no further backups are scheduled\n", flag.Arg(1))
+			if running, _ := task["running"].(bool); running {
+				fmt.Println("The backup in progress was not cancelled and will finish")
+			}
+			warnUnsaved(task)
+		}
 
-		// 如果有错误，在下一行显示
-		if errStr := getStringValue(task, "error"); errStr != "" {
-			fmt.Printf("  Error: %s\n", errStr)
+	case "snooze":
+		if len(flag.Args()) != 3 {
+			fmt.Println("Usage: watchman snooze <task_name> <duration>")
+			os.Exit(1)
 		}
-	}
-}
 
-// 辅助函数：安全地获取字符串值
-func getStringValue(m map[string]interface{}, key string) string {
-	if val, ok := m[key].(string); ok {
-		return val
-	}
-	return ""
-}
+		duration, parseErr := time.ParseDuration(flag.Arg(2))
+		if parseErr != nil || duration <= 0 {
+			fmt.Println("Error: duration must be a positive duration such as 2h")
+			os.Exit(1)
+		}
+		err = c.SnoozeTask(flag.Arg(1), duration)
 
-// 辅助函数：安全地获取浮点数值
-func getFloatValue(m map[string]interface{}, key string) float64 {
-	switch v := m[key].(type) {
-	case float64:
-		return v
-	case float32:
-		return float64(v)
-	case int:
-		return float64(v)
-	case int64:
-		return float64(v)
-	default:
-		return 0
-	}
-}
+	case "boost":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman -n <minutes> -for <duration> boost <task_name>")
+			os.Exit(1)
+		}
 
-func runAsDaemon() {
-	// 检查是否已有守护进程在运行
-	if checkRunningDaemon() {
+		if *interval <= 0 || *boostFor <= 0 {
+			fmt.Println("Error: interval (-n) and duration (-for) must be greater than 0")
+			os.Exit(1)
+		}
+		err = c.BoostTask(flag.Arg(1), fmt.Sprintf("%d", *interval), *boostFor)
+
+	case "set-target":
+		if len(flag.Args()) != 3 {
+			fmt.Println("Usage: watchman [-revert-after <duration>] set-target <task_name> <target_path>")
+			os.Exit(1)
+		}
+		if *revertAfter < 0 {
+			fmt.Println("Error: -revert-after must be a positive duration such as 6h")
+			os.Exit(1)
+		}
+		err = c.SetTarget(flag.Arg(1), flag.Arg(2), *revertAfter)
+
+	case "set":
+		if len(flag.Args()) != 3 {
+			fmt.Printf("Usage: watchman set <key> <value> (keys: %s)\n", strings.Join(backup.GlobalKeys(), ", "))
+			os.Exit(1)
+		}
+		key, value := flag.Arg(1), flag.Arg(2)
+		// 速度上限可以带单位，发送给守护进程之前换算为字节
+		if key == backup.GlobalLimit && value != "" {
+			size, parseErr := parseSize(value)
+			if parseErr != nil {
+				fmt.Printf("Error: invalid %s: %v\n", key, parseErr)
+				os.Exit(1)
+			}
+			value = strconv.FormatInt(size, 10)
+		}
+		if err = c.SetGlobal(key, value); err == nil {
+			if value == "" {
+				fmt.Printf("%s reverted to the daemon's startup value\n", key)
+			} else {
+				fmt.Printf("%s set to %s\n", key, flag.Arg(2))
+			}
+		}
+
+	case "get-global":
+		if len(flag.Args()) != 1 {
+			fmt.Println("Usage: watchman get-global")
+			os.Exit(1)
+		}
+		result, err := c.Globals()
+		if err == nil {
+			printGlobals(result)
+			return
+		}
+		log.Fatalf("Command failed: %v", err)
+
+	case "pause-run":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman [-for <duration>] pause-run <task_name>")
+			os.Exit(1)
+		}
+		if *boostFor < 0 {
+			fmt.Println("Error: -for must be a positive duration such as 10m")
+			os.Exit(1)
+		}
+		err = c.PauseRun(flag.Arg(1), *boostFor)
+
+	case "resume-run":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman resume-run <task_name>")
+			os.Exit(1)
+		}
+		err = c.ResumeRun(flag.Arg(1))
+
+	case "revert-target":
+		if len(flag.Args()) != 2 {
+			fmt.Println("Usage: watchman revert-target <task_name>")
+			os.Exit(1)
+		}
+		err = c.RevertTarget(flag.Arg(1))
+
+	default:
+		fmt.Println("Available commands:")
+		fmt.Println("  watchman -n <minutes> [-replace] [-force] [-yes] add <name> <source_path> <target_path> - Add a new backup task")
+		fmt.Println("  watchman [-replace] [-force] [-yes] add - - Add a backup task read as JSON from stdin")
+		fmt.Println("  watchman [-format <template>] list - List all backup tasks")
+		fmt.Println("  watchman migrate -from-rsync \"<rsync command>\" [-name <name>] [-n <minutes>] [-yes] - Import a task from an rsync command line")
+		fmt.Println("  watchman get <task_name> - Show full detail of a backup task")
+		fmt.Println("  watchman [-since <duration>] [-failed-only] history <task_name> - Show backup history of a task")
+		fmt.Println("  watchman plan <task_name> - Show the files the next backup would copy, overwrite and delete")
+		fmt.Println("  watchman upcoming [duration] - Show the backups scheduled in the next duration (default 1h)")
+		fmt.Println("  watchman [-human] usage - Show disk space used by the targets of each task")
+		fmt.Println("  watchman events - Stream events of all tasks as JSON lines")
+		fmt.Println("  watchman [-level info|warn|error] tail - Stream the daemon's log")
+		fmt.Println("  watchman debug <task_name> on|off - Toggle verbose per-file logging for a task")
+		fmt.Println("  watchman stop <task_name> - Stop a backup task")
+		fmt.Println("  watchman delete <task_name> - Delete a backup task")
+		fmt.Println("  watchman watch <task_name> - Watch the progress of a running backup")
+		fmt.Println("  watchman inspect <task_name> - Show the file a running backup is copying and how many remain")
+		fmt.Println("  watchman [-now] rescan <task_name> - Discard a task's hash cache and rehash the target on the next backup")
+		fmt.Println("  watchman [-now] full <task_name> - Copy every file on the next backup regardless of the target")
+		fmt.Println("  watchman scrub <task_name> - Re-verify a task's targets against their recorded hashes now")
+		fmt.Println("  watchman [-config <path>] validate - Validate the config file without starting the daemon")
+		fmt.Println("  watchman [-last <n>] audit [task_name] - Show the most recent task events from the audit log")
+		fmt.Println("  watchman probe <target_path> - Test a target's writability, latency and mtime granularity")
+		fmt.Println("  watchman reset - Remove a stale PID file and socket left by a crashed daemon")
+		fmt.Println("  watchman -n <minutes> -for <duration> boost <task_name> - Temporarily change a task's interval")
+		fmt.Println("  watchman [-revert-after <duration>] set-target <task_name> <target_path> - Temporarily point a task at another target")
+		fmt.Println("  watchman revert-target <task_name> - Restore a task's original target")
+		fmt.Println("  watchman set <key> <value> - Change a global setting (" + strings.Join(backup.GlobalKeys(), ", ") + ") of the running daemon, \"\" reverts it")
+		fmt.Println("  watchman get-global - Show the current global settings")
+		fmt.Println("  watchman [-for <duration>] pause-run <task_name> - Pause the copying of a running backup without losing progress")
+		fmt.Println("  watchman resume-run <task_name> - Resume a paused backup where it stopped")
+		fmt.Println("  watchman snooze <task_name> <duration> - Pause a task and resume it automatically after the duration")
+		fmt.Println("\nNote: When using flags (like -n), they must come before the command")
+		os.Exit(1)
+	}
+
+	if err != nil {
+		log.Fatalf("Command failed: %v", err)
+	}
+}
+
+// 根据命令行参数收集任务选项，键为任务的 json 字段名
+func taskOptions() map[string]any {
+	options := make(map[string]any)
+	if *minFree != "" {
+		size, err := parseSize(*minFree)
+		if err != nil {
+			fmt.Printf("Error: invalid -min-free: %v\n", err)
+			os.Exit(1)
+		}
+		options["min_free_space"] = size
+	}
+	if *maxFiles != 0 {
+		options["max_target_files"] = *maxFiles
+	}
+	if *maxSize != "" {
+		size, err := parseSize(*maxSize)
+		if err != nil {
+			fmt.Printf("Error: invalid -max-size: %v\n", err)
+			os.Exit(1)
+		}
+		options["max_target_bytes"] = size
+	}
+	if *compress {
+		options["compress"] = true
+	}
+	if *compressLevel != 0 {
+		options["compress_level"] = *compressLevel
+	}
+	if *scanWorkers != 0 {
+		options["scan_workers"] = *scanWorkers
+	}
+	if *adaptiveScan {
+		options["adaptive_scan"] = true
+	}
+	if *incremental {
+		options["incremental_scan"] = true
+	}
+	if *skipTargetScan {
+		options["skip_target_scan"] = true
+	}
+	if *streaming {
+		options["streaming"] = true
+	}
+	if *maxParallel != 0 {
+		options["max_parallelism"] = *maxParallel
+	}
+	if *fileMode != "" {
+		options["file_mode"] = *fileMode
+	}
+	if *dirMode != "" {
+		options["dir_mode"] = *dirMode
+	}
+	if *rateLimit != "" {
+		size, err := parseSize(*rateLimit)
+		if err != nil {
+			fmt.Printf("Error: invalid -limit: %v\n", err)
+			os.Exit(1)
+		}
+		options["rate_limit"] = size
+	}
+	if *mtimePrecision > 0 {
+		options["mtime_precision"] = mtimePrecision.String()
+	}
+	if *unreadable != "" {
+		options["unreadable_policy"] = *unreadable
+	}
+	if *dedup {
+		options["dedup"] = true
+	}
+	if *noDelete {
+		options["no_delete"] = true
+	}
+	if *noDeleteFirst {
+		options["no_delete_first_run"] = true
+	}
+	if *allowEmpty {
+		options["allow_empty_source"] = true
+	}
+	if *deleteRate != 0 {
+		options["delete_rate"] = *deleteRate
+	}
+	if *deleteBatch != 0 {
+		options["delete_batch"] = *deleteBatch
+	}
+	if *minAge > 0 {
+		options["min_file_age"] = minAge.String()
+	}
+	if *quiesce > 0 {
+		options["quiesce_window"] = quiesce.String()
+	}
+	if *maxDepth != 0 {
+		options["max_depth"] = *maxDepth
+	}
+	if *scrubEvery > 0 {
+		options["scrub_interval"] = scrubEvery.String()
+	}
+	if *retryEvery > 0 {
+		options["retry_interval"] = retryEvery.String()
+	}
+	if *retryMax != 0 {
+		options["retry_max"] = *retryMax
+	}
+	if *reflink {
+		options["reflink"] = true
+	}
+	if *caseFold {
+		options["case_insensitive_target"] = true
+	}
+	if *rehashTarget {
+		options["rehash_target"] = true
+	}
+	if *direction != "" {
+		options["direction"] = *direction
+	}
+	if *priority != 0 {
+		options["priority"] = *priority
+	}
+	if len(keepInTarget) > 0 {
+		options["keep_in_target"] = []string(keepInTarget)
+	}
+	if len(exclude) > 0 {
+		options["exclude"] = []string(exclude)
+	}
+	if *excludeTypes != "" {
+		options["exclude_types"] = strings.Split(*excludeTypes, ",")
+	}
+	if len(mirrors) > 0 {
+		options["mirror_targets"] = []string(mirrors)
+	}
+	if len(dependsOn) > 0 {
+		options["depends_on"] = []string(dependsOn)
+	}
+	if len(pathMap) > 0 {
+		var rules []backup.PathMapping
+		for _, rule := range pathMap {
+			from, to, ok := strings.Cut(rule, "=")
+			if !ok {
+				fmt.Printf("Error: invalid -map %q, expected <source prefix>=<target prefix>\n", rule)
+				os.Exit(1)
+			}
+			rules = append(rules, backup.PathMapping{From: from, To: to})
+		}
+		options["path_map"] = rules
+	}
+	return options
+}
+
+func printTasks(tasks interface{}) {
+	// 首先尝试将 interface{} 转换为 []interface{}
+	taskList, ok := tasks.([]interface{})
+	if !ok {
+		log.Printf("Failed to convert tasks: %T", tasks)
+		fmt.Println("No backup tasks found")
+		return
+	}
+
+	if len(taskList) == 0 {
+		fmt.Println("No backup tasks found")
+		return
+	}
+
+	// 配置文件无法写入时守护进程只在内存中保存任务状态，重启后会丢失
+	if first, ok := taskList[0].(map[string]interface{}); ok {
+		if saveErr := getStringValue(first, "save_error"); saveErr != "" {
+			fmt.Printf("Warning: task state is kept in memory only, the config file cannot be saved: %s\n\n", saveErr)
+		}
+	}
+
+	// 定义表格格式
+	format := "%-20s\t%-30s\t%-30s\t%-10s\t%-12s\t%-10s\t%-25s\n"
+
+	// 打印表头
+	fmt.Printf(format, "NAME", "SOURCE", "TARGET", "INTERVAL", "STATUS", "PROGRESS", "LAST BACKUP")
+
+	// 打印任务信息
+	for _, t := range taskList {
+		// 将每个任务转换为 map[string]interface{}
+		task, ok := t.(map[string]interface{})
+		if !ok {
+			log.Printf("Failed to convert task to map: %T", t)
+			continue
+		}
+
+		// 安全地获取字段值
+		name := getStringValue(task, "name")
+		sourcePath := getStringValue(task, "source_path")
+		targetPath := getStringValue(task, "target_path")
+		schedule := getStringValue(task, "schedule")
+		status := getStringValue(task, "status")
+		progress := getFloatValue(task, "progress")
+		lastBackup := getStringValue(task, "last_backup")
+		if lastBackup == "" {
+			lastBackup = "-"
+		}
+
+		// 如果路径太长，截断并添加...
+		if len(sourcePath) > 27 {
+			sourcePath = sourcePath[:24] + "..."
+		}
+		if len(targetPath) > 27 {
+			targetPath = targetPath[:24] + "..."
+		}
+
+		// 临时加速期间同时显示加速后的间隔和原间隔
+		intervalStr := schedule + "m"
+		boostSchedule := getStringValue(task, "boost_schedule")
+		if boostSchedule != "" {
+			intervalStr = fmt.Sprintf("%sm(%sm)", boostSchedule, schedule)
+		}
+		// 失败后处于重试节奏时显示重试间隔，括号中为正常间隔
+		retryAttempt := int(getFloatValue(task, "retry_attempt"))
+		if retryAttempt > 0 {
+			intervalStr = fmt.Sprintf("%s(%sm)", getStringValue(task, "retry_interval"), schedule)
+		}
+
+		fmt.Printf(format,
+			name,
+			sourcePath,
+			targetPath,
+			intervalStr,
+			status,
+			fmt.Sprintf("%.1f%%", progress),
+			lastBackup,
+		)
+
+		if forceFull, _ := task["force_full"].(bool); forceFull {
+			fmt.Println("  Next backup: full, all files will be copied")
+		}
+
+		if boostSchedule != "" {
+			fmt.Printf("  Boosted until: %s\n", getStringValue(task, "boost_until"))
+		}
+
+		if retryAttempt > 0 {
+			fmt.Printf("  Retrying: retry %d, every %s until a backup succeeds or the retries are used up\n",
+				retryAttempt, getStringValue(task, "retry_interval"))
+		}
+
+		if original := getStringValue(task, "original_target"); original != "" {
+			if until, err := time.Parse(time.RFC3339, getStringValue(task, "redirect_until")); err == nil {
+				fmt.Printf("  Redirected: original target %s, reverts in %s (at %s)\n", original,
+					time.Until(until).Round(time.Second), until.Local().Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("  Redirected: original target %s\n", original)
+			}
+		}
+
+		if snoozeUntil, err := time.Parse(time.RFC3339, getStringValue(task, "snooze_until")); err == nil {
+			fmt.Printf("  Snoozed: resumes in %s (at %s)\n",
+				time.Until(snoozeUntil).Round(time.Second), snoozeUntil.Local().Format("2006-01-02 15:04:05"))
+		}
+
+		if paused, _ := task["run_paused"].(bool); paused {
+			fmt.Printf("  Run paused: resume with 'watchman resume-run %s'\n", name)
+		}
+
+		if position := getFloatValue(task, "queue_position"); position > 0 {
+			fmt.Printf("  Queued: waiting for a backup slot, position %d of %d (priority %d)\n",
+				int(position), int(getFloatValue(task, "queue_length")), int(getFloatValue(task, "priority")))
+		} else if p := getFloatValue(task, "priority"); p != 0 {
+			fmt.Printf("  Priority: %d\n", int(p))
+		}
+
+		if deps, _ := task["depends_on"].([]interface{}); len(deps) > 0 {
+			names := make([]string, len(deps))
+			for i, dep := range deps {
+				names[i] = fmt.Sprint(dep)
+			}
+			fmt.Printf("  Depends on: %s\n", strings.Join(names, ", "))
+		}
+		if dep := getStringValue(task, "blocked_by"); dep != "" {
+			fmt.Printf("  Blocked: waiting for dependency %s to back up\n", dep)
+		}
+
+		if getStringValue(task, "direction") == backup.DirectionPull {
+			fmt.Printf("  Direction: pull, copies %s into %s\n", getStringValue(task, "target_path"), getStringValue(task, "source_path"))
+		}
+
+		if warning := getStringValue(task, "schedule_warning"); warning != "" {
+			fmt.Printf("  Warning: %s\n", warning)
+		}
+
+		if n := getFloatValue(task, "unreadable_files"); n > 0 {
+			fmt.Printf("  Warning: %d unreadable files skipped\n", int(n))
+		}
+
+		if n := getFloatValue(task, "case_conflicts"); n > 0 {
+			fmt.Printf("  Warning: %d files skipped because their paths differ only in case\n", int(n))
+		}
+
+		if n := getFloatValue(task, "long_paths"); n > 0 {
+			fmt.Printf("  Warning: %d files or directories skipped because their paths in the target are too long\n", int(n))
+		}
+
+		if n := getFloatValue(task, "deferred_files"); n > 0 {
+			fmt.Printf("  Deferred: %d recently modified files left for a later backup\n", int(n))
+		}
+
+		// 上次校验发现损坏时显示损坏和修复的文件数
+		if lastScrub := getStringValue(task, "last_scrub"); lastScrub != "" {
+			fmt.Printf("  Scrubbed: %s", lastScrub)
+			if corrupt := int(getFloatValue(task, "scrub_corrupt")); corrupt > 0 {
+				fmt.Printf(", %d corrupt files found, %d repaired from source", corrupt, int(getFloatValue(task, "scrub_repaired")))
+			}
+			fmt.Println()
+		}
+
+		if n := getFloatValue(task, "excluded_files"); n > 0 {
+			fmt.Printf("  Excluded: %d files (%s) skipped by exclude rules\n",
+				int(n), formatBytes(getFloatValue(task, "excluded_bytes")))
+		}
+
+		if n := getFloatValue(task, "total_bytes_transferred"); n > 0 {
+			fmt.Printf("  Transferred: %s in total\n", formatBytes(n))
+		}
+
+		// 配置了配额时显示上次备份后的占用和余量
+		if quota := formatQuota(task); quota != "" {
+			fmt.Printf("  Quota: %s\n", quota)
+		}
+
+		// 配置了多个目标时逐个显示每个目标的结果
+		if states, ok := task["target_states"].([]interface{}); ok {
+			for _, s := range states {
+				state, ok := s.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				fmt.Printf("  Target %s: %s", getStringValue(state, "path"), getStringValue(state, "status"))
+				if lastBackup := getStringValue(state, "last_backup"); lastBackup != "" {
+					fmt.Printf(" (last backup %s)", lastBackup)
+				}
+				fmt.Println()
+			}
+		}
+
+		// 如果有错误，在下一行显示，并附上出错时间和连续失败次数
+		if errStr := getStringValue(task, "error"); errStr != "" {
+			fmt.Printf("  Error: %s\n", errStr)
+			if errTime := getStringValue(task, "last_error_time"); errTime != "" {
+				fmt.Printf("  Failed at %s, %d consecutive failures\n",
+					errTime, int(getFloatValue(task, "consecutive_failures")))
+			}
+		}
+	}
+}
+
+// 从 r 读取任务的 JSON，字段名与配置文件相同：一个对象为单个任务，数组为一次添加的多个任务
+// schedule 可以是数字，未指定时使用 -n 参数
+func readTasksJSON(r io.Reader) (tasks []map[string]any, batch bool, err error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, false, fmt.Errorf("invalid task JSON: %v", err)
+	}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		batch = true
+		err = json.Unmarshal(raw, &tasks)
+	} else {
+		var task map[string]any
+		err = json.Unmarshal(raw, &task)
+		tasks = []map[string]any{task}
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid task JSON: %v", err)
+	}
+	if len(tasks) == 0 {
+		return nil, false, fmt.Errorf("invalid task JSON: no tasks")
+	}
+
+	for i, task := range tasks {
+		if err := normalizeTaskJSON(task); err != nil {
+			if batch {
+				return nil, false, fmt.Errorf("task %d: %v", i+1, err)
+			}
+			return nil, false, err
+		}
+	}
+	return tasks, batch, nil
+}
+
+// normalizeTaskJSON 检查任务 JSON 的必填字段，并将 schedule 统一为字符串
+func normalizeTaskJSON(task map[string]any) error {
+	if task == nil {
+		return fmt.Errorf("invalid task JSON: expected an object")
+	}
+
+	switch v := task["schedule"].(type) {
+	case string:
+	case float64:
+		task["schedule"] = fmt.Sprintf("%g", v)
+	case nil:
+		if *interval > 0 {
+			task["schedule"] = fmt.Sprintf("%d", *interval)
+		}
+	default:
+		return fmt.Errorf("invalid schedule: %v", v)
+	}
+	for _, key := range []string{"name", "source_path", "target_path", "schedule"} {
+		if value, _ := task[key].(string); value == "" {
+			return fmt.Errorf("task JSON must contain name, source_path, target_path and schedule")
+		}
+	}
+	return nil
+}
+
+// splitTaskJSON 取出任务 JSON 的必填字段，其余字段作为任务选项
+func splitTaskJSON(task map[string]any) (name, sourcePath, targetPath, schedule string, options map[string]any) {
+	name, _ = task["name"].(string)
+	sourcePath, _ = task["source_path"].(string)
+	targetPath, _ = task["target_path"].(string)
+	schedule, _ = task["schedule"].(string)
+	options = make(map[string]any, len(task))
+	for key, value := range task {
+		switch key {
+		case "name", "source_path", "target_path", "schedule":
+		default:
+			options[key] = value
+		}
+	}
+	return name, sourcePath, targetPath, schedule, options
+}
+
+// 一次添加多个任务，全部成功或全部不添加；每个任务的第一次备份都需要确认
+func addTasks(c *client.Client, tasks []map[string]any) {
+	if *replace {
+		fmt.Println("Error: -replace cannot be used when adding several tasks at once")
+		os.Exit(1)
+	}
+	if !*assumeYes {
+		for _, task := range tasks {
+			if !confirmFirstRun(splitTaskJSON(task)) {
+				fmt.Println("Aborted, no tasks were added")
+				return
+			}
+		}
+	}
+
+	result, err := c.AddTasks(tasks, *force)
+	if err != nil {
+		log.Fatalf("Failed to add tasks, none were added: %v", err)
+	}
+	added, _ := result["tasks"].([]interface{})
+	var last map[string]interface{}
+	for _, item := range added {
+		task, _ := item.(map[string]interface{})
+		printAdded(getStringValue(task, "name"), task)
+		last = task
+	}
+	fmt.Printf("Added %d tasks\n", len(tasks))
+	warnUnsaved(last)
+}
+
+// warnUnsaved 在守护进程无法写入配置文件时提示修改已生效但尚未保存，守护进程会定期重试保存
+func warnUnsaved(task map[string]interface{}) {
+	if saveErr := getStringValue(task, "save_error"); saveErr != "" {
+		fmt.Printf("Warning: the change is applied but not yet saved, the config file cannot be written: %s\n", saveErr)
+	}
+}
+
+// printAdded 打印添加任务的确认信息：源和目标、间隔以及首次和下次备份的时间
+// task 为守护进程返回的任务，为 nil 时（任务添加后随即被删除）只打印任务名
+func printAdded(name string, task map[string]interface{}) {
+	if task == nil {
+		fmt.Printf("Task %s added\n", name)
+		return
+	}
+	fmt.Printf("Task %s added: %s -> %s, every %sm\n", name,
+		getStringValue(task, "source_path"), getStringValue(task, "target_path"), getStringValue(task, "schedule"))
+
+	// 定时器未能启动时不会备份，显示原因
+	if getStringValue(task, "status") == backup.StatusError {
+		fmt.Printf("Warning: no backups are scheduled: %s\n", getStringValue(task, "error"))
+		return
+	}
+	if first, err := time.Parse(time.RFC3339Nano, getStringValue(task, "first_backup")); err == nil && time.Until(first) >= time.Second {
+		fmt.Printf("First backup at %s (in %s)\n", first.Format("2006-01-02 15:04:05"), time.Until(first).Round(time.Second))
+	} else {
+		fmt.Println("First backup started")
+	}
+	if next, err := time.Parse(time.RFC3339Nano, getStringValue(task, "next_backup")); err == nil && !next.IsZero() {
+		fmt.Printf("Next backup at %s\n", next.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// maxListedDeletions 确认添加任务时最多列出的将被删除的文件数
+const maxListedDeletions = 20
+
+// 预览新任务的第一次备份，会删除目标中的文件时列出这些文件并请求确认，返回是否继续添加
+// 守护进程每个连接只处理一个命令，预览使用单独的连接
+func confirmFirstRun(name, sourcePath, targetPath, schedule string, options map[string]any) bool {
+	c, err := client.Dial(*connTimeout)
+	if err != nil {
+		log.Fatalf("Failed to connect to daemon: %v", err)
+	}
+	defer c.Close()
+
+	result, err := c.PreviewTask(name, sourcePath, targetPath, schedule, options)
+	if err != nil {
+		// 无法确认第一次备份不会删除目标中的文件，需要明确同意才继续（-yes 跳过确认）
+		fmt.Printf("Failed to preview the first backup of %s: %v\n", name, err)
+		fmt.Println("It cannot be checked which files in the target it would delete")
+		return askYes("Add this task anyway? [y/N] ")
+	}
+
+	entries, _ := result["entries"].([]interface{})
+	var deletes []string
+	for _, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok || getStringValue(entry, "action") != "-" {
+			continue
+		}
+		path := filepath.Join(getStringValue(entry, "target"), getStringValue(entry, "path"))
+		if isDir, _ := entry["is_dir"].(bool); isDir {
+			path += "/"
+		}
+		deletes = append(deletes, path)
+	}
+	if len(deletes) == 0 {
+		return true
+	}
+
+	fmt.Printf("The first backup of %s would delete %d files and directories that are not in %s:\n",
+		name, len(deletes), sourcePath)
+	for i, path := range deletes {
+		if i == maxListedDeletions {
+			fmt.Printf("  ... and %d more\n", len(deletes)-i)
+			break
+		}
+		fmt.Printf("  - %s\n", path)
+	}
+	return askYes("Add this task? [y/N] ")
+}
+
+// 打印提示并读取回答，只有 y 或 yes 视为同意
+func askYes(prompt string) bool {
+	fmt.Print(prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// 按模板逐行输出每个任务，模板的数据为任务的字段，键为 json 字段名
+func printTasksTemplate(tasks interface{}, tmpl *template.Template) error {
+	taskList, ok := tasks.([]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected task list: %T", tasks)
+	}
+	for _, t := range taskList {
+		if err := tmpl.Execute(os.Stdout, t); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// 格式化任务的配额占用和余量，未配置配额时返回空字符串
+func formatQuota(task map[string]interface{}) string {
+	var parts []string
+	if limit := getFloatValue(task, "max_target_files"); limit > 0 {
+		used := getFloatValue(task, "target_files")
+		parts = append(parts, fmt.Sprintf("%d of %d files (%d left)", int(used), int(limit), int(max(limit-used, 0))))
+	}
+	if limit := getFloatValue(task, "max_target_bytes"); limit > 0 {
+		used := getFloatValue(task, "target_bytes")
+		parts = append(parts, fmt.Sprintf("%s of %s (%s left)", formatBytes(used), formatBytes(limit), formatBytes(max(limit-used, 0))))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// 以表格形式输出备份记录
+func printHistory(result map[string]interface{}) {
+	runs, _ := result["runs"].([]interface{})
+	format := "%-20s\t%-10s\t%-8s\t%-8s\t%-8s\t%-8s\t%-12s\n"
+	if len(runs) > 0 {
+		fmt.Printf(format, "STARTED", "DURATION", "RESULT", "COPIED", "DELETED", "EXCLUDED", "BYTES")
+	}
+
+	for _, r := range runs {
+		run, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		startedAt, _ := time.Parse(time.RFC3339Nano, getStringValue(run, "started_at"))
+		finishedAt, _ := time.Parse(time.RFC3339Nano, getStringValue(run, "finished_at"))
+		result := "OK"
+		if success, _ := run["success"].(bool); !success {
+			result = "FAILED"
+		}
+
+		fmt.Printf(format,
+			startedAt.Local().Format("2006-01-02 15:04:05"),
+			finishedAt.Sub(startedAt).Round(time.Second).String(),
+			result,
+			fmt.Sprintf("%d", int(getFloatValue(run, "files_copied"))),
+			fmt.Sprintf("%d", int(getFloatValue(run, "files_deleted"))),
+			fmt.Sprintf("%d", int(getFloatValue(run, "files_excluded"))),
+			fmt.Sprintf("%d", int64(getFloatValue(run, "bytes_transferred"))),
+		)
+		if errStr := getStringValue(run, "error"); errStr != "" {
+			fmt.Printf("  Error: %s\n", errStr)
+		}
+	}
+
+	fmt.Printf("%d matching runs\n", int(getFloatValue(result, "count")))
+}
+
+// 按时间顺序输出即将执行的备份
+func printUpcoming(result map[string]interface{}, within time.Duration) {
+	runs, _ := result["runs"].([]interface{})
+	if len(runs) == 0 {
+		fmt.Printf("No backups scheduled in the next %s\n", within)
+		return
+	}
+
+	format := "%-20s\t%-20s\t%s\n"
+	fmt.Printf(format, "TIME", "NAME", "IN")
+	for _, r := range runs {
+		run, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339Nano, getStringValue(run, "at"))
+		if err != nil {
+			continue
+		}
+		in := time.Until(at).Round(time.Second).String()
+		if resumed, _ := run["resumed"].(bool); resumed {
+			in += " (snooze ends)"
+		}
+		fmt.Printf(format, at.Local().Format("2006-01-02 15:04:05"), getStringValue(run, "name"), in)
+	}
+}
+
+// 以类似 diff 的形式逐个目标输出同步计划：+ 新增、~ 覆盖、- 删除
+func printPlan(result map[string]interface{}) {
+	entries, _ := result["entries"].([]interface{})
+	var copies, deletes int
+	var copyBytes, deleteBytes float64
+	target := ""
+	for _, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if t := getStringValue(entry, "target"); t != target {
+			target = t
+			fmt.Printf("--- %s\n", target)
+		}
+
+		action, path := getStringValue(entry, "action"), getStringValue(entry, "path")
+		size := getFloatValue(entry, "size")
+		switch action {
+		case "~":
+			fmt.Printf("~ %s (%s -> %s)\n", path, formatBytes(getFloatValue(entry, "target_size")), formatBytes(size))
+		case "-":
+			if isDir, _ := entry["is_dir"].(bool); isDir {
+				fmt.Printf("- %s/\n", path)
+			} else {
+				fmt.Printf("- %s (%s)\n", path, formatBytes(size))
+			}
+		default:
+			fmt.Printf("%s %s (%s)\n", action, path, formatBytes(size))
+		}
+
+		if action == "-" {
+			deletes++
+			deleteBytes += size
+		} else {
+			copies++
+			copyBytes += size
+		}
+	}
+
+	fmt.Printf("%d files to copy (%s), %d to delete (%s)\n",
+		copies, formatBytes(copyBytes), deletes, formatBytes(deleteBytes))
+}
+
+// 以表格形式输出每个任务及其目标占用的磁盘空间和合计
+func printUsage(result map[string]interface{}, human bool) {
+	size := func(n float64) string {
+		if human {
+			return formatBytes(n)
+		}
+		return fmt.Sprintf("%d", int64(n))
+	}
+
+	format := "%-20s\t%-40s\t%-10s\t%-12s\n"
+	fmt.Printf(format, "NAME", "TARGET", "FILES", "SIZE")
+
+	tasks, _ := result["tasks"].([]interface{})
+	for _, t := range tasks {
+		task, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := getStringValue(task, "name")
+		targets, _ := task["targets"].([]interface{})
+		for _, tg := range targets {
+			target, ok := tg.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			fmt.Printf(format,
+				name,
+				getStringValue(target, "path"),
+				fmt.Sprintf("%d", int(getFloatValue(target, "files"))),
+				size(getFloatValue(target, "bytes")),
+			)
+			if errStr := getStringValue(target, "error"); errStr != "" {
+				fmt.Printf("  Error: %s\n", errStr)
+			}
+		}
+		// 多个目标时额外输出任务的合计
+		if len(targets) > 1 {
+			fmt.Printf(format, name, "(all targets)",
+				fmt.Sprintf("%d", int(getFloatValue(task, "files"))),
+				size(getFloatValue(task, "bytes")))
+		}
+	}
+
+	fmt.Printf(format, "TOTAL", "",
+		fmt.Sprintf("%d", int(getFloatValue(result, "files"))),
+		size(getFloatValue(result, "bytes")))
+}
+
+// 输出一条备份进度，包括传输速率和预计剩余时间
+func printWatchEvent(event map[string]interface{}) {
+	status := getStringValue(event, "status")
+	if status != backup.StatusRunning {
+		fmt.Printf("%s\t%s\n", getStringValue(event, "name"), status)
+		return
+	}
+
+	eta := "-"
+	if seconds := getFloatValue(event, "eta"); seconds >= 0 {
+		eta = (time.Duration(seconds) * time.Second).String()
+	}
+
+	// 显示当前阶段，复制阶段同时显示正在复制的文件及其序号
+	phase := getStringValue(event, "phase")
+	// 流式同步事先不知道总数，只显示序号
+	if file := getStringValue(event, "file"); file != "" {
+		if total := int(getFloatValue(event, "files_total")); total > 0 {
+			phase += fmt.Sprintf(" %s (file %d/%d)", file, int(getFloatValue(event, "file_number")), total)
+		} else {
+			phase += fmt.Sprintf(" %s (file %d)", file, int(getFloatValue(event, "file_number")))
+		}
+	}
+	if toDelete, deleted := int(getFloatValue(event, "to_delete")), int(getFloatValue(event, "deleted")); toDelete > 0 {
+		phase += fmt.Sprintf(" (deleted %d/%d)", deleted, toDelete)
+	} else if deleted > 0 {
+		phase += fmt.Sprintf(" (deleted %d)", deleted)
+	}
+	if paused, _ := event["paused"].(bool); paused {
+		phase += " [paused]"
+	}
+
+	fmt.Printf("%s\t%s\t%.1f%%\t%s / %s\t%s/s\tETA %s\t%s\n",
+		getStringValue(event, "name"),
+		status,
+		getFloatValue(event, "progress"),
+		formatBytes(getFloatValue(event, "bytes_done")),
+		formatBytes(getFloatValue(event, "bytes_total")),
+		formatBytes(getFloatValue(event, "rate")),
+		eta,
+		phase,
+	)
+}
+
+// 输出全局设置的当前值、启动参数指定的值以及是否已通过 set 命令修改
+func printGlobals(result map[string]interface{}) {
+	settings, _ := result["settings"].([]interface{})
+	fmt.Printf("%-16s\t%-24s\t%-24s\t%s\n", "KEY", "VALUE", "STARTUP", "SOURCE")
+	for _, item := range settings {
+		setting, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		key, value, startup := getStringValue(setting, "key"), getStringValue(setting, "value"), getStringValue(setting, "default")
+		if key == backup.GlobalLimit {
+			value, startup = globalLimitString(value), globalLimitString(startup)
+		}
+		source := "startup"
+		if set, _ := setting["set"].(bool); set {
+			source = "set"
+		}
+		fmt.Printf("%-16s\t%-24s\t%-24s\t%s\n", key, orDash(value), orDash(startup), source)
+	}
+}
+
+// orDash 空值显示为 -
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// globalLimitString 以带单位的形式显示全局速度上限
+func globalLimitString(bytes string) string {
+	n, err := strconv.ParseFloat(bytes, 64)
+	if err != nil || n <= 0 {
+		return "unlimited"
+	}
+	return formatBytes(n) + "/s"
+}
+
+// 输出正在进行的备份的快照，用于排查看起来卡住的备份
+func printInspect(status map[string]interface{}) {
+	name := getStringValue(status, "name")
+	if s := getStringValue(status, "status"); s != backup.StatusRunning {
+		fmt.Printf("Task %s has no backup running (status: %s)\n", name, s)
+		return
+	}
+
+	fmt.Printf("Task: %s\n", name)
+	if startedAt, err := time.Parse(time.RFC3339Nano, getStringValue(status, "started_at")); err == nil {
+		fmt.Printf("Started: %s (%s ago)\n", startedAt.Local().Format("2006-01-02 15:04:05"),
+			time.Since(startedAt).Round(time.Second))
+	}
+	fmt.Printf("Phase: %s\n", getStringValue(status, "phase"))
+	if paused, _ := status["paused"].(bool); paused {
+		fmt.Printf("Paused: yes, resume with 'watchman resume-run %s'\n", name)
+	}
+	if target := getStringValue(status, "target"); target != "" {
+		fmt.Printf("Target: %s\n", target)
+	}
+
+	if file := getStringValue(status, "file"); file != "" {
+		n, total := int(getFloatValue(status, "file_number")), int(getFloatValue(status, "files_total"))
+		elapsed := time.Duration(getFloatValue(status, "file_time") * float64(time.Second)).Round(time.Second)
+		if total > 0 {
+			fmt.Printf("Copying: %s (file %d/%d, %d remaining after it, %s on this file)\n", file, n, total, total-n, elapsed)
+		} else {
+			// 流式同步事先不知道需要复制的文件数
+			fmt.Printf("Copying: %s (file %d, %s on this file)\n", file, n, elapsed)
+		}
+	}
+	if toDelete, deleted := int(getFloatValue(status, "to_delete")), int(getFloatValue(status, "deleted")); toDelete > 0 {
+		fmt.Printf("Deleting: %d/%d orphaned entries removed, %d remaining\n", deleted, toDelete, toDelete-deleted)
+	} else if deleted > 0 {
+		fmt.Printf("Deleting: %d orphaned entries removed\n", deleted)
+	}
+
+	eta := "unknown"
+	if seconds := getFloatValue(status, "eta"); seconds >= 0 {
+		eta = (time.Duration(seconds) * time.Second).String()
+	}
+	fmt.Printf("Transferred: %s / %s at %s/s, ETA %s\n",
+		formatBytes(getFloatValue(status, "bytes_done")), formatBytes(getFloatValue(status, "bytes_total")),
+		formatBytes(getFloatValue(status, "rate")), eta)
+	fmt.Printf("Progress: %.1f%%\n", getFloatValue(status, "progress"))
+}
+
+// 解析带单位的大小，如 500MB、5GB，不带单位时按字节处理
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	}
+
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	var n float64
+	if _, err := fmt.Sscanf(value, "%g", &n); err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// 将字节数格式化为易读的形式
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// 以缩进的 JSON 格式输出结构化数据
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to format output: %v", err)
+	}
+	fmt.Println(string(data))
+}
+
+// 辅助函数：安全地获取字符串值
+func getStringValue(m map[string]interface{}, key string) string {
+	if val, ok := m[key].(string); ok {
+		return val
+	}
+	return ""
+}
+
+// 辅助函数：安全地获取浮点数值
+func getFloatValue(m map[string]interface{}, key string) float64 {
+	switch v := m[key].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	default:
+		return 0
+	}
+}
+
+// 向 systemd 报告守护进程的状态，不在 systemd 下运行时不做任何事
+func sdNotify(state string) {
+	if err := daemon.Notify(state); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+}
+
+// progressPrinter returns the callback that writes progress updates to stdout
+// in the given format, or nil when format is empty
+func progressPrinter(format string) (func(*backup.TransferStatus), error) {
+	switch format {
+	case "":
+		return nil, nil
+	case "json":
+		// 多个任务可能同时备份，逐行加锁输出避免交错
+		var mu sync.Mutex
+		enc := json.NewEncoder(os.Stdout)
+		return func(status *backup.TransferStatus) {
+			mu.Lock()
+			defer mu.Unlock()
+			enc.Encode(status)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, must be json", format)
+	}
+}
+
+func runAsDaemon() {
+	// 检查是否已有守护进程在运行
+	if checkRunningDaemon() {
 		log.Fatal("Watchman daemon is already running")
 	}
 
+	if *concurrency < 0 {
+		log.Fatalf("Invalid -max-concurrent: %d", *concurrency)
+	}
+
+	var limit int64
+	if *globalLimit != "" {
+		size, err := parseSize(*globalLimit)
+		if err != nil {
+			log.Fatalf("Invalid -global-limit: %v", err)
+		}
+		limit = size
+	}
+
+	onProgress, err := progressPrinter(*progressOut)
+	if err != nil {
+		log.Fatalf("Invalid -progress: %v", err)
+	}
+
+	// 每个任务的日志另外写入各自的日志文件
+	var taskLogs *daemon.TaskLogs
+	if *logDir != "" {
+		maxSize, err := parseSize(*logMaxSize)
+		if err != nil {
+			log.Fatalf("Invalid -log-max-size: %v", err)
+		}
+		if taskLogs, err = daemon.NewTaskLogs(*logDir, maxSize, *logKeep); err != nil {
+			log.Fatalf("Failed to set up task logs: %v", err)
+		}
+		defer taskLogs.Close()
+		log.SetOutput(io.MultiWriter(os.Stderr, taskLogs))
+	}
+
 	// 创建进程锁
 	if err := createPIDFile(); err != nil {
 		log.Fatalf("Failed to create PID file: %v", err)
@@ -259,36 +1760,119 @@ func runAsDaemon() {
 	defer cleanupPIDFile()
 
 	// 创建备份管理器
-	manager, err := backup.NewManager(*configFile)
+	manager, err := backup.NewManager(*configFile, backup.ManagerOptions{
+		Jitter:        *jitter,
+		GlobalLimit:   limit,
+		AuditLog:      auditLogPath(),
+		MaxConcurrent: *concurrency,
+		OnProgress:    onProgress,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create backup manager: %v", err)
 	}
-
-	// 创建并启动 socket 服务器
-	server, err := daemon.NewServer(manager)
-	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+	if *verifyStart {
+		go manager.VerifyTargets()
 	}
-	defer server.Close()
 
 	// 处理信号
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// 启动服务器
-	go func() {
-		if err := server.Start(); err != nil {
-			log.Printf("Server error: %v", err)
-			sigChan <- syscall.SIGTERM
+	// 创建 socket 服务器；设置了 -socket-retry 时创建失败不退出，定时器照常运行，在后台定期重试
+	logWriters := []io.Writer{os.Stderr}
+	if taskLogs != nil {
+		logWriters = append(logWriters, taskLogs)
+	}
+	var (
+		serverMu sync.Mutex
+		server   *daemon.Server
+		stopping bool
+	)
+	listen := func() error {
+		s, err := daemon.NewServer(manager)
+		if err != nil {
+			return err
+		}
+		serverMu.Lock()
+		defer serverMu.Unlock()
+		if stopping {
+			return s.Close()
+		}
+		server = s
+		// 日志同时输出给通过 tail 命令连接的客户端
+		log.SetOutput(io.MultiWriter(append(logWriters, s.LogWriter())...))
+		go func() {
+			if err := s.Start(); err != nil {
+				log.Printf("Server error: %v", err)
+				sigChan <- syscall.SIGTERM
+			}
+		}()
+		return nil
+	}
+	defer func() {
+		serverMu.Lock()
+		defer serverMu.Unlock()
+		stopping = true
+		if server != nil {
+			server.Close()
 		}
 	}()
 
+	if err := listen(); err != nil {
+		if *socketRetry <= 0 {
+			log.Fatalf("Failed to create server: %v", err)
+		}
+		log.Printf("Warning: failed to create server: %v; backups keep running without the control socket, retrying every %v", err, *socketRetry)
+		go func() {
+			for range time.Tick(*socketRetry) {
+				if err := listen(); err != nil {
+					log.Printf("Failed to create server: %v", err)
+					continue
+				}
+				log.Printf("Control socket %s is now listening", ipc.SockAddr)
+				return
+			}
+		}()
+	}
+
+	// 容器的存活和就绪探针
+	var health *daemon.HealthServer
+	if *healthAddr != "" {
+		if health, err = daemon.NewHealthServer(*healthAddr, manager); err != nil {
+			log.Fatalf("Failed to create health server: %v", err)
+		}
+		defer health.Close()
+		go func() {
+			if err := health.Start(); err != nil {
+				log.Printf("Health server error: %v", err)
+			}
+		}()
+	}
+
+	handleControlSignals(manager)
+
+	// systemd 配置了看门狗时定期报告存活；管理器的锁无法获取（如死锁）时停止报告，由 systemd 重启
+	if interval := daemon.WatchdogInterval(); interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				manager.ListTasks()
+				sdNotify("WATCHDOG=1")
+			}
+		}()
+	}
+
 	log.Println("Watchman daemon started")
+	// 任务已加载，socket 已在监听或在后台重试
+	sdNotify("READY=1")
+	if health != nil {
+		health.SetReady()
+	}
 
 	// 等待信号
 	<-sigChan
 
 	// 关闭所有定时器
+	sdNotify("STOPPING=1")
 	manager.Shutdown()
 	log.Println("Shutting down Watchman...")
 }
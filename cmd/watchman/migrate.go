@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tangthinker/watchman/internal/backup"
+	"github.com/tangthinker/watchman/internal/client"
+)
+
+// rsyncTask 从 rsync 命令行解析出的任务
+type rsyncTask struct {
+	sourcePath string
+	targetPath string
+	delete     bool
+	excludes   []string
+	ignored    []string // 无需对应或暂不支持的参数
+}
+
+// 从 rsync 命令行导入备份任务，添加前输出任务并请求确认
+func runMigrate(c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fromRsync := fs.String("from-rsync", "", "要导入的 rsync 命令行")
+	name := fs.String("name", "", "任务名称（默认使用源目录名）")
+	minutes := fs.Int("n", 60, "备份间隔（分钟）")
+	yes := fs.Bool("yes", false, "不询问直接添加")
+	fs.Parse(args)
+
+	if *fromRsync == "" || fs.NArg() != 0 {
+		fmt.Println("Usage: watchman migrate -from-rsync \"<rsync command>\" [-name <name>] [-n <minutes>] [-yes]")
+		os.Exit(1)
+	}
+	if *minutes <= 0 {
+		return fmt.Errorf("interval (-n) must be greater than 0")
+	}
+
+	task, err := parseRsync(*fromRsync)
+	if err != nil {
+		return err
+	}
+	if *name == "" {
+		*name = filepath.Base(task.sourcePath)
+	}
+
+	options := make(map[string]any)
+	if !task.delete {
+		// rsync 不带 --delete 时不删除目标中多余的文件
+		options["no_delete"] = true
+	}
+	if len(task.excludes) > 0 {
+		options["exclude"] = task.excludes
+	}
+
+	fmt.Printf("Name:     %s\n", *name)
+	fmt.Printf("Source:   %s\n", task.sourcePath)
+	fmt.Printf("Target:   %s\n", task.targetPath)
+	fmt.Printf("Interval: %dm\n", *minutes)
+	fmt.Printf("Delete:   %t\n", task.delete)
+	if len(task.excludes) > 0 {
+		fmt.Printf("Exclude:  %s\n", strings.Join(task.excludes, ", "))
+	}
+	if len(task.ignored) > 0 {
+		fmt.Printf("Ignored:  %s\n", strings.Join(task.ignored, " "))
+	}
+
+	if !*yes {
+		fmt.Print("Add this task? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	if *force {
+		options["force"] = true
+	}
+	added, err := c.AddTask(*name, task.sourcePath, task.targetPath, fmt.Sprintf("%d", *minutes), options)
+	if err != nil {
+		return err
+	}
+	printAdded(*name, added)
+	return nil
+}
+
+// 将配置文件连同任务的缓存和审计日志复制或移动到新位置，不需要守护进程
+func runMigrateConfig(args []string) {
+	fs := flag.NewFlagSet("migrate-config", flag.ExitOnError)
+	from := fs.String("from", *configFile, "原配置文件路径（默认为 -config 指定的路径）")
+	to := fs.String("to", "", "新配置文件路径")
+	move := fs.Bool("move", false, "复制完成后删除原配置文件及其缓存")
+	fs.Parse(args)
+
+	if *to == "" || fs.NArg() != 0 {
+		fmt.Println("Usage: watchman migrate-config [-from <old config>] -to <new config> [-move]")
+		os.Exit(1)
+	}
+	// 守护进程运行时会继续写入原配置文件，复制的状态随即过时
+	if checkRunningDaemon() {
+		fmt.Println("Error: daemon is running, stop it before relocating the config file")
+		os.Exit(1)
+	}
+
+	result, err := backup.RelocateConfig(*from, *to, *move)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if result.Migration != nil {
+		fmt.Printf("Upgraded schema version %d to %d\n", result.Migration.From, result.Migration.To)
+	}
+	fmt.Printf("Wrote %d tasks to %s\n", result.Tasks, *to)
+	for _, path := range result.Files {
+		fmt.Printf("  copied %s\n", path)
+	}
+	if result.Removed {
+		fmt.Printf("Removed %s\n", *from)
+	}
+	fmt.Printf("Start the daemon with -config %s to use it\n", *to)
+}
+
+// unsupportedShortFlags 会改变 rsync 命令语义的短参数：-n（--dry-run）、-e（--rsh）和 -f（--filter）
+const unsupportedShortFlags = "nef"
+
+// parseRsync 解析一条简单的 rsync 命令行
+// 支持源和目标路径、--delete 和 --exclude，其余参数忽略；远程路径和会改变语义的参数会报错
+func parseRsync(cmdline string) (*rsyncTask, error) {
+	words, err := splitWords(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) > 0 && filepath.Base(words[0]) == "rsync" {
+		words = words[1:]
+	}
+
+	task := &rsyncTask{}
+	var paths []string
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		switch {
+		case word == "--delete" || strings.HasPrefix(word, "--delete-"):
+			task.delete = true
+		case word == "--exclude":
+			if i+1 >= len(words) {
+				return nil, fmt.Errorf("--exclude requires a pattern")
+			}
+			i++
+			task.excludes = append(task.excludes, rsyncPattern(words[i]))
+		case strings.HasPrefix(word, "--exclude="):
+			task.excludes = append(task.excludes, rsyncPattern(strings.TrimPrefix(word, "--exclude=")))
+		case word == "--dry-run" || word == "--rsh" ||
+			strings.HasPrefix(word, "--rsh=") || strings.HasPrefix(word, "--include") ||
+			strings.HasPrefix(word, "--filter") || strings.HasPrefix(word, "--files-from"):
+			return nil, fmt.Errorf("unsupported rsync option: %s", word)
+		case len(word) > 1 && word[0] == '-' && word[1] != '-':
+			// 短参数可以合并书写，如 -avn 等同于 -a -v -n
+			if i := strings.IndexAny(word[1:], unsupportedShortFlags); i >= 0 {
+				if len(word) == 2 {
+					return nil, fmt.Errorf("unsupported rsync option: %s", word)
+				}
+				return nil, fmt.Errorf("unsupported rsync option: -%c in %s", word[1+i], word)
+			}
+			task.ignored = append(task.ignored, word)
+		case strings.HasPrefix(word, "-") && word != "-":
+			task.ignored = append(task.ignored, word)
+		default:
+			paths = append(paths, word)
+		}
+	}
+
+	if len(paths) != 2 {
+		return nil, fmt.Errorf("expected exactly one source and one destination, got %d paths", len(paths))
+	}
+	for _, path := range paths {
+		if strings.Contains(path, ":") && !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, ".") {
+			return nil, fmt.Errorf("remote path %s is not supported", path)
+		}
+	}
+
+	source, err := filepath.Abs(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	target, err := filepath.Abs(paths[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// 与 rsync 一致：源路径不以 / 结尾时，目录本身会被复制到目标目录下
+	if !strings.HasSuffix(paths[0], "/") {
+		target = filepath.Join(target, filepath.Base(source))
+	}
+
+	task.sourcePath = source
+	task.targetPath = target
+	return task, nil
+}
+
+// rsyncPattern 将 rsync 的排除规则转换为 watchman 的通配符
+// 去掉表示锚定到源目录的前导 / 和表示只匹配目录的末尾 /
+func rsyncPattern(pattern string) string {
+	return strings.Trim(pattern, "/")
+}
+
+// splitWords 按 shell 的规则拆分命令行，支持单引号、双引号和反斜杠转义
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command line")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "github.com/tangthinker/watchman/internal/backup"
+
+// handleControlSignals 在没有 SIGUSR1、SIGUSR2 和 SIGHUP 的平台上不做任何处理，
+// 任务状态可以通过 list 命令查看，修改配置文件后需要重启守护进程
+func handleControlSignals(manager *backup.Manager) {}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tangthinker/watchman/internal/backup"
+)
+
+// handleControlSignals 处理控制守护进程的信号：SIGUSR1 立即执行所有活动任务的备份，
+// SIGUSR2 将任务状态输出到日志，SIGHUP 重新加载配置文件
+func handleControlSignals(manager *backup.Manager) {
+	usrChan := make(chan os.Signal, 1)
+	signal.Notify(usrChan, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+	go func() {
+		for sig := range usrChan {
+			switch sig {
+			case syscall.SIGUSR1:
+				log.Println("Received SIGUSR1, running all active tasks")
+				manager.RunAll()
+			case syscall.SIGUSR2:
+				manager.LogStatus()
+			case syscall.SIGHUP:
+				log.Println("Received SIGHUP, reloading config file")
+				sdNotify("RELOADING=1")
+				if err := manager.Reload(); err != nil {
+					log.Printf("Failed to reload config file: %v", err)
+				}
+				sdNotify("READY=1")
+			}
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// auditLog 以 JSON 行的形式把任务生命周期事件追加到文件中
+// 守护进程只会追加写入，因此它是独立于任务历史（只保留最近的备份）的持久记录
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openAuditLog 以追加方式打开审计日志，不存在时创建
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	return &auditLog{file: file}, nil
+}
+
+// record 追加一条事件并同步到磁盘，写入失败只记录日志，不影响备份
+func (a *auditLog) record(event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode audit event: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+		return
+	}
+	if err := a.file.Sync(); err != nil {
+		log.Printf("Failed to sync audit log: %v", err)
+	}
+}
+
+// ReadAudit 返回 path 处审计日志中最后 n 条事件，按时间从旧到新，可以只返回单个任务的事件；n <= 0 时返回全部
+// 无法解析的行（如因崩溃而被截断的行）会被跳过
+func ReadAudit(path, task string, n int) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if task != "" && event.Task != task {
+			continue
+		}
+		events = append(events, event)
+		// 只保留最后 n 条，避免读取很大的审计日志时占用过多内存
+		if n > 0 && len(events) > 2*n {
+			events = append(events[:0], events[len(events)-n:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if n > 0 && len(events) > n {
+		events = events[len(events)-n:]
+	}
+	return events, nil
+}
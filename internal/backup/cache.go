@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// hashCache 文件哈希缓存，键为相对路径
+// 文件的大小和修改时间与缓存记录一致时直接复用缓存的哈希值，避免重新读取文件内容
+type hashCache map[string]cacheEntry
+
+// cacheEntry 单个文件的缓存记录
+type cacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+	Hash    string `json:"hash"`
+}
+
+// hashCacheVersion 缓存文件格式的版本，格式发生不兼容的变化时递增，旧版本的缓存会被丢弃并重建
+const hashCacheVersion = 1
+
+// hashCacheFile 缓存文件的内容
+// 记录生成缓存时的源目录、目标目录和压缩设置，任务的路径或设置改变后缓存自动失效
+type hashCacheFile struct {
+	Version    int       `json:"version"`
+	SourcePath string    `json:"source_path"`
+	TargetPath string    `json:"target_path"`
+	Compressed bool      `json:"compressed,omitempty"`
+	Files      hashCache `json:"files"`
+}
+
+// newHashCacheFile 生成同步 opts 的缓存文件头
+func newHashCacheFile(opts SyncOptions, files hashCache) hashCacheFile {
+	return hashCacheFile{
+		Version:    hashCacheVersion,
+		SourcePath: filepath.Clean(opts.SourcePath),
+		TargetPath: filepath.Clean(opts.TargetPath),
+		Compressed: opts.Compress,
+		Files:      files,
+	}
+}
+
+// loadHashCache 从文件加载同步 opts 的目标哈希缓存
+// 文件不存在、损坏、版本不兼容或属于其他路径和设置时返回空缓存，本次同步重新计算哈希并重写缓存
+func loadHashCache(path string, opts SyncOptions) hashCache {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read hash cache %s: %v", path, err)
+		}
+		return make(hashCache)
+	}
+
+	var file hashCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		log.Printf("Ignoring corrupt hash cache %s: %v", path, err)
+		return make(hashCache)
+	}
+
+	want := newHashCacheFile(opts, nil)
+	switch {
+	case file.Version != hashCacheVersion:
+		log.Printf("Ignoring hash cache %s: format version %d is not supported, rebuilding", path, file.Version)
+	case file.SourcePath != want.SourcePath || file.TargetPath != want.TargetPath:
+		log.Printf("Ignoring hash cache %s: it was built for %s -> %s, rebuilding", path, file.SourcePath, file.TargetPath)
+	case file.Compressed != want.Compressed:
+		log.Printf("Ignoring hash cache %s: the compress setting has changed, rebuilding", path)
+	case file.Files != nil:
+		return file.Files
+	}
+	return make(hashCache)
+}
+
+// save 将同步 opts 的哈希缓存写入文件，先写入临时文件再重命名，避免留下不完整的缓存
+func (c hashCache) save(path string, opts SyncOptions) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(newHashCacheFile(opts, c))
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + tmpSuffix
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// lookup 返回大小和修改时间都匹配时缓存的哈希值
+func (c hashCache) lookup(relPath string, size, modTime int64) (string, bool) {
+	entry, ok := c[relPath]
+	if !ok || entry.Size != size || entry.ModTime != modTime {
+		return "", false
+	}
+	return entry.Hash, true
+}
+
+// files 将缓存还原为目标目录 targetPath 的扫描结果，缓存中不记录目录
+func (c hashCache) files(targetPath string) map[string]*FileInfo {
+	files := make(map[string]*FileInfo, len(c))
+	for relPath, entry := range c {
+		files[relPath] = &FileInfo{
+			Path:    filepath.Join(targetPath, relPath),
+			Size:    entry.Size,
+			Hash:    entry.Hash,
+			ModTime: entry.ModTime,
+		}
+	}
+	return files
+}
+
+// newHashCache 根据扫描结果生成哈希缓存
+func newHashCache(files map[string]*FileInfo) hashCache {
+	cache := make(hashCache, len(files))
+	for relPath, file := range files {
+		if file.IsDir {
+			continue
+		}
+		cache[relPath] = cacheEntry{
+			Size:    file.Size,
+			ModTime: file.ModTime,
+			Hash:    file.Hash,
+		}
+	}
+	return cache
+}
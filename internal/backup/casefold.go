@@ -0,0 +1,53 @@
+package backup
+
+import (
+	"sort"
+	"strings"
+)
+
+// foldSourcePaths 找出只有大小写不同的源路径，每组保留按字典序排在最前的一个
+// 返回保留下来的文件和被跳过的相对路径；这些路径在不区分大小写的目标中会指向同一个文件
+func foldSourcePaths(sourceFiles map[string]*FileInfo) (map[string]*FileInfo, []string) {
+	paths := make([]string, 0, len(sourceFiles))
+	for relPath := range sourceFiles {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+
+	kept := make(map[string]*FileInfo, len(sourceFiles))
+	seen := make(map[string]bool, len(sourceFiles))
+	var conflicts []string
+	for _, relPath := range paths {
+		key := strings.ToLower(relPath)
+		if seen[key] {
+			conflicts = append(conflicts, relPath)
+			continue
+		}
+		seen[key] = true
+		kept[relPath] = sourceFiles[relPath]
+	}
+	return kept, conflicts
+}
+
+// foldTargetPaths 将只有大小写与源路径不同的目标文件改为以源路径为键，
+// 使其参与比较而不会被当作源目录中已不存在的文件删除
+func foldTargetPaths(targetFiles, sourceFiles map[string]*FileInfo) map[string]*FileInfo {
+	sourceByKey := make(map[string]string, len(sourceFiles))
+	for relPath := range sourceFiles {
+		sourceByKey[strings.ToLower(relPath)] = relPath
+	}
+
+	folded := make(map[string]*FileInfo, len(targetFiles))
+	for relPath, file := range targetFiles {
+		if _, exists := sourceFiles[relPath]; !exists {
+			// 目标中同时存在大小写完全一致的文件时优先使用它
+			if sourceRel, ok := sourceByKey[strings.ToLower(relPath)]; ok {
+				if _, exact := targetFiles[sourceRel]; !exact {
+					relPath = sourceRel
+				}
+			}
+		}
+		folded[relPath] = file
+	}
+	return folded
+}
@@ -0,0 +1,56 @@
+package backup
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// gzipSuffix 启用压缩时目标文件名追加的后缀
+const gzipSuffix = ".gz"
+
+// calculateGzipHash 计算 gzip 文件解压后内容的SHA256哈希值，与源文件的哈希值可直接比较
+// 文件不是有效的 gzip 格式时退回到计算原始内容的哈希值，使其被视为已变化并重新复制
+func calculateGzipHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return calculateHash(path)
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return calculateHash(path)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// compressedNames 将源文件的相对路径映射为目标中压缩后的文件名，目录保持不变
+func compressedNames(files map[string]*FileInfo) map[string]*FileInfo {
+	renamed := make(map[string]*FileInfo, len(files))
+	for relPath, file := range files {
+		if !file.IsDir {
+			relPath += gzipSuffix
+		}
+		renamed[relPath] = file
+	}
+	return renamed
+}
+
+// withCompressedNames 返回包含原路径及其压缩后文件名的新列表
+func withCompressedNames(paths []string) []string {
+	result := make([]string, 0, 2*len(paths))
+	for _, relPath := range paths {
+		result = append(result, relPath, relPath+gzipSuffix)
+	}
+	return result
+}
@@ -0,0 +1,35 @@
+package backup
+
+import (
+	"time"
+)
+
+// debugDecision 输出同步对单个源文件作出的决定及其依据，target 为 nil 表示目标中不存在
+func debugDecision(debugf func(format string, args ...any), relPath string, source, target *FileInfo, precision time.Duration) {
+	switch {
+	case target == nil:
+		debugf("copy %s: not in target (source %d bytes, hash %s)", relPath, source.Size, shortHash(source.Hash))
+	case source.Hash != target.Hash:
+		debugf("copy %s: content differs (source %d bytes, hash %s, mtime %s; target %d bytes, hash %s, mtime %s)",
+			relPath, source.Size, shortHash(source.Hash), formatUnix(source.ModTime),
+			target.Size, shortHash(target.Hash), formatUnix(target.ModTime))
+	case !sameModTime(source.ModTime, target.ModTime, precision):
+		debugf("touch %s: same content, mtime differs beyond %s (source %s, target %s)",
+			relPath, precision, formatUnix(source.ModTime), formatUnix(target.ModTime))
+	default:
+		debugf("skip %s: unchanged (hash %s)", relPath, shortHash(source.Hash))
+	}
+}
+
+// shortHash 截取哈希值的前 12 位，便于在日志中比较
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// formatUnix 格式化以秒为单位的修改时间
+func formatUnix(sec int64) string {
+	return time.Unix(sec, 0).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// dedupTarget 将目标目录中内容相同的文件替换为指向同一 inode 的硬链接
+// files 为本次同步后目标目录中应存在的文件（即源目录的扫描结果），返回被替换的文件数和回收的字节数
+// 硬链接共享修改时间等元数据，因此只有内容和修改时间都相同的文件才会被合并
+func dedupTarget(targetPath string, files map[string]*FileInfo) (int, int64) {
+	groups := make(map[string][]string)
+	for relPath, file := range files {
+		if file.IsDir || file.Size == 0 {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", file.Hash, file.ModTime)
+		groups[key] = append(groups[key], relPath)
+	}
+
+	linked := 0
+	var reclaimed int64
+	for _, paths := range groups {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+
+		canonical := filepath.Join(targetPath, paths[0])
+		for _, relPath := range paths[1:] {
+			duplicate := filepath.Join(targetPath, relPath)
+			ok, err := linkDuplicate(canonical, duplicate)
+			if err != nil {
+				log.Printf("Failed to deduplicate %s: %v", duplicate, err)
+				continue
+			}
+			if ok {
+				linked++
+				reclaimed += files[relPath].Size
+			}
+		}
+	}
+
+	return linked, reclaimed
+}
+
+// linkDuplicate 将 duplicate 替换为指向 canonical 的硬链接
+// 先在临时路径创建链接再重命名，保证任何时刻 duplicate 都是完整的文件
+func linkDuplicate(canonical, duplicate string) (bool, error) {
+	canonicalInfo, err := os.Lstat(canonical)
+	if err != nil {
+		return false, err
+	}
+	duplicateInfo, err := os.Lstat(duplicate)
+	if err != nil {
+		return false, err
+	}
+
+	// 只处理普通文件，且大小必须一致
+	if !canonicalInfo.Mode().IsRegular() || !duplicateInfo.Mode().IsRegular() {
+		return false, nil
+	}
+	if canonicalInfo.Size() != duplicateInfo.Size() {
+		return false, fmt.Errorf("size mismatch with %s", canonical)
+	}
+
+	// 已经是同一个文件
+	if os.SameFile(canonicalInfo, duplicateInfo) {
+		return false, nil
+	}
+
+	tmpPath := duplicate + tmpSuffix
+	os.Remove(tmpPath)
+	if err := os.Link(canonical, tmpPath); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmpPath, duplicate); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,193 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dependencyPollInterval 依赖的任务正在备份或排队时，检查它是否已完成的间隔
+const dependencyPollInterval = time.Second
+
+// dependencyError 返回任务的依赖无效的原因：依赖的任务不存在、依赖自身，或沿依赖回到该任务的循环
+// 添加或修改任务产生的循环一定经过该任务，因此只检查它即可
+func dependencyError(tasks map[string]*BackupTask, name string) error {
+	task := tasks[name]
+	for _, dep := range task.DependsOn {
+		if dep == name {
+			return fmt.Errorf("task %s cannot depend on itself", name)
+		}
+		if _, exists := tasks[dep]; !exists {
+			return fmt.Errorf("dependency %s does not exist", dep)
+		}
+	}
+
+	// 沿依赖深度优先查找回到该任务的路径
+	visited := make(map[string]bool)
+	var find func(current string, path []string) []string
+	find = func(current string, path []string) []string {
+		path = append(path, current)
+		for _, dep := range tasks[current].DependsOn {
+			if dep == name {
+				return append(path, dep)
+			}
+			if _, exists := tasks[dep]; !exists || visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if cycle := find(dep, path); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	if cycle := find(name, nil); cycle != nil {
+		return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// dependencyErrors 检查从配置文件（可能被手工编辑过）读取的每个任务的依赖，返回依赖无效的任务及其原因
+func dependencyErrors(tasks []BackupTask) map[string]error {
+	byName := make(map[string]*BackupTask, len(tasks))
+	for i := range tasks {
+		byName[tasks[i].Name] = &tasks[i]
+	}
+	errs := make(map[string]error)
+	for _, task := range tasks {
+		if err := dependencyError(byName, task.Name); err != nil {
+			errs[task.Name] = err
+		}
+	}
+	return errs
+}
+
+// dependents 返回依赖给定任务的任务名（调用者持有 m.mu）
+func (m *Manager) dependents(name string) []string {
+	var names []string
+	for other, task := range m.tasks {
+		if slices.Contains(task.DependsOn, name) {
+			names = append(names, other)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// unmetDependency 返回使任务暂时不能备份的依赖及原因：该依赖从未备份过、最近一次备份失败，
+// 或最近一次成功备份已超过它自己的间隔
+func unmetDependency(tasks map[string]*BackupTask, task *BackupTask, now time.Time) (string, error) {
+	for _, dep := range task.DependsOn {
+		other, exists := tasks[dep]
+		if !exists {
+			return dep, fmt.Errorf("dependency %s does not exist", dep)
+		}
+		// 依赖的任务已停止或暂停时它不会再自行备份，在原因中说明
+		state := ""
+		if other.Status == StatusStopped || other.Status == StatusPaused {
+			state = fmt.Sprintf(" (it is %s)", strings.ToLower(other.Status))
+		}
+		if other.LastBackup.IsZero() {
+			return dep, fmt.Errorf("dependency %s has not completed a backup yet%s", dep, state)
+		}
+		if n := len(other.History); n > 0 && !other.History[n-1].Success {
+			return dep, fmt.Errorf("latest backup of dependency %s failed%s", dep, state)
+		}
+		if interval, err := parseSchedule(other.Schedule); err == nil && other.LastBackup.Before(now.Add(-interval)) {
+			return dep, fmt.Errorf("dependency %s has not completed a backup within its interval %s%s", dep, interval, state)
+		}
+	}
+	return "", nil
+}
+
+// waitForDependencies 在任务依赖的任务正在备份或等待名额时等待，使同时触发的任务按依赖顺序执行，
+// 然后检查每个依赖是否都是最新的，返回不满足的依赖（如有）
+func (m *Manager) waitForDependencies(name string) (string, error) {
+	logged := false
+	for {
+		m.mu.RLock()
+		task := m.tasks[name]
+		if task == nil || len(task.DependsOn) == 0 {
+			m.mu.RUnlock()
+			return "", nil
+		}
+		busy := ""
+		for _, dep := range task.DependsOn {
+			transfer, running := m.transfers[dep]
+			if running && !transfer.scrub {
+				busy = dep
+				break
+			}
+			if position, _ := m.queue.position(dep); position > 0 {
+				busy = dep
+				break
+			}
+		}
+		if busy == "" {
+			dep, err := unmetDependency(m.tasks, task, time.Now())
+			m.mu.RUnlock()
+			return dep, err
+		}
+		m.mu.RUnlock()
+
+		if !logged {
+			log.Printf("[Task: %s] Waiting for dependency %s to finish its backup", name, busy)
+			logged = true
+		}
+		time.Sleep(dependencyPollInterval)
+	}
+}
+
+// skipForDependency 记录因依赖 dep 不是最新而跳过的备份；依赖下次备份成功后该任务立即备份，
+// 该任务自己每次定时触发时也会重新检查依赖
+func (m *Manager) skipForDependency(name, dep string, err error) {
+	log.Printf("[Task: %s] Skipping backup: %v", name, err)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task, exists := m.tasks[name]
+	if !exists {
+		return
+	}
+	m.blocked[name] = dep
+	if task.Status != StatusStopped && task.Status != StatusPaused && task.Status != StatusRunning {
+		task.Status = StatusUnavailable
+		task.Error = err.Error()
+	}
+	m.events.publish(Event{Type: EventSkipped, Task: name, Status: task.Status, Error: err.Error()})
+}
+
+// runBlocked 在给定任务备份成功后，启动因它不是最新而跳过备份的任务
+func (m *Manager) runBlocked(name string) {
+	m.mu.Lock()
+	var ready []string
+	for blocked := range m.blocked {
+		task, exists := m.tasks[blocked]
+		if !exists {
+			delete(m.blocked, blocked)
+			continue
+		}
+		// 已停止或暂停的任务不因依赖完成而备份，恢复时会清除记录并重新检查依赖
+		if _, active := m.timers[blocked]; !active || !slices.Contains(task.DependsOn, name) {
+			continue
+		}
+		delete(m.blocked, blocked)
+		ready = append(ready, blocked)
+	}
+	m.mu.Unlock()
+
+	for _, dependent := range ready {
+		log.Printf("[Task: %s] Dependency %s backed up, starting the skipped backup", dependent, name)
+		m.startBackup(dependent)
+	}
+}
+
+// BlockedBy 返回使任务跳过了上次备份的依赖，任务没有在等待依赖时返回空字符串
+func (m *Manager) BlockedBy(name string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.blocked[name]
+}
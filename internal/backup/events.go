@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"sync"
+	"time"
+)
+
+// 守护进程事件的类型
+const (
+	EventAdded    = "added"    // 添加了任务
+	EventUpdated  = "updated"  // 通过 replace 更新了任务
+	EventDeleted  = "deleted"  // 删除了任务
+	EventStopped  = "stopped"  // 停止了任务
+	EventStarted  = "started"  // 开始备份
+	EventProgress = "progress" // 备份进度更新
+	EventFinished = "finished" // 备份成功完成
+	EventFailed   = "failed"   // 备份失败
+	EventSkipped  = "skipped"  // 源目录不可用、仍在变化或依赖的任务尚未成功备份，跳过了备份
+	EventScrubbed = "scrubbed" // 完成了目标的完整性校验，发现损坏时 Error 描述损坏和修复的文件数
+	EventDrifted  = "drifted"  // 启动时的快速校验发现目标与源目录不一致，Error 描述差异
+)
+
+// eventBufferSize 每个订阅者缓冲的事件数，订阅者来不及处理时丢弃新的事件
+const eventBufferSize = 64
+
+// Event 推送给订阅者的任务状态变化
+type Event struct {
+	Type     string    `json:"type"`
+	Task     string    `json:"task"`
+	Time     time.Time `json:"time"`
+	Status   string    `json:"status,omitempty"`
+	Progress float64   `json:"progress,omitempty"`
+	Error    string    `json:"error,omitempty"`
+
+	// 备份结束（finished、failed）时本次备份复制和删除的文件数以及写入的字节数
+	FilesCopied      int   `json:"files_copied,omitempty"`
+	FilesDeleted     int   `json:"files_deleted,omitempty"`
+	BytesTransferred int64 `json:"bytes_transferred,omitempty"`
+}
+
+// eventBus 把事件分发给所有订阅者，从不阻塞发布者；缓冲区已满的订阅者会丢失事件
+type eventBus struct {
+	mu    sync.Mutex
+	subs  map[chan Event]struct{}
+	audit *auditLog // 不为 nil 时除进度以外的事件都追加到审计日志
+}
+
+// subscribe 注册一个订阅者，返回其通道和一个取消注册并关闭通道的函数
+func (b *eventBus) subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs == nil {
+		b.subs = make(map[chan Event]struct{})
+	}
+	ch := make(chan Event, eventBufferSize)
+	b.subs[ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subs, ch)
+			close(ch)
+		})
+	}
+}
+
+// publish 把事件发送给每个订阅者
+func (b *eventBus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if b.audit != nil && event.Type != EventProgress {
+		b.audit.record(event)
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
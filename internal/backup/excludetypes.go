@@ -0,0 +1,45 @@
+package backup
+
+import (
+	"sort"
+	"strings"
+)
+
+// excludeTypes 常见文件类型分组对应的排除规则，供 ExcludeTypes 选项引用
+// 扩展名规则会同时匹配全大写的扩展名（如 *.MP4）
+var excludeTypes = map[string][]string{
+	"video":   {"*.mp4", "*.mkv", "*.avi", "*.mov", "*.wmv", "*.flv", "*.webm", "*.m4v", "*.mpg", "*.mpeg", "*.ts"},
+	"audio":   {"*.mp3", "*.flac", "*.wav", "*.aac", "*.ogg", "*.m4a", "*.wma", "*.opus"},
+	"archive": {"*.zip", "*.tar", "*.gz", "*.tgz", "*.bz2", "*.xz", "*.7z", "*.rar", "*.iso", "*.dmg"},
+	"temp":    {"*.tmp", "*.temp", "*.swp", "*~", "*.part", "*.crdownload", "*.download"},
+	"cache":   {"__pycache__", "*.pyc", "*.pyo", "*.cache", "Thumbs.db", "desktop.ini"},
+	"deps":    {"node_modules", "bower_components", "__pypackages__"},
+}
+
+// ExcludeTypeNames 返回内置的排除类型组的名称，按名称排序
+func ExcludeTypeNames() []string {
+	names := make([]string, 0, len(excludeTypes))
+	for name := range excludeTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandExcludeTypes 将类型分组展开为排除规则，返回第一个未知的分组名
+func expandExcludeTypes(types []string) ([]string, string) {
+	var patterns []string
+	for _, name := range types {
+		group, ok := excludeTypes[name]
+		if !ok {
+			return nil, name
+		}
+		for _, pattern := range group {
+			patterns = append(patterns, pattern)
+			if strings.HasPrefix(pattern, "*.") && strings.ToUpper(pattern) != pattern {
+				patterns = append(patterns, strings.ToUpper(pattern))
+			}
+		}
+	}
+	return patterns, ""
+}
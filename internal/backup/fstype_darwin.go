@@ -0,0 +1,29 @@
+package backup
+
+import (
+	"syscall"
+	"time"
+)
+
+// detectMtimePrecision 根据目标所在的文件系统类型返回修改时间的精度
+// FAT 系列文件系统只能保存 2 秒精度的修改时间，其他文件系统按 1 秒处理
+func detectMtimePrecision(path string) (string, time.Duration) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", time.Second
+	}
+
+	name := make([]byte, 0, len(st.Fstypename))
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+
+	switch fsType := string(name); fsType {
+	case "msdos", "exfat":
+		return fsType, 2 * time.Second
+	}
+	return "", time.Second
+}
@@ -0,0 +1,29 @@
+package backup
+
+import (
+	"syscall"
+	"time"
+)
+
+// 常见文件系统的 statfs 魔数
+const (
+	msdosSuperMagic = 0x4d44
+	exfatSuperMagic = 0x2011bab0
+)
+
+// detectMtimePrecision 根据目标所在的文件系统类型返回修改时间的精度
+// FAT 系列文件系统只能保存 2 秒精度的修改时间，其他文件系统按 1 秒处理
+func detectMtimePrecision(path string) (string, time.Duration) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", time.Second
+	}
+
+	switch int64(st.Type) {
+	case msdosSuperMagic:
+		return "vfat", 2 * time.Second
+	case exfatSuperMagic:
+		return "exfat", 2 * time.Second
+	}
+	return "", time.Second
+}
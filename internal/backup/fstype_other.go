@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package backup
+
+import "time"
+
+// detectMtimePrecision 在不支持检测的平台上统一按 1 秒精度处理
+func detectMtimePrecision(path string) (string, time.Duration) {
+	return "", time.Second
+}
@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 可以在运行时通过 SetGlobal 修改的全局设置
+const (
+	GlobalExclude       = "exclude"        // 所有任务额外排除的通配符，以逗号分隔
+	GlobalMaxConcurrent = "max-concurrent" // 同时进行的备份数上限，0 表示不限制
+	GlobalLimit         = "global-limit"   // 所有任务合计写入目标的速度上限（字节/秒），0 表示不限速
+	GlobalJitter        = "jitter"         // 启动定时器时随机推迟的最长时间
+)
+
+// GlobalKeys 返回 SetGlobal 接受的设置名
+func GlobalKeys() []string {
+	return []string{GlobalExclude, GlobalMaxConcurrent, GlobalLimit, GlobalJitter}
+}
+
+// GlobalSetting 守护进程全局设置的当前值
+type GlobalSetting struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Default string `json:"default"`       // 守护进程启动参数指定的值
+	Set     bool   `json:"set,omitempty"` // 是否已通过 SetGlobal 修改并保存在配置文件中
+}
+
+// setGlobal 解析设置的值并写入 opts，返回规范化后的值
+func setGlobal(opts *ManagerOptions, key, value string) (string, error) {
+	switch key {
+	case GlobalExclude:
+		var patterns []string
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern == "" {
+				continue
+			}
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return "", fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+			}
+			patterns = append(patterns, pattern)
+		}
+		opts.Exclude = patterns
+	case GlobalMaxConcurrent:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid %s %q: expected a number of backups, 0 for unlimited", key, value)
+		}
+		opts.MaxConcurrent = n
+	case GlobalLimit:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid %s %q: expected bytes per second, 0 for unlimited", key, value)
+		}
+		opts.GlobalLimit = n
+	case GlobalJitter:
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return "", fmt.Errorf("invalid %s %q: expected a duration such as 5m", key, value)
+		}
+		opts.Jitter = d
+	default:
+		return "", fmt.Errorf("unknown global setting %q, supported settings: %s", key, strings.Join(GlobalKeys(), ", "))
+	}
+	return formatGlobal(*opts, key), nil
+}
+
+// formatGlobal 返回 opts 中一项设置的值
+func formatGlobal(opts ManagerOptions, key string) string {
+	switch key {
+	case GlobalExclude:
+		return strings.Join(opts.Exclude, ",")
+	case GlobalMaxConcurrent:
+		return strconv.Itoa(opts.MaxConcurrent)
+	case GlobalLimit:
+		return strconv.FormatInt(opts.GlobalLimit, 10)
+	case GlobalJitter:
+		return opts.Jitter.String()
+	}
+	return ""
+}
+
+// applyGlobals 在启动参数的基础上应用保存在配置文件中的设置，并使限速器和备份名额立即生效
+// 无效的设置被忽略并输出警告
+func (m *Manager) applyGlobals() {
+	opts := m.startOpts
+	for key, value := range m.globals {
+		if _, err := setGlobal(&opts, key, value); err != nil {
+			log.Printf("Warning: ignoring global setting %s from the config file: %v", key, err)
+			delete(m.globals, key)
+		}
+	}
+	m.opts = opts
+	m.limiter.SetRate(opts.GlobalLimit)
+	m.queue.resize(opts.MaxConcurrent)
+}
+
+// SetGlobal 在运行时修改守护进程的全局设置并保存到配置文件，此后它会覆盖守护进程的启动参数
+// 设置对之后开始的备份生效；新的并发上限或全局限速同时立即作用于正在进行和排队的备份
+// 值为空时恢复为启动时的值
+func (m *Manager) SetGlobal(key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.Contains(GlobalKeys(), key) {
+		return fmt.Errorf("unknown global setting %q, supported settings: %s", key, strings.Join(GlobalKeys(), ", "))
+	}
+	var normalized string
+	if value != "" {
+		check := m.startOpts
+		var err error
+		if normalized, err = setGlobal(&check, key, value); err != nil {
+			return err
+		}
+	}
+	previous, had := m.globals[key]
+	if value == "" {
+		delete(m.globals, key)
+		log.Printf("Global setting %s reverted to %q", key, formatGlobal(m.startOpts, key))
+	} else {
+		m.globals[key] = normalized
+		log.Printf("Global setting %s set to %q", key, normalized)
+	}
+	m.applyGlobals()
+
+	if err := m.saveTasks(); err != nil {
+		if had {
+			m.globals[key] = previous
+		} else {
+			delete(m.globals, key)
+		}
+		m.applyGlobals()
+		return fmt.Errorf("failed to save tasks: %v", err)
+	}
+	return nil
+}
+
+// Globals 返回每个全局设置的当前值
+func (m *Manager) Globals() []GlobalSetting {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var settings []GlobalSetting
+	for _, key := range GlobalKeys() {
+		_, set := m.globals[key]
+		settings = append(settings, GlobalSetting{
+			Key:     key,
+			Value:   formatGlobal(m.opts, key),
+			Default: formatGlobal(m.startOpts, key),
+			Set:     set,
+		})
+	}
+	return settings
+}
+
+// globalExclude 返回所有任务额外排除的通配符
+func (m *Manager) globalExclude() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.opts.Exclude)
+}
@@ -0,0 +1,63 @@
+package backup
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxNameLen 路径中单个组成部分的最大字节数（NAME_MAX），常见文件系统均为 255
+const maxNameLen = 255
+
+// pathTooLong 返回路径无法在目标中创建的原因：整个路径或其中某一级名称超过了系统限制
+// 文件按复制时先写入的临时文件的后缀检查
+func pathTooLong(path string, isDir bool) error {
+	if !isDir {
+		path += tmpSuffix
+	}
+	if len(path) > maxPathLen {
+		return fmt.Errorf("path is %d bytes long, the limit is %d", len(path), maxPathLen)
+	}
+	for _, name := range strings.Split(path, string(filepath.Separator)) {
+		if len(name) > maxNameLen {
+			if len(name) > 40 {
+				name = name[:37] + "..."
+			}
+			return fmt.Errorf("name %s is longer than %d bytes", name, maxNameLen)
+		}
+	}
+	return nil
+}
+
+// skipLongPaths 返回去掉了在目标中的路径过长、无法创建的条目之后的源条目，使它们被跳过，而不是在备份中途复制失败
+// 只记录并返回最外层被跳过的条目，被跳过的目录中的所有内容随之去掉
+// 不修改 files，它可能由多个目标共用
+func skipLongPaths(files map[string]*FileInfo, sourcePath, targetPath string) (map[string]*FileInfo, []string) {
+	var long []string
+	for relPath, file := range files {
+		if pathTooLong(filepath.Join(targetPath, relPath), file.IsDir) != nil {
+			long = append(long, relPath)
+		}
+	}
+	if len(long) == 0 {
+		return files, nil
+	}
+	sort.Strings(long)
+
+	kept := maps.Clone(files)
+	var skipped []string
+	for _, relPath := range long {
+		if !underAny(relPath, skipped) {
+			// 深层目录中通常有大量同样过长的路径，只报告最外层的一个
+			err := pathTooLong(filepath.Join(targetPath, relPath), files[relPath].IsDir)
+			log.Printf("Skipping %s: its path in the target is too long: %v",
+				filepath.Join(sourcePath, relPath), err)
+			skipped = append(skipped, relPath)
+		}
+		delete(kept, relPath)
+	}
+	return kept, skipped
+}
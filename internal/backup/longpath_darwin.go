@@ -0,0 +1,4 @@
+package backup
+
+// maxPathLen macOS 上系统调用接受的路径的最大字节数（PATH_MAX 为 1024，包含结尾的 NUL）
+const maxPathLen = 1023
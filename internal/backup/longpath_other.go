@@ -0,0 +1,6 @@
+//go:build !darwin
+
+package backup
+
+// maxPathLen 系统调用接受的路径的最大字节数（Linux 的 PATH_MAX 为 4096，包含结尾的 NUL）
+const maxPathLen = 4095
@@ -1,25 +1,76 @@
 package backup
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+// ManagerOptions holds daemon-wide settings that apply to every task
+type ManagerOptions struct {
+	// Jitter 启动定时器时随机推迟的最长时间（不超过任务的间隔），
+	// 使相同间隔的任务错开执行；为 0 时不推迟
+	Jitter time.Duration
+	// GlobalLimit 所有任务合计写入目标的速度上限（字节/秒），与任务自己的限速同时生效；为 0 时不限速
+	GlobalLimit int64
+	// AuditLog 以 JSON 行追加记录任务事件的审计日志路径，为空时不记录
+	AuditLog string
+	// MaxConcurrent 同时进行的备份数上限，超出的备份按任务的优先级排队；为 0 时不限制
+	MaxConcurrent int
+	// Exclude 所有任务在各自的排除规则之外额外排除的通配符
+	Exclude []string
+	// OnProgress 不为 nil 时，备份的阶段、文件、百分比或删除进度每次更新后以该任务的进度快照调用，
+	// 只有字节数变化时最多每 500 毫秒调用一次；多个任务同时备份时会被并发调用
+	OnProgress func(status *TransferStatus)
+}
+
+// backupTimer is a task's periodic backup timer. done is closed when the
+// timer is stopped, since a stopped timer never fires and would otherwise
+// leave its runTimer goroutine waiting forever.
+type backupTimer struct {
+	*time.Timer
+	done chan struct{}
+}
+
 // Manager manages backup tasks
 type Manager struct {
 	configFile string
+	opts       ManagerOptions
 	tasks      map[string]*BackupTask
-	timers     map[string]*time.Timer
+	timers     map[string]*backupTimer
+	boosts     map[string]*time.Timer    // 临时加速到期后恢复原间隔的定时器
+	snoozes    map[string]*time.Timer    // 暂停到期后恢复任务的定时器
+	redirects  map[string]*time.Timer    // 临时目标到期后恢复原目标的定时器
+	scrubs     map[string]*time.Timer    // 定期校验目标的定时器，随备份定时器启动和停止
+	nextRuns   map[string]time.Time      // 各任务下次备份的时间
+	firstRuns  map[string]time.Time      // 定时器启动后尚未开始的首次备份的时间
+	blocked    map[string]string         // 因依赖的任务尚未成功备份而跳过的任务 -> 该依赖，依赖备份成功后立即备份
+	transfers  map[string]*transferState // 正在进行的备份的字节进度
+	events     eventBus                  // 推送给订阅者的任务事件
+	debug      map[string]bool           // 临时开启了详细日志的任务，不保存到配置文件
+	limiter    *SharedLimiter            // 所有任务共享的限速器
+	queue      *backupQueue              // 同时进行的备份数的名额
+	startOpts  ManagerOptions            // 守护进程启动时指定的选项，opts 为应用 globals 之后实际使用的选项
+	globals    map[string]string         // 通过 SetGlobal 修改并保存在配置文件中的全局设置
+	saveErr    error                     // 配置文件无法写入时的错误，此时任务状态只保存在内存中
+	saveRetry  *time.Timer               // 配置文件无法写入时定期重试保存的定时器
 	mu         sync.RWMutex
 }
 
 // NewManager creates a new backup manager
-func NewManager(configFile string) (*Manager, error) {
+func NewManager(configFile string, opts ManagerOptions) (*Manager, error) {
 	// Create config directory if it doesn't exist
 	configDir := filepath.Dir(configFile)
 	if err := os.MkdirAll(configDir, 0755); err != nil {
@@ -28,37 +79,84 @@ func NewManager(configFile string) (*Manager, error) {
 
 	manager := &Manager{
 		configFile: configFile,
+		startOpts:  opts,
+		opts:       opts,
+		globals:    make(map[string]string),
 		tasks:      make(map[string]*BackupTask),
-		timers:     make(map[string]*time.Timer),
+		timers:     make(map[string]*backupTimer),
+		boosts:     make(map[string]*time.Timer),
+		snoozes:    make(map[string]*time.Timer),
+		redirects:  make(map[string]*time.Timer),
+		scrubs:     make(map[string]*time.Timer),
+		nextRuns:   make(map[string]time.Time),
+		firstRuns:  make(map[string]time.Time),
+		blocked:    make(map[string]string),
+		transfers:  make(map[string]*transferState),
+		debug:      make(map[string]bool),
+		limiter:    &SharedLimiter{},
+		queue:      newBackupQueue(0),
+	}
+	manager.applyGlobals()
+	if opts.AuditLog != "" {
+		audit, err := openAuditLog(opts.AuditLog)
+		if err != nil {
+			return nil, err
+		}
+		manager.events.audit = audit
 	}
 
 	// Load existing tasks
-	if err := manager.loadTasks(); err != nil {
+	if err := manager.loadTasks(nil); err != nil {
 		log.Printf("Warning: failed to load tasks: %v", err)
 	}
 
 	return manager, nil
 }
 
-// AddTask adds a new backup task
-func (m *Manager) AddTask(task BackupTask) error {
+// AddTask adds a new backup task. A task that syncs the same source to the
+// same target as another task is rejected unless force is set, in which
+// case only a warning is logged.
+func (m *Manager) AddTask(task BackupTask, replace, force bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	log.Printf("Adding task to manager: %+v", task)
 
-	// 重新加载任务列表，确保数据是最新的
-	if err := m.loadTasks(); err != nil {
-		log.Printf("Warning: failed to reload tasks: %v", err)
+	if err := checkTaskName(task.Name); err != nil {
+		return err
 	}
+	// 运行状态只由守护进程记录，客户端只能设置任务的选项
+	task.clearState()
 
 	// Check if task already exists
-	if _, exists := m.tasks[task.Name]; exists {
+	existing, exists := m.tasks[task.Name]
+	if exists && !replace {
 		return fmt.Errorf("task %s already exists", task.Name)
 	}
 
+	if err := m.checkDuplicate(&task, force); err != nil {
+		return err
+	}
+	if err := m.checkDependencies(&task); err != nil {
+		return err
+	}
+
+	// Validate task options
+	if _, err := task.syncOptions(); err != nil {
+		return err
+	}
+	for _, target := range task.targets() {
+		if err := checkTarget(target); err != nil {
+			return err
+		}
+	}
+
+	if exists {
+		return m.replaceTask(existing, task)
+	}
+
 	// Initialize task status
-	task.Status = "Ready"
+	task.Status = StatusReady
 	task.Progress = 100 // 初始状态为 Ready 时，进度应该是 100%
 	task.LastBackup = time.Time{}
 
@@ -74,13 +172,169 @@ func (m *Manager) AddTask(task BackupTask) error {
 
 	log.Printf("Saving tasks to file")
 	// Save tasks to file
-	if err := m.saveTasks(); err != nil {
-		delete(m.tasks, task.Name)
-		m.stopBackupTimer(task.Name)
-		return fmt.Errorf("failed to save tasks: %v", err)
-	}
+	m.persist()
 
 	log.Printf("Task added successfully: %s", task.Name)
+	m.events.publish(Event{Type: EventAdded, Task: task.Name, Status: task.Status})
+	return nil
+}
+
+// checkDuplicate 检查其他任务是否已将同一源目录同步到同一目标，同名任务（被替换的任务）除外
+// force 时只输出警告
+func (m *Manager) checkDuplicate(task *BackupTask, force bool) error {
+	for name, other := range m.tasks {
+		if name == task.Name {
+			continue
+		}
+		target, ok := sameSyncPair(task, other)
+		if !ok {
+			continue
+		}
+		if !force {
+			return fmt.Errorf("task %s already backs up %s to %s; two tasks writing the same target interfere with each other, use -force to add it anyway",
+				name, task.syncSource(), target)
+		}
+		log.Printf("Warning: task %s backs up %s to %s like task %s", task.Name, task.syncSource(), target, name)
+	}
+	return nil
+}
+
+// checkDependencies checks a new or replacing task's dependencies against
+// the existing tasks, rejecting unknown dependencies and cycles
+func (m *Manager) checkDependencies(tasks ...*BackupTask) error {
+	all := maps.Clone(m.tasks)
+	for _, task := range tasks {
+		all[task.Name] = task
+	}
+	for _, task := range tasks {
+		if err := dependencyError(all, task.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTasks adds several new backup tasks at once: either all of them are
+// added and saved with a single write of the config file, or none are.
+// Duplicate source and target pairs are handled as in AddTask.
+func (m *Manager) AddTasks(tasks []BackupTask, force bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	log.Printf("Adding %d tasks to manager", len(tasks))
+
+	// 先校验所有任务，任何一个有误都不添加
+	names := make(map[string]bool, len(tasks))
+	for i, task := range tasks {
+		if err := checkTaskName(task.Name); err != nil {
+			return err
+		}
+		tasks[i].clearState()
+		if _, exists := m.tasks[task.Name]; exists {
+			return fmt.Errorf("task %s already exists", task.Name)
+		}
+		if names[task.Name] {
+			return fmt.Errorf("task %s appears more than once", task.Name)
+		}
+		names[task.Name] = true
+		if err := m.checkDuplicate(&tasks[i], force); err != nil {
+			return fmt.Errorf("task %s: %v", task.Name, err)
+		}
+		for _, other := range tasks[:i] {
+			if target, ok := sameSyncPair(&tasks[i], &other); ok && !force {
+				return fmt.Errorf("tasks %s and %s both back up %s to %s", other.Name, task.Name, task.syncSource(), target)
+			}
+		}
+		if _, err := task.syncOptions(); err != nil {
+			return fmt.Errorf("task %s: %v", task.Name, err)
+		}
+		for _, target := range task.targets() {
+			if err := checkTarget(target); err != nil {
+				return fmt.Errorf("task %s: %v", task.Name, err)
+			}
+		}
+		if _, err := parseSchedule(task.Schedule); err != nil {
+			return fmt.Errorf("task %s: %v", task.Name, err)
+		}
+	}
+	// 新任务之间也可以相互依赖
+	added := make([]*BackupTask, len(tasks))
+	for i := range tasks {
+		added[i] = &tasks[i]
+	}
+	if err := m.checkDependencies(added...); err != nil {
+		return err
+	}
+
+	for i := range tasks {
+		task := tasks[i]
+		task.Status = StatusReady
+		task.Progress = 100
+		task.LastBackup = time.Time{}
+		m.tasks[task.Name] = &task
+	}
+
+	m.persist()
+
+	for _, task := range tasks {
+		if err := m.startBackupTimer(task.Name); err != nil {
+			// 间隔已经校验过，不应发生
+			log.Printf("[Task: %s] Failed to start backup timer: %v", task.Name, err)
+		}
+		m.events.publish(Event{Type: EventAdded, Task: task.Name, Status: StatusReady})
+	}
+	log.Printf("Added %d tasks", len(tasks))
+	return nil
+}
+
+// replaceTask updates an existing task's settings in place. The task keeps
+// its history and a stopped or snoozed state; otherwise its timer is
+// restarted with the new schedule. Must be called with m.mu held.
+func (m *Manager) replaceTask(old *BackupTask, task BackupTask) error {
+	// 正在备份的任务不能替换
+	if _, running := m.transfers[task.Name]; running {
+		return fmt.Errorf("cannot replace task %s: %s", task.Name, m.describeRun(task.Name))
+	}
+	if _, err := parseSchedule(task.Schedule); err != nil {
+		return err
+	}
+
+	m.stopBackupTimer(task.Name)
+	m.cancelBoost(task.Name)
+	m.cancelRedirect(task.Name)
+
+	// 目标或选项可能已经改变，丢弃旧的哈希缓存
+	if err := m.removeCaches(old); err != nil {
+		log.Printf("[Task: %s] Failed to remove hash cache: %v", task.Name, err)
+	}
+
+	task.History = old.History
+	task.TotalBytesTransferred = old.TotalBytesTransferred
+	task.Progress = 100
+	// 目标改变后视为尚未备份过，使 no_delete_first_run 对新目标生效
+	if task.targets()[0] == old.targets()[0] {
+		task.LastBackup = old.LastBackup
+	}
+	m.tasks[task.Name] = &task
+
+	switch {
+	case old.Status == StatusStopped:
+		task.Status = StatusStopped
+	case old.SnoozeUntil.After(time.Now()):
+		// 暂停到期后由 endSnooze 按新的间隔启动定时器
+		task.Status = StatusPaused
+		task.SnoozeUntil = old.SnoozeUntil
+	default:
+		task.Status = StatusReady
+		if err := m.startBackupTimer(task.Name); err != nil {
+			task.Status = StatusError
+			task.Error = err.Error()
+		}
+	}
+	log.Printf("[Task: %s] Task replaced", task.Name)
+	m.events.publish(Event{Type: EventUpdated, Task: task.Name, Status: task.Status})
+
+	m.persist()
 	return nil
 }
 
@@ -96,34 +350,301 @@ func (m *Manager) ListTasks() []BackupTask {
 
 	// log.Printf("Listing %d tasks", len(m.tasks))
 	tasks := make([]BackupTask, 0, len(m.tasks))
-	for _, task := range m.tasks {
-		tasks = append(tasks, *task)
+	for name, task := range m.tasks {
+		taskCopy := *task
+		taskCopy.Progress = m.taskProgress(name)
+		taskCopy.RetryAttempt = task.retryAttempt()
+		tasks = append(tasks, taskCopy)
 	}
 	return tasks
 }
 
-// DeleteTask deletes a backup task
-func (m *Manager) DeleteTask(name string) error {
+// PauseRun pauses the copying of a task's running backup without discarding
+// its progress. The backup resumes from where it stopped when ResumeRun is
+// called or, if d is greater than 0, once d has elapsed.
+func (m *Manager) PauseRun(name string, d time.Duration) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transfer, err := m.runningBackup(name)
+	if err != nil {
+		return err
+	}
+	if !transfer.pause.pause(d, func() {
+		log.Printf("[Task: %s] Pause expired, resuming backup", name)
+	}) {
+		return fmt.Errorf("backup of task %s is already paused", name)
+	}
+
+	if d > 0 {
+		log.Printf("[Task: %s] Backup paused for %s", name, d)
+	} else {
+		log.Printf("[Task: %s] Backup paused", name)
+	}
+	return nil
+}
+
+// ResumeRun resumes the copying of a backup paused by PauseRun
+func (m *Manager) ResumeRun(name string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transfer, err := m.runningBackup(name)
+	if err != nil {
+		return err
+	}
+	since := transfer.pause.pausedSince()
+	if !transfer.pause.resume() {
+		return fmt.Errorf("backup of task %s is not paused", name)
+	}
+	log.Printf("[Task: %s] Backup resumed after %s", name, time.Since(since).Round(time.Second))
+	return nil
+}
+
+// RunPaused reports whether the running backup of a task is paused
+func (m *Manager) RunPaused(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transfer, running := m.transfers[name]
+	return running && !transfer.pause.pausedSince().IsZero()
+}
+
+// runningBackup returns the state of a task's running backup.
+// Must be called with m.mu held.
+func (m *Manager) runningBackup(name string) (*transferState, error) {
+	if _, exists := m.tasks[name]; !exists {
+		return nil, fmt.Errorf("task %s does not exist", name)
+	}
+	transfer, running := m.transfers[name]
+	if !running || transfer.scrub {
+		return nil, fmt.Errorf("task %s has no backup running", name)
+	}
+	return transfer, nil
+}
+
+// QueuePosition returns a task's position among the backups waiting for a
+// slot, starting at 1, and the number of waiting backups. The position is 0
+// when the task is not waiting or concurrency is unlimited.
+func (m *Manager) QueuePosition(name string) (int, int) {
+	return m.queue.position(name)
+}
+
+// GetTask returns the full detail of a single backup task
+func (m *Manager) GetTask(name string) (*TaskDetail, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	task, exists := m.tasks[name]
+	if !exists {
+		return nil, fmt.Errorf("task %s does not exist", name)
+	}
+
+	detail := &TaskDetail{
+		BackupTask: *task,
+		NextBackup: m.nextRuns[name],
+		Debug:      m.debug[name],
+		BlockedBy:  m.blocked[name],
+	}
+	detail.FirstBackup = m.firstRuns[name]
+	detail.RetryAttempt = task.retryAttempt()
+	detail.Progress = m.taskProgress(name)
+	detail.QueuePosition, detail.QueueLength = m.QueuePosition(name)
+	if m.saveErr != nil {
+		detail.SaveError = m.saveErr.Error()
+	}
+	if transfer, running := m.transfers[name]; running && !transfer.scrub {
+		detail.Running = true
+		detail.RunStartedAt = transfer.startedAt
+	}
+	return detail, nil
+}
+
+// History returns a task's run records, newest first, limited to runs
+// started within the given window (0 for no limit) and optionally to failures
+func (m *Manager) History(name string, since time.Duration, failedOnly bool) ([]RunRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	task, exists := m.tasks[name]
+	if !exists {
+		return nil, fmt.Errorf("task %s does not exist", name)
+	}
+
+	var cutoff time.Time
+	if since > 0 {
+		cutoff = time.Now().Add(-since)
+	}
+
+	runs := make([]RunRecord, 0, len(task.History))
+	for i := len(task.History) - 1; i >= 0; i-- {
+		run := task.History[i]
+		if run.StartedAt.Before(cutoff) {
+			continue
+		}
+		if failedOnly && run.Success {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// Subscribe registers for task events. Events are delivered on the returned
+// channel until the returned function is called; a subscriber that falls
+// behind misses events rather than blocking backups.
+func (m *Manager) Subscribe() (<-chan Event, func()) {
+	return m.events.subscribe()
+}
+
+// Usage returns the disk space used by each task's targets, sorted by task
+// name. The targets are walked without holding the lock.
+func (m *Manager) Usage() []TaskUsage {
+	m.mu.RLock()
+	usages := make([]TaskUsage, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		usage := TaskUsage{Name: task.Name}
+		for _, target := range task.targets() {
+			usage.Targets = append(usage.Targets, TargetUsage{Path: target})
+		}
+		usages = append(usages, usage)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Name < usages[j].Name })
+	for i := range usages {
+		for j, target := range usages[i].Targets {
+			usages[i].Targets[j] = targetUsage(target.Path)
+			usages[i].Files += usages[i].Targets[j].Files
+			usages[i].Bytes += usages[i].Targets[j].Bytes
+		}
+	}
+	return usages
+}
+
+// Plan returns the files the next backup of a task would copy, overwrite and
+// delete in each of its targets, computed by a dry run that leaves the
+// targets and caches untouched
+func (m *Manager) Plan(name string) ([]PlanEntry, error) {
+	m.mu.RLock()
+	task, exists := m.tasks[name]
+	if !exists {
+		m.mu.RUnlock()
+		return nil, fmt.Errorf("task %s does not exist", name)
+	}
+	taskCopy := *task
+	m.mu.RUnlock()
+
+	return m.plan(&taskCopy, !taskCopy.RehashTarget)
+}
+
+// PreviewTask returns the files the first backup of a task that has not been
+// added yet would copy, overwrite and delete, so that a client can warn
+// before a task wipes an existing target
+func (m *Manager) PreviewTask(task BackupTask) ([]PlanEntry, error) {
+	// 新任务没有缓存，替换已有任务时缓存会被丢弃
+	return m.plan(&task, false)
+}
+
+// plan computes a task's plan by a dry run, optionally reusing the target
+// hash caches. The task must not be shared with the manager.
+func (m *Manager) plan(task *BackupTask, useCache bool) ([]PlanEntry, error) {
+	opts, err := task.syncOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.Exclude = slices.Concat(opts.Exclude, m.globalExclude())
+	if err := checkSource(task.syncSource(), task.AllowEmptySource); err != nil {
+		return nil, err
+	}
+
+	opts.DryRun = true
+	targets := task.targets()
+	stats, errs := runSafely(context.Background(), opts, targets, func(i int, opts *SyncOptions) error {
+		if useCache {
+			opts.TargetCacheFile = m.targetCacheFile(task.Name, i, targets[i])
+		}
+		return nil
+	})
+	for i, err := range errs {
+		if err != nil {
+			if len(targets) > 1 {
+				return nil, fmt.Errorf("target %s: %v", targets[i], err)
+			}
+			return nil, err
+		}
+	}
+	if stats.Plan == nil {
+		stats.Plan = []PlanEntry{}
+	}
+	return stats.Plan, nil
+}
+
+// TransferStatus returns the current progress of a task, including the
+// transfer rate and estimated time remaining while a backup is running
+func (m *Manager) TransferStatus(name string) (*TransferStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	task, exists := m.tasks[name]
+	if !exists {
+		return nil, fmt.Errorf("task %s does not exist", name)
+	}
+
+	status := &TransferStatus{
+		Name:     task.Name,
+		Status:   task.Status,
+		Progress: m.taskProgress(name),
+		ETA:      -1,
+	}
+	if transfer, running := m.transfers[name]; running {
+		status.BytesDone, status.BytesTotal, status.Rate, status.ETA = transfer.snapshot()
+		status.StartedAt = transfer.startedAt
+		status.Paused = !transfer.pause.pausedSince().IsZero()
+		transfer.fillActivity(status)
+	}
+	return status, nil
+}
+
+// DeleteTask deletes a backup task and returns it as it was before deletion
+func (m *Manager) DeleteTask(name string) (*BackupTask, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Check if task exists
 	if _, exists := m.tasks[name]; !exists {
-		return fmt.Errorf("task %s does not exist", name)
+		return nil, fmt.Errorf("task %s does not exist", name)
+	}
+
+	// 正在备份的任务不能删除
+	if _, running := m.transfers[name]; running {
+		return nil, fmt.Errorf("cannot delete task %s: %s", name, m.describeRun(name))
+	}
+	// 其他任务依赖的任务不能删除，否则它们再也不会备份
+	if dependents := m.dependents(name); len(dependents) > 0 {
+		return nil, fmt.Errorf("cannot delete task %s: tasks %s depend on it", name, strings.Join(dependents, ", "))
 	}
 
 	// Stop backup timer
 	m.stopBackupTimer(name)
+	m.cancelBoost(name)
+	m.cancelSnooze(name)
+	m.cancelRedirect(name)
 
 	// Delete task
+	task := m.tasks[name]
 	delete(m.tasks, name)
+	delete(m.debug, name)
+	delete(m.blocked, name)
+	m.events.publish(Event{Type: EventDeleted, Task: name})
+	if err := m.removeCaches(task); err != nil {
+		log.Printf("[Task: %s] Failed to remove hash cache: %v", name, err)
+	}
 
 	// Save tasks to file
-	if err := m.saveTasks(); err != nil {
-		return fmt.Errorf("failed to save tasks: %v", err)
-	}
+	m.persist()
 
-	return nil
+	return task, nil
 }
 
 // StopTask stops a backup task
@@ -139,226 +660,1628 @@ func (m *Manager) StopTask(name string) error {
 
 	// Stop backup timer
 	m.stopBackupTimer(name)
+	m.cancelBoost(name)
+	m.cancelSnooze(name)
+
+	// 正在进行的备份不会被取消，暂停的复制需要恢复才能结束
+	if transfer, running := m.transfers[name]; running && transfer.pause.resume() {
+		log.Printf("[Task: %s] Resuming paused backup so that it can finish", name)
+	}
 
 	// Update task status
-	task.Status = "Stopped"
+	task.Status = StatusStopped
+	task.SnoozeUntil = time.Time{}
 	task.Progress = 0 // 停止时设置为 0
+	task.BoostSchedule = ""
+	task.BoostUntil = time.Time{}
+	m.events.publish(Event{Type: EventStopped, Task: name, Status: task.Status})
 
 	// Save tasks to file
-	if err := m.saveTasks(); err != nil {
-		return fmt.Errorf("failed to save tasks: %v", err)
-	}
+	m.persist()
 
 	return nil
 }
 
-// Shutdown stops all backup timers
-func (m *Manager) Shutdown() {
+// RescanTask discards a task's target hash cache so the next backup rehashes
+// every target file. With now set the backup is started immediately.
+func (m *Manager) RescanTask(name string, now bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for name := range m.timers {
-		m.stopBackupTimer(name)
+	// Check if task exists
+	if _, exists := m.tasks[name]; !exists {
+		return fmt.Errorf("task %s does not exist", name)
 	}
-}
-
-// loadTasks loads tasks from the config file
-func (m *Manager) loadTasks() error {
-	// 添加日志
-	log.Printf("Loading tasks from file: %s", m.configFile)
 
-	data, err := os.ReadFile(m.configFile)
-	if os.IsNotExist(err) {
-		log.Printf("Config file does not exist, starting with empty task list")
-		return nil
-	}
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
+	// 正在进行的备份结束时会重新写入缓存
+	if _, running := m.transfers[name]; running {
+		return fmt.Errorf("cannot rescan task %s: %s", name, m.describeRun(name))
 	}
 
-	var tasks []BackupTask
-	if err := json.Unmarshal(data, &tasks); err != nil {
-		return fmt.Errorf("failed to parse config file: %v", err)
+	if err := m.removeCaches(m.tasks[name]); err != nil {
+		return fmt.Errorf("failed to remove hash cache: %v", err)
 	}
+	log.Printf("[Task: %s] Hash cache discarded, next backup will rescan the target", name)
 
-	// 清空现有任务
-	m.tasks = make(map[string]*BackupTask)
-
-	// 添加日志
-	log.Printf("Found %d tasks in config file", len(tasks))
-
-	for _, task := range tasks {
-		taskCopy := task
-		m.tasks[task.Name] = &taskCopy
-		if task.Status != "Stopped" {
-			if err := m.startBackupTimer(task.Name); err != nil {
-				log.Printf("Warning: failed to start timer for task %s: %v", task.Name, err)
-			}
-		}
+	if now {
+		m.startBackup(name)
 	}
 
 	return nil
 }
 
-// saveTasks saves tasks to the config file
-func (m *Manager) saveTasks() error {
-	tasks := make([]BackupTask, 0, len(m.tasks))
-	for _, task := range m.tasks {
-		tasks = append(tasks, *task)
-	}
+// FullBackup makes the next backup of a task copy every source file, even
+// those that appear identical in the target, then resume incremental
+// backups. If now is true the backup starts right away.
+func (m *Manager) FullBackup(name string, now bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	log.Printf("Saving %d tasks to file: %s", len(tasks), m.configFile)
-	data, err := json.MarshalIndent(tasks, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal tasks: %v", err)
+	task, exists := m.tasks[name]
+	if !exists {
+		return fmt.Errorf("task %s does not exist", name)
 	}
 
-	// 确保配置目录存在
-	configDir := filepath.Dir(m.configFile)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %v", err)
+	// 正在进行的备份成功后会清除标记，不能让它代替完整备份
+	if _, running := m.transfers[name]; running {
+		return fmt.Errorf("cannot force a full backup of task %s: %s", name, m.describeRun(name))
 	}
 
-	// 添加文件权限检查
-	if err := os.WriteFile(m.configFile, data, 0644); err != nil {
-		log.Printf("Failed to write config file: %v", err)
-		// 尝试检查文件权限
-		if info, statErr := os.Stat(configDir); statErr == nil {
-			log.Printf("Config directory permissions: %v", info.Mode())
-		}
-		return fmt.Errorf("failed to write config file: %v", err)
+	task.ForceFull = true
+	m.persist()
+	log.Printf("[Task: %s] Next backup will copy all files", name)
+
+	if now {
+		m.startBackup(name)
 	}
 
-	log.Printf("Successfully saved tasks to file")
 	return nil
 }
 
-// startBackupTimer starts a timer for periodic backup
-func (m *Manager) startBackupTimer(name string) error {
-	task := m.tasks[name]
-	interval, err := time.ParseDuration(task.Schedule + "m")
-	if err != nil {
-		return fmt.Errorf("invalid schedule: %v", err)
-	}
-
-	// 打印定时器启动日志
-	log.Printf("[Task: %s] Starting backup timer with interval: %s",
-		task.Name, interval.String())
+// ScrubTask starts an integrity scrub of a task's targets right away,
+// independent of its scrub schedule. The scrub runs in the background.
+func (m *Manager) ScrubTask(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	timer := time.NewTimer(interval)
-	m.timers[name] = timer
+	task, exists := m.tasks[name]
+	if !exists {
+		return fmt.Errorf("task %s does not exist", name)
+	}
+	if _, running := m.transfers[name]; running {
+		return fmt.Errorf("cannot scrub task %s: %s", name, m.describeRun(name))
+	}
+	if task.RehashTarget {
+		return fmt.Errorf("cannot scrub task %s: it keeps no hash cache to verify against", name)
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[Task: %s] Scrub failed: %v", name, r)
+			}
+		}()
+		if err := m.performScrub(name); err != nil {
+			log.Printf("[Task: %s] Scrub failed: %v", name, err)
+		}
+	}()
+	return nil
+}
+
+// SetDebug turns verbose per-file logging on or off for a task. It takes
+// effect from the task's next backup and is not saved across daemon restarts.
+func (m *Manager) SetDebug(name string, on bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.tasks[name]; !exists {
+		return fmt.Errorf("task %s does not exist", name)
+	}
+
+	if on {
+		m.debug[name] = true
+		log.Printf("[Task: %s] Debug logging enabled", name)
+	} else {
+		delete(m.debug, name)
+		log.Printf("[Task: %s] Debug logging disabled", name)
+	}
+	return nil
+}
+
+// debugf returns a logger that writes a task's debug messages
+func debugf(name string) func(format string, args ...any) {
+	return func(format string, args ...any) {
+		log.Printf("[Task: %s] [debug] "+format, append([]any{name}, args...)...)
+	}
+}
+
+// SnoozeTask pauses an active task for the given duration,
+// after which its timer is restarted automatically
+func (m *Manager) SnoozeTask(name string, duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Check if task exists
+	task, exists := m.tasks[name]
+	if !exists {
+		return fmt.Errorf("task %s does not exist", name)
+	}
+
+	// 已暂停的任务可以重新设置暂停时长
+	if _, running := m.timers[name]; !running && task.SnoozeUntil.IsZero() {
+		return fmt.Errorf("task %s is not active", name)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("snooze duration must be greater than 0")
+	}
+
+	m.stopBackupTimer(name)
+	task.Status = StatusPaused
+	task.SnoozeUntil = time.Now().Add(duration)
+	m.armSnoozeExpiry(name, duration)
+	log.Printf("[Task: %s] Snoozed until %s", name, task.SnoozeUntil.Format("2006-01-02 15:04:05"))
+
+	// Save tasks to file
+	m.persist()
+
+	return nil
+}
+
+// BoostTask temporarily overrides a task's interval for the given duration,
+// after which the original schedule is restored automatically
+func (m *Manager) BoostTask(name, schedule string, duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Check if task exists
+	task, exists := m.tasks[name]
+	if !exists {
+		return fmt.Errorf("task %s does not exist", name)
+	}
+
+	timer, running := m.timers[name]
+	if !running {
+		return fmt.Errorf("task %s is not active", name)
+	}
+
+	interval, err := parseSchedule(schedule)
+	if err != nil {
+		return err
+	}
+	if duration <= 0 {
+		return fmt.Errorf("boost duration must be greater than 0")
+	}
+
+	task.BoostSchedule = schedule
+	task.BoostUntil = time.Now().Add(duration)
+	m.armBoostExpiry(name, duration)
+
+	// 立即按加速后的间隔重新计时
+	m.resetTimer(name, timer, interval)
+	log.Printf("[Task: %s] Interval boosted to %s until %s",
+		name, interval.String(), task.BoostUntil.Format("2006-01-02 15:04:05"))
+
+	// Save tasks to file
+	m.persist()
+
+	return nil
+}
+
+// SetTarget temporarily points a task's primary target at another path, e.g.
+// a fallback while the usual target is offline. The original target is
+// remembered and restored by RevertTarget, or automatically after
+// revertAfter if it is greater than 0. An active task is backed up to the
+// new target right away.
+func (m *Manager) SetTarget(name, path string, revertAfter time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, exists := m.tasks[name]
+	if !exists {
+		return fmt.Errorf("task %s does not exist", name)
+	}
+	if path == "" {
+		return fmt.Errorf("target path is required")
+	}
+	if revertAfter < 0 {
+		return fmt.Errorf("invalid revert duration: %s", revertAfter)
+	}
+	original := task.OriginalTarget
+	if original == "" {
+		original = task.TargetPath
+	}
+	if filepath.Clean(path) == filepath.Clean(original) {
+		return fmt.Errorf("%s is the original target of task %s, use revert instead", path, name)
+	}
+
+	// 新目标与任务的其他设置（如镜像目标）冲突时不修改
+	check := *task
+	check.TargetPath = path
+	if _, err := check.syncOptions(); err != nil {
+		return err
+	}
+	if err := checkTarget(path); err != nil {
+		return err
+	}
+
+	var until time.Time
+	if revertAfter > 0 {
+		until = time.Now().Add(revertAfter)
+	}
+	if err := m.redirectTarget(task, path, original, until); err != nil {
+		return err
+	}
+	if revertAfter > 0 {
+		m.armRedirectExpiry(name, revertAfter)
+		log.Printf("[Task: %s] Target redirected from %s to %s until %s",
+			name, original, path, until.Format("2006-01-02 15:04:05"))
+	} else {
+		log.Printf("[Task: %s] Target redirected from %s to %s", name, original, path)
+	}
+
+	m.persist()
+	return nil
+}
+
+// RevertTarget restores the target a task had before SetTarget
+func (m *Manager) RevertTarget(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, exists := m.tasks[name]
+	if !exists {
+		return fmt.Errorf("task %s does not exist", name)
+	}
+	if task.OriginalTarget == "" {
+		return fmt.Errorf("task %s is not redirected", name)
+	}
+
+	if err := m.redirectTarget(task, task.OriginalTarget, "", time.Time{}); err != nil {
+		return err
+	}
+	log.Printf("[Task: %s] Target reverted to %s", name, task.TargetPath)
+
+	m.persist()
+	return nil
+}
+
+// redirectTarget switches a task's primary target, discarding its hash
+// caches and source manifest since the new target has to be scanned afresh,
+// and starts a backup of an active task. original is empty when the original
+// target is restored. Must be called with m.mu held.
+func (m *Manager) redirectTarget(task *BackupTask, path, original string, until time.Time) error {
+	if _, running := m.transfers[task.Name]; running {
+		return fmt.Errorf("cannot change the target of task %s: %s", task.Name, m.describeRun(task.Name))
+	}
+
+	m.cancelRedirect(task.Name)
+	if err := m.removeCaches(task); err != nil {
+		log.Printf("[Task: %s] Failed to remove hash cache: %v", task.Name, err)
+	}
+	task.TargetPath = path
+	task.OriginalTarget = original
+	task.RedirectUntil = until
+
+	if _, active := m.timers[task.Name]; active {
+		m.startBackup(task.Name)
+	}
+	return nil
+}
+
+// Reload re-reads the config file, e.g. after it was edited by hand, and
+// restarts the timers of the reloaded tasks so that each keeps its next run
+// time; only tasks that had no timer back up right away. Tasks whose backup
+// is running keep their state and use the new options from the next backup
+// on. A config file that cannot be read leaves the current tasks untouched,
+// and reloading is refused while the task state cannot be saved, since the
+// file does not contain it.
+func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.saveErr != nil {
+		return fmt.Errorf("task state is kept in memory only because the config file cannot be saved (%v), reloading would discard it", m.saveErr)
+	}
+	file, _, err := readConfig(m.configFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// 手工编辑引入的循环依赖或不存在的依赖使相关任务永远无法备份，拒绝重新加载
+	if file != nil {
+		invalid := dependencyErrors(file.Tasks)
+		for _, task := range file.Tasks {
+			if err := invalid[task.Name]; err != nil {
+				return fmt.Errorf("task %s: %v", task.Name, err)
+			}
+		}
+	}
+
+	// 记录每个任务原定的下次备份时间，重新加载后沿用
+	next := make(map[string]time.Time, len(m.timers))
+	for name := range m.timers {
+		next[name] = m.nextRuns[name]
+		if first, pending := m.firstRuns[name]; pending {
+			next[name] = first
+		}
+		m.stopBackupTimer(name)
+	}
+	for name := range m.boosts {
+		m.cancelBoost(name)
+	}
+	for name := range m.snoozes {
+		m.cancelSnooze(name)
+	}
+	for name := range m.redirects {
+		m.cancelRedirect(name)
+	}
+	return m.loadTasks(next)
+}
+
+// RunAll triggers an immediate backup of every active task.
+// Tasks that are stopped or already running are skipped.
+func (m *Manager) RunAll() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for name, task := range m.tasks {
+		if _, active := m.timers[name]; !active || task.Status == StatusRunning {
+			continue
+		}
+
+		log.Printf("[Task: %s] On-demand backup triggered", name)
+		m.startBackup(name)
+	}
+}
+
+// LogStatus writes the current state of every task to the log
+func (m *Manager) LogStatus() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	log.Printf("Task status: %d tasks", len(m.tasks))
+	if m.saveErr != nil {
+		log.Printf("Warning: task state is kept in memory only, the config file cannot be saved: %v", m.saveErr)
+	}
+	for name, task := range m.tasks {
+		next := "-"
+		if t, ok := m.nextRuns[name]; ok {
+			next = t.Format("2006-01-02 15:04:05")
+		}
+		log.Printf("[Task: %s] status=%s progress=%.1f%% interval=%sm last_backup=%s next_backup=%s total_bytes=%d error=%q",
+			name, task.Status, m.taskProgress(name), task.Schedule,
+			task.LastBackup.Format("2006-01-02 15:04:05"), next, task.TotalBytesTransferred, task.Error)
+	}
+}
+
+// Shutdown stops all backup timers
+func (m *Manager) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name := range m.timers {
+		m.stopBackupTimer(name)
+	}
+	for name := range m.boosts {
+		m.cancelBoost(name)
+	}
+	for name := range m.snoozes {
+		m.cancelSnooze(name)
+	}
+	for name := range m.redirects {
+		m.cancelRedirect(name)
+	}
+	if m.saveRetry != nil {
+		m.saveRetry.Stop()
+		m.saveRetry = nil
+	}
+	// 最后尝试一次保存内存中的任务状态
+	if m.saveErr != nil {
+		if err := m.writeTasks(); err != nil {
+			log.Printf("Warning: task state changes since %v could not be saved and are lost", m.saveErr)
+		}
+	}
+}
+
+// loadTasks loads tasks from the config file
+func (m *Manager) loadTasks(next map[string]time.Time) error {
+	// 添加日志
+	log.Printf("Loading tasks from file: %s", m.configFile)
+
+	file, migration, err := readConfig(m.configFile)
+	if os.IsNotExist(err) {
+		log.Printf("Config file does not exist, starting with empty task list")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if migration == nil {
+		log.Printf("Config schema version: %d", SchemaVersion)
+	}
+
+	// 配置文件中保存的全局设置覆盖启动参数，在启动定时器之前生效
+	m.globals = make(map[string]string)
+	for key, value := range file.Globals {
+		m.globals[key] = value
+	}
+	m.applyGlobals()
+
+	// 清空现有任务
+	old := m.tasks
+	m.tasks = make(map[string]*BackupTask)
+	tasks := file.Tasks
+
+	// 添加日志
+	log.Printf("Found %d tasks in config file", len(tasks))
+
+	// 正在备份的任务保留内存中的对象和运行状态，备份结束时的结果仍写入同一个对象，
+	// 配置文件中修改的选项从下次备份开始生效；已从配置文件中删除的也保留，备份结束后再删除
+	running := make(map[string]*BackupTask)
+	for name, task := range old {
+		if _, busy := m.transfers[name]; !busy {
+			continue
+		}
+		running[name] = task
+		if !slices.ContainsFunc(tasks, func(t BackupTask) bool { return t.Name == name }) {
+			log.Printf("[Task: %s] Task was removed from the config file while its backup is running, keeping it", name)
+			tasks = append(tasks, *task)
+		}
+	}
+
+	invalid := dependencyErrors(tasks)
+	for _, task := range tasks {
+		if current, busy := running[task.Name]; busy {
+			log.Printf("[Task: %s] Backup is running, changed options apply from the next backup", task.Name)
+			task.copyState(current)
+		}
+		taskCopy := task
+		m.tasks[task.Name] = &taskCopy
+
+		// 依赖无效（如手工编辑引入了循环依赖）的任务不启动定时器，需要修改配置文件后重新加载
+		if err := invalid[task.Name]; err != nil && taskCopy.Status != StatusStopped {
+			log.Printf("Warning: disabling task %s: %v", task.Name, err)
+			taskCopy.Status = StatusFatal
+			taskCopy.Error = err.Error()
+			continue
+		}
+
+		// 恢复未到期的临时加速，已到期的直接清除
+		if task.BoostSchedule != "" {
+			if remaining := time.Until(task.BoostUntil); remaining > 0 && task.Status != StatusStopped {
+				m.armBoostExpiry(task.Name, remaining)
+			} else {
+				taskCopy.BoostSchedule = ""
+				taskCopy.BoostUntil = time.Time{}
+			}
+		}
+
+		// 恢复未到期的临时目标，已到期的直接改回原目标
+		if taskCopy.OriginalTarget != "" && !taskCopy.RedirectUntil.IsZero() {
+			if remaining := time.Until(taskCopy.RedirectUntil); remaining > 0 {
+				m.armRedirectExpiry(task.Name, remaining)
+			} else {
+				log.Printf("[Task: %s] Target redirect expired, reverting to %s", task.Name, taskCopy.OriginalTarget)
+				taskCopy.TargetPath = taskCopy.OriginalTarget
+				taskCopy.OriginalTarget = ""
+				taskCopy.RedirectUntil = time.Time{}
+			}
+		}
+
+		// 恢复未到期的暂停，已到期的任务直接恢复运行
+		if !task.SnoozeUntil.IsZero() {
+			if remaining := time.Until(task.SnoozeUntil); remaining > 0 && task.Status != StatusStopped {
+				m.armSnoozeExpiry(task.Name, remaining)
+				continue
+			}
+			taskCopy.SnoozeUntil = time.Time{}
+			if task.Status == StatusPaused {
+				taskCopy.Status = StatusReady
+			}
+		}
+
+		if taskCopy.Status != StatusStopped {
+			// 间隔无效的任务不启动定时器，标记为错误
+			if _, err := parseSchedule(task.Schedule); err != nil {
+				log.Printf("Warning: disabling task %s: %v", task.Name, err)
+				taskCopy.Status = StatusError
+				taskCopy.Error = err.Error()
+				continue
+			}
+			var err error
+			if previous, armed := next[task.Name]; armed {
+				err = m.resumeBackupTimer(task.Name, previous)
+			} else {
+				err = m.startBackupTimer(task.Name)
+			}
+			if err != nil {
+				log.Printf("Warning: failed to start timer for task %s: %v", task.Name, err)
+				taskCopy.Status = StatusError
+				taskCopy.Error = err.Error()
+			}
+		}
+	}
+	for name, current := range running {
+		*current = *m.tasks[name]
+		m.tasks[name] = current
+	}
+	// 与 DeleteTask 一样清除已删除任务的运行时标记，之后添加的同名任务不会继承它们
+	for name := range old {
+		if _, exists := m.tasks[name]; !exists {
+			delete(m.blocked, name)
+			delete(m.debug, name)
+		}
+	}
+
+	// 旧版本的配置文件升级后保留一份原文件，再按当前版本重写
+	if migration != nil {
+		log.Printf("Migrating config file from schema version %d to %d", migration.From, migration.To)
+		for _, change := range migration.Changes {
+			log.Printf("  - %s", change)
+		}
+		backupPath, err := backupOldConfig(m.configFile, migration.From)
+		if err != nil {
+			log.Printf("Warning: failed to keep a copy of the old config file, not rewriting it: %v", err)
+			return nil
+		}
+		log.Printf("Old config file kept at %s", backupPath)
+		m.persist()
+	}
+
+	return nil
+}
+
+// cacheFile returns the path of a task's target hash cache,
+// stored in a cache directory next to the config file
+func (m *Manager) cacheFile(name string) string {
+	return filepath.Join(filepath.Dir(m.configFile), "cache", name+".json")
+}
+
+// targetCacheFile returns the hash cache path for a task's i-th target.
+// Mirror targets get a suffix derived from their path so that reordering
+// the mirrors does not mix up their caches. Mirror caches live in their own
+// directory, so that a task named like another task's mirror cache, e.g.
+// foo-1a2b3c4d, does not share its cache file.
+func (m *Manager) targetCacheFile(name string, i int, target string) string {
+	if i == 0 {
+		return m.cacheFile(name)
+	}
+	sum := sha256.Sum256([]byte(filepath.Clean(target)))
+	return filepath.Join(filepath.Dir(m.configFile), "cache", "mirror", fmt.Sprintf("%s-%x.json", name, sum[:4]))
+}
+
+// sourceManifestFile returns the path of the manifest kept by a task's
+// incremental source scans
+func (m *Manager) sourceManifestFile(name string) string {
+	return filepath.Join(filepath.Dir(m.configFile), "cache", "source", name+".json")
+}
+
+// removeCaches removes the hash caches of all of a task's targets and the
+// manifest of its source
+func (m *Manager) removeCaches(task *BackupTask) error {
+	// 手工编辑的配置文件中可能有不合法的任务名，不删除缓存目录以外的文件
+	if err := checkTaskName(task.Name); err != nil {
+		return err
+	}
+	for i, target := range task.targets() {
+		if err := os.Remove(m.targetCacheFile(task.Name, i, target)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Remove(m.sourceManifestFile(task.Name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// targetStates returns the per-target results of a run, keeping each target's
+// last successful backup time. Tasks without mirror targets record none.
+func targetStates(previous []TargetState, targets []string, errs []error, finishedAt time.Time) []TargetState {
+	if len(targets) < 2 {
+		return nil
+	}
+
+	states := make([]TargetState, len(targets))
+	for i, target := range targets {
+		states[i] = TargetState{Path: target, Status: StatusReady}
+		for _, state := range previous {
+			if state.Path == target {
+				states[i].LastBackup = state.LastBackup
+			}
+		}
+		if errs[i] != nil {
+			states[i].Status = failureStatus(errs[i])
+			states[i].Error = errs[i].Error()
+		} else {
+			states[i].LastBackup = finishedAt
+		}
+	}
+	return states
+}
+
+// readConfig reads and parses the task list and global settings from a config file, upgrading
+// files written by older versions. The returned migration is nil when the
+// file is already at the current schema version.
+// A missing file is reported with the unwrapped os error.
+func readConfig(configFile string) (*taskFile, *ConfigMigration, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	file, migration, err := decodeTaskFile(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	return file, migration, nil
+}
+
+// saveRetryInterval 配置文件无法写入时重试保存的间隔
+const saveRetryInterval = time.Minute
+
+// saveTasks saves tasks to the config file. When the config file cannot be
+// written the daemon keeps running with the task state held in memory: a
+// single warning is logged and saving is retried periodically until it
+// succeeds. Must be called with m.mu held.
+func (m *Manager) saveTasks() error {
+	log.Printf("Saving %d tasks to file: %s", len(m.tasks), m.configFile)
+	if err := m.writeTasks(); err != nil {
+		if m.saveErr == nil {
+			log.Printf("Warning: cannot save tasks, keeping task state in memory and retrying every %s: %v",
+				saveRetryInterval, err)
+			// 尝试检查文件权限
+			if info, statErr := os.Stat(filepath.Dir(m.configFile)); statErr == nil {
+				log.Printf("Config directory permissions: %v", info.Mode())
+			}
+			m.saveRetry = time.AfterFunc(saveRetryInterval, m.retrySave)
+		}
+		m.saveErr = err
+		return err
+	}
+
+	log.Printf("Successfully saved tasks to file")
+	m.recoverSave()
+	return nil
+}
+
+// persist saves the tasks after a change that is already applied in memory,
+// made by the daemon itself, such as a finished backup, or requested by a
+// client. A failed save does not undo or fail the change: the state is kept
+// in memory and the error is reported with the tasks (TaskDetail.SaveError).
+// While saving is failing it leaves the write to the retry timer instead of
+// logging the same error on every change.
+// Must be called with m.mu held.
+func (m *Manager) persist() {
+	if m.saveErr != nil {
+		return
+	}
+	// 失败时 saveTasks 已经输出了警告
+	_ = m.saveTasks()
+}
+
+// retrySave periodically retries saving the tasks after a failure
+func (m *Manager) retrySave() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.saveErr == nil {
+		return
+	}
+	if err := m.writeTasks(); err != nil {
+		m.saveErr = err
+		m.saveRetry = time.AfterFunc(saveRetryInterval, m.retrySave)
+		return
+	}
+	m.recoverSave()
+}
+
+// recoverSave leaves the in-memory mode after tasks were saved successfully
+func (m *Manager) recoverSave() {
+	if m.saveErr == nil {
+		return
+	}
+	m.saveErr = nil
+	if m.saveRetry != nil {
+		m.saveRetry.Stop()
+		m.saveRetry = nil
+	}
+	log.Printf("Config file is writable again, task state saved to %s", m.configFile)
+}
+
+// SaveError returns the error that keeps the task state from being saved to
+// the config file, or nil when the config file is up to date
+func (m *Manager) SaveError() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.saveErr
+}
+
+// writeTasks writes the tasks to the config file
+func (m *Manager) writeTasks() error {
+	tasks := make([]BackupTask, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		tasks = append(tasks, *task)
+	}
+
+	data, err := json.MarshalIndent(taskFile{SchemaVersion: SchemaVersion, Globals: m.globals, Tasks: tasks}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tasks: %v", err)
+	}
+
+	// 确保配置目录存在
+	configDir := filepath.Dir(m.configFile)
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	if err := os.WriteFile(m.configFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	return nil
+}
+
+// parseSchedule parses a schedule in minutes, rejecting empty,
+// unparseable and non-positive values
+func parseSchedule(schedule string) (time.Duration, error) {
+	interval, err := time.ParseDuration(schedule + "m")
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule %q: not a number of minutes", schedule)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid schedule %q: interval must be greater than 0", schedule)
+	}
+	return interval, nil
+}
+
+// taskInterval returns the interval currently in effect for a task,
+// taking an unexpired boost and the retry cadence after a failure into account
+func taskInterval(task *BackupTask) (time.Duration, error) {
+	schedule := task.Schedule
+	if task.BoostSchedule != "" && time.Now().Before(task.BoostUntil) {
+		schedule = task.BoostSchedule
+	}
+	interval, err := parseSchedule(schedule)
+	if err != nil {
+		return 0, err
+	}
+	// 重试间隔比当前间隔长时没有意义，仍按当前间隔
+	if task.retryAttempt() > 0 {
+		if retry, err := task.retryInterval(); err == nil {
+			interval = min(interval, retry)
+		}
+	}
+	return interval, nil
+}
+
+// updateCadence re-arms a task's timer after a backup that made it enter,
+// continue or leave its retry cadence, so that a failure is retried on the
+// retry interval and a success or the last retry returns to the normal
+// schedule (caller holds m.mu)
+func (m *Manager) updateCadence(task *BackupTask, wasRetrying bool) {
+	timer, running := m.timers[task.Name]
+	attempt := task.retryAttempt()
+	if !running || attempt == 0 && !wasRetrying {
+		return
+	}
+	interval, err := taskInterval(task)
+	if err != nil {
+		return
+	}
+	m.resetTimer(task.Name, timer, interval)
+	if attempt > 0 {
+		log.Printf("[Task: %s] Retrying in %s (retry %d of %d)", task.Name, interval, attempt, task.retryLimit())
+	} else {
+		log.Printf("[Task: %s] Back to the normal schedule, next backup in %s", task.Name, interval)
+	}
+}
+
+// startBackupTimer starts a timer for periodic backup
+func (m *Manager) startBackupTimer(name string) error {
+	task := m.tasks[name]
+	interval, err := taskInterval(task)
+	if err != nil {
+		return err
+	}
+	// 恢复的任务不再等待停止前跳过时的依赖，首次备份会重新检查依赖
+	delete(m.blocked, name)
+
+	// 打印定时器启动日志
+	log.Printf("[Task: %s] Starting backup timer with interval: %s",
+		task.Name, interval.String())
+
+	// 随机推迟首次备份和之后的整个周期，使相同间隔的任务错开执行
+	delay := m.jitterDelay(interval)
+	timer := &backupTimer{Timer: time.NewTimer(delay + interval), done: make(chan struct{})}
+	m.timers[name] = timer
+	m.nextRuns[name] = time.Now().Add(delay + interval)
+	m.firstRuns[name] = time.Now().Add(delay)
 
 	// 立即执行一次备份
-	log.Printf("[Task: %s] Performing initial backup", task.Name)
+	if delay > 0 {
+		log.Printf("[Task: %s] Performing initial backup in %s", task.Name, delay.Round(time.Second))
+	} else {
+		log.Printf("[Task: %s] Performing initial backup", task.Name)
+	}
+	go func() {
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		m.mu.Lock()
+		active := m.timers[name] == timer
+		if active {
+			delete(m.firstRuns, name)
+		}
+		m.mu.Unlock()
+		if !active {
+			// 等待期间任务已被停止或删除
+			return
+		}
+		m.startBackup(name)
+	}()
+
+	go m.runTimer(name, timer, interval)
+	m.armScrub(name)
+	return nil
+}
+
+// resumeBackupTimer re-arms a task's timer after the config file was
+// reloaded, without the initial backup of startBackupTimer. The timer fires
+// at next, the task's next run before the reload, or after one interval when
+// next is unknown, already past or further away than the (possibly shortened)
+// interval.
+func (m *Manager) resumeBackupTimer(name string, next time.Time) error {
+	interval, err := taskInterval(m.tasks[name])
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if next.Before(now) || next.After(now.Add(interval)) {
+		next = now.Add(interval)
+	}
+	timer := &backupTimer{Timer: time.NewTimer(next.Sub(now)), done: make(chan struct{})}
+	m.timers[name] = timer
+	m.nextRuns[name] = next
+	log.Printf("[Task: %s] Backup timer restarted with interval %s, next backup at %s",
+		name, interval, next.Format("2006-01-02 15:04:05"))
+
+	go m.runTimer(name, timer, interval)
+	m.armScrub(name)
+	return nil
+}
+
+// startBackup runs a task's backup in the background. Its error, or a panic
+// during the backup, is logged instead of taking down the daemon.
+func (m *Manager) startBackup(name string) {
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				log.Printf("[Task: %s] Backup failed: %v", task.Name, r)
+				log.Printf("[Task: %s] Backup failed: %v", name, r)
 			}
 		}()
 		if err := m.performBackup(name); err != nil {
-			log.Printf("[Task: %s] Backup failed: %v", task.Name, err)
+			log.Printf("[Task: %s] Backup failed: %v", name, err)
 		}
 	}()
+}
 
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("[Task: %s] Backup failed: %v", task.Name, r)
-			}
-		}()
-		for {
-			<-timer.C
-			// 打印定时器触发日志
-			log.Printf("[Task: %s] Timer triggered, starting backup", task.Name)
+// runTimer runs a task's backup each time its timer fires, until the timer
+// is stopped or replaced
+func (m *Manager) runTimer(name string, timer *backupTimer, interval time.Duration) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Task: %s] Backup failed: %v", name, r)
+		}
+	}()
+	for {
+		select {
+		case <-timer.C:
+		case <-timer.done:
+			return
+		}
+		// 打印定时器触发日志
+		log.Printf("[Task: %s] Timer triggered, starting backup", name)
+
+		if err := m.performBackup(name); err != nil {
+			log.Printf("[Task: %s] Backup failed: %v", name, err)
+		}
 
-			if err := m.performBackup(name); err != nil {
-				log.Printf("[Task: %s] Backup failed: %v", task.Name, err)
+		// 每次重新计算间隔，使临时加速的开始和结束都能生效
+		m.mu.Lock()
+		if m.timers[name] != timer {
+			// 定时器已被停止或替换，退出循环
+			m.mu.Unlock()
+			return
+		}
+		if current, exists := m.tasks[name]; exists {
+			if d, err := taskInterval(current); err == nil {
+				interval = d
 			}
-			timer.Reset(interval)
-			// 打印下次备份时间
-			log.Printf("[Task: %s] Next backup scheduled at: %s",
-				task.Name, time.Now().Add(interval).Format("2006-01-02 15:04:05"))
 		}
-	}()
+		m.resetTimer(name, timer, interval)
+		m.mu.Unlock()
 
-	return nil
+		// 打印下次备份时间
+		log.Printf("[Task: %s] Next backup scheduled at: %s",
+			name, time.Now().Add(interval).Format("2006-01-02 15:04:05"))
+	}
+}
+
+// jitterDelay returns a random delay of at most the configured jitter,
+// capped at the task's interval
+func (m *Manager) jitterDelay(interval time.Duration) time.Duration {
+	limit := min(m.opts.Jitter, interval)
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// resetTimer re-arms a task's timer and records its next fire time
+func (m *Manager) resetTimer(name string, timer *backupTimer, interval time.Duration) {
+	timer.Reset(interval)
+	m.nextRuns[name] = time.Now().Add(interval)
 }
 
 // stopBackupTimer stops a backup timer
 func (m *Manager) stopBackupTimer(name string) {
 	if timer, exists := m.timers[name]; exists {
 		timer.Stop()
+		close(timer.done)
 		delete(m.timers, name)
+		delete(m.nextRuns, name)
+		delete(m.firstRuns, name)
+		m.cancelScrub(name)
 		// 打印停止日志
 		log.Printf("[Task: %s] Backup timer stopped", name)
 	}
 }
 
-// performBackup performs the actual backup operation
+// taskProgress returns a task's progress, read from its running backup if
+// there is one (caller holds m.mu)
+func (m *Manager) taskProgress(name string) float64 {
+	task := m.tasks[name]
+	if transfer, running := m.transfers[name]; running && !transfer.scrub && task.Status == StatusRunning {
+		return transfer.currentProgress()
+	}
+	return task.Progress
+}
+
+// describeRun describes a task's running backup, e.g.
+// "backup 62% complete, started 3m0s ago" (caller holds m.mu)
+func (m *Manager) describeRun(name string) string {
+	transfer, running := m.transfers[name]
+	if !running {
+		return "no backup running"
+	}
+	if transfer.scrub {
+		return fmt.Sprintf("scrub running, started %s ago", time.Since(transfer.startedAt).Round(time.Second))
+	}
+	return fmt.Sprintf("backup %.0f%% complete, started %s ago",
+		m.taskProgress(name), time.Since(transfer.startedAt).Round(time.Second))
+}
+
+// armBoostExpiry arms a one-shot timer that ends a task's boost
+func (m *Manager) armBoostExpiry(name string, d time.Duration) {
+	m.cancelBoost(name)
+	m.boosts[name] = time.AfterFunc(d, func() {
+		m.endBoost(name)
+	})
+}
+
+// cancelBoost stops a pending boost expiry timer
+func (m *Manager) cancelBoost(name string) {
+	if timer, exists := m.boosts[name]; exists {
+		timer.Stop()
+		delete(m.boosts, name)
+	}
+}
+
+// endBoost restores a task's original interval once its boost expires
+func (m *Manager) endBoost(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.boosts, name)
+	task, exists := m.tasks[name]
+	if !exists || task.BoostSchedule == "" {
+		return
+	}
+
+	task.BoostSchedule = ""
+	task.BoostUntil = time.Time{}
+
+	if timer, running := m.timers[name]; running {
+		if interval, err := taskInterval(task); err == nil {
+			m.resetTimer(name, timer, interval)
+		}
+	}
+	log.Printf("[Task: %s] Boost expired, interval restored to %sm", name, task.Schedule)
+
+	m.persist()
+}
+
+// armRedirectExpiry arms a one-shot timer that restores a task's original target
+func (m *Manager) armRedirectExpiry(name string, d time.Duration) {
+	m.cancelRedirect(name)
+	m.redirects[name] = time.AfterFunc(d, func() {
+		m.endRedirect(name)
+	})
+}
+
+// cancelRedirect stops a pending redirect expiry timer
+func (m *Manager) cancelRedirect(name string) {
+	if timer, exists := m.redirects[name]; exists {
+		timer.Stop()
+		delete(m.redirects, name)
+	}
+}
+
+// endRedirect restores a task's original target once its redirect expires.
+// A backup still running to the temporary target delays the revert.
+func (m *Manager) endRedirect(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.redirects, name)
+	task, exists := m.tasks[name]
+	if !exists || task.OriginalTarget == "" {
+		return
+	}
+
+	if err := m.redirectTarget(task, task.OriginalTarget, "", time.Time{}); err != nil {
+		log.Printf("[Task: %s] Cannot revert target yet: %v", name, err)
+		m.armRedirectExpiry(name, time.Minute)
+		return
+	}
+	log.Printf("[Task: %s] Target redirect expired, reverted to %s", name, task.TargetPath)
+
+	m.persist()
+}
+
+// runSafely runs a sync to each target, turning a panic into an error so a
+// bug in one backup cannot take down the daemon. Panics while syncing a single
+// target are already reported for that target by runTargets; only a panic
+// while scanning the source fails every target.
+func runSafely(ctx context.Context, opts SyncOptions, targets []string, configure func(i int, opts *SyncOptions) error) (summary Summary, errs []error) {
+	defer func() {
+		if r := recover(); r != nil {
+			errs = make([]error, len(targets))
+			for i := range errs {
+				errs[i] = fmt.Errorf("panic during sync: %v", r)
+			}
+		}
+	}()
+	return runTargets(ctx, opts, targets, configure)
+}
+
+// armSnoozeExpiry arms a one-shot timer that resumes a snoozed task
+func (m *Manager) armSnoozeExpiry(name string, d time.Duration) {
+	m.cancelSnooze(name)
+	m.snoozes[name] = time.AfterFunc(d, func() {
+		m.endSnooze(name)
+	})
+}
+
+// cancelSnooze stops a pending snooze expiry timer
+func (m *Manager) cancelSnooze(name string) {
+	if timer, exists := m.snoozes[name]; exists {
+		timer.Stop()
+		delete(m.snoozes, name)
+	}
+}
+
+// endSnooze restarts a task's timer once its snooze expires
+func (m *Manager) endSnooze(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.snoozes, name)
+	task, exists := m.tasks[name]
+	if !exists || task.SnoozeUntil.IsZero() {
+		return
+	}
+
+	task.SnoozeUntil = time.Time{}
+	task.Status = StatusReady
+	log.Printf("[Task: %s] Snooze expired, resuming", name)
+	if err := m.startBackupTimer(name); err != nil {
+		log.Printf("[Task: %s] Failed to restart timer: %v", name, err)
+		task.Status = StatusError
+		task.Error = err.Error()
+	}
+
+	m.persist()
+}
+
+// armScrub arms a one-shot timer for a task's next integrity scrub, due one
+// scrub interval after the last one. Overdue scrubs are postponed briefly so
+// they do not collide with the backup started along with the timer.
+func (m *Manager) armScrub(name string) {
+	m.cancelScrub(name)
+	task := m.tasks[name]
+	interval, err := task.scrubInterval()
+	if err != nil || interval == 0 || task.RehashTarget {
+		return
+	}
+
+	delay := interval
+	if !task.LastScrub.IsZero() {
+		delay = max(time.Until(task.LastScrub.Add(interval)), scrubRetryDelay)
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[Task: %s] Scrub failed: %v", name, r)
+			}
+		}()
+		if err := m.performScrub(name); err != nil {
+			log.Printf("[Task: %s] Scrub failed: %v", name, err)
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.scrubs[name] == timer {
+			m.armScrub(name)
+		}
+	})
+	m.scrubs[name] = timer
+	log.Printf("[Task: %s] Next scrub scheduled at: %s", name, time.Now().Add(delay).Format("2006-01-02 15:04:05"))
+}
+
+// cancelScrub stops a task's pending scrub timer
+func (m *Manager) cancelScrub(name string) {
+	if timer, exists := m.scrubs[name]; exists {
+		timer.Stop()
+		delete(m.scrubs, name)
+	}
+}
+
+// failBackup records a backup that failed before it could start.
+// Must be called with m.mu held.
+func (m *Manager) failBackup(task *BackupTask, status string, err error) {
+	retrying := task.retryAttempt() > 0
+	task.Status = status
+	task.recordFailure(err.Error(), time.Now())
+	m.events.publish(Event{Type: EventFailed, Task: task.Name, Status: status, Error: task.Error})
+	m.updateCadence(task, retrying)
+}
+
+// performBackup performs the actual backup operation. When the number of
+// concurrent backups is limited it first waits for a free slot.
 func (m *Manager) performBackup(name string) error {
+	m.mu.RLock()
+	task := m.tasks[name]
+	var priority int
+	if task != nil {
+		priority = task.Priority
+	}
+	_, running := m.transfers[name]
+	m.mu.RUnlock()
+	if task == nil {
+		return fmt.Errorf("task %s does not exist", name)
+	}
+	// 正在进行的备份由 runBackup 记录跳过，不占用名额
+	if running {
+		return m.runBackup(name)
+	}
+
+	// 依赖的任务正在备份时等它完成，依赖尚未成功备份时跳过，不占用名额
+	if dep, err := m.waitForDependencies(name); err != nil {
+		m.skipForDependency(name, dep, err)
+		return nil
+	}
 	m.mu.Lock()
+	delete(m.blocked, name)
+	m.mu.Unlock()
+
+	// 名额已满时排队，空出名额时优先级高的任务先开始
+	ready, position, ok := m.queue.enqueue(name, priority)
+	if !ok {
+		log.Printf("[Task: %s] Skipping backup: already waiting for a backup slot", name)
+		return nil
+	}
+	defer m.queue.release(name)
+	if position > 0 {
+		log.Printf("[Task: %s] Waiting for a backup slot (priority %d, position %d in queue)", name, priority, position)
+		<-ready
+	}
+
+	// 排队期间任务可能已被删除、停止或暂停
+	m.mu.RLock()
+	task = m.tasks[name]
+	skip := task == nil || task.Status == StatusStopped || task.Status == StatusPaused
+	m.mu.RUnlock()
+	if skip {
+		log.Printf("[Task: %s] Skipping queued backup: the task was deleted, stopped or paused while waiting", name)
+		return nil
+	}
+	return m.runBackup(name)
+}
+
+// runBackup performs one backup of a task without waiting for a slot
+func (m *Manager) runBackup(name string) error {
+	m.mu.RLock()
 	task := m.tasks[name]
+	if task == nil {
+		m.mu.RUnlock()
+		return fmt.Errorf("task %s does not exist", name)
+	}
+	source, allowEmpty := task.syncSource(), task.AllowEmptySource
+	targets, minFree := task.targets(), task.MinFreeSpace
+	m.mu.RUnlock()
+
+	// 检查源目录和目标的可用空间时不持有锁，它们在卡住的网络挂载上时 list 和状态查询不会被阻塞
+	sourceErr := checkSource(source, allowEmpty)
+
+	// 目标可用空间低于下限时跳过该目标，不做任何修改；所有目标都不满足时跳过本次备份
+	skipped := make([]error, len(targets))
+	available := 0
+	if sourceErr == nil {
+		for i, target := range targets {
+			if skipped[i] = checkFreeSpace(target, minFree); skipped[i] == nil {
+				available++
+			}
+		}
+	}
+
+	m.mu.Lock()
+	// 检查期间任务可能已被删除，或者开始了另一次备份
+	task = m.tasks[name]
 	if task == nil {
 		m.mu.Unlock()
 		return fmt.Errorf("task %s does not exist", name)
 	}
 
+	// 同一任务的备份不能重叠执行
+	if _, running := m.transfers[name]; running {
+		log.Printf("[Task: %s] Skipping backup: %s", name, m.describeRun(name))
+		m.mu.Unlock()
+		return nil
+	}
+
+	// 检查期间源目录或目标被修改时按新的设置重新检查
+	if task.syncSource() != source || task.AllowEmptySource != allowEmpty ||
+		!slices.Equal(task.targets(), targets) || task.MinFreeSpace != minFree {
+		m.mu.Unlock()
+		return m.runBackup(name)
+	}
+
 	log.Printf("[Task: %s] Starting backup from %s to %s",
-		task.Name, task.SourcePath, task.TargetPath)
+		task.Name, task.syncSource(), task.targets()[0])
+	if task.ForceFull {
+		log.Printf("[Task: %s] Full backup requested, copying all files regardless of the target", task.Name)
+	}
+
+	opts, err := task.syncOptions()
+	if err != nil {
+		m.failBackup(task, StatusFatal, err)
+		m.mu.Unlock()
+		return err
+	}
+	opts.Exclude = slices.Concat(opts.Exclude, m.opts.Exclude)
+
+	// 源目录暂时不可用时跳过本次备份，同步一个空的源目录会清空目标
+	// 其他源目录问题重试也无济于事
+	if err := sourceErr; err != nil {
+		var unavailable *unavailableError
+		if errors.As(err, &unavailable) {
+			log.Printf("[Task: %s] Skipping backup: %v", name, err)
+			task.Status = StatusUnavailable
+			task.Error = err.Error()
+			m.events.publish(Event{Type: EventSkipped, Task: name, Status: task.Status, Error: task.Error})
+			m.mu.Unlock()
+			return nil
+		}
+		m.failBackup(task, failureStatus(err), err)
+		m.mu.Unlock()
+		return err
+	}
+
+	if available == 0 {
+		err := skipped[0]
+		m.failBackup(task, StatusRetrying, err)
+		m.mu.Unlock()
+		return err
+	}
+
+	// 记录字节进度，用于计算传输速率和剩余时间
+	transfer := &transferState{startedAt: time.Now()}
+	m.transfers[name] = transfer
 
-	task.Status = "Running"
+	retrying := task.retryAttempt() > 0
+	task.Status = StatusRunning
+	lastProgress := task.Progress
 	task.Progress = 0 // 开始备份时设置为 0
 	task.Error = ""
+	startedAt := transfer.startedAt
+	rehash := task.RehashTarget
+	debug := m.debug[name]
+	m.events.publish(Event{Type: EventStarted, Task: name, Status: task.Status})
 	m.mu.Unlock()
 
-	// TODO: Implement actual backup logic here
-	// For now, just simulate a backup operation
-	// for i := 0; i <= 100; i += 10 {
-	// 	time.Sleep(100 * time.Millisecond)
-	// 	m.mu.Lock()
-	// 	task.Progress = float64(i)
-	// 	log.Printf("[Task: %s] Progress: %.1f%%", task.Name, task.Progress)
-	// 	m.mu.Unlock()
-	// }
+	// 每次进度更新后把进度快照交给 OnProgress，只有字节数变化时限制频率
+	var lastReport time.Time
+	report := func(bytesOnly bool) {
+		if m.opts.OnProgress == nil || bytesOnly && time.Since(lastReport) < 500*time.Millisecond {
+			return
+		}
+		lastReport = time.Now()
+		if status, err := m.TransferStatus(name); err == nil {
+			m.opts.OnProgress(status)
+		}
+	}
+	setPhase := func(phase Phase) {
+		transfer.setPhase(phase)
+		report(false)
+	}
 
-	progressChan := make(chan float64)
-	errChan := make(chan error)
+	// 依次同步每个目标，进度和字节数在所有目标之间累计
+	opts.Progress = ProgressFuncs{Phase: setPhase}
+	// 详细日志是否开启在备份开始时读取一次，扫描和复制循环中不再加锁
+	if debug {
+		opts.Debugf = debugf(name)
+	}
+	opts.SharedLimiter = m.limiter
+	opts.WaitIfPaused = transfer.pause.wait
+	if task.IncrementalScan {
+		opts.SourceManifestFile = m.sourceManifestFile(name)
+	}
+	var bytesBase, bytesTotal int64
+	configure := func(i int, opts *SyncOptions) error {
+		if skipped[i] != nil {
+			return skipped[i]
+		}
+		// 复用目标目录的哈希缓存，除非任务要求每次重新计算
+		if !rehash {
+			opts.TargetCacheFile = m.targetCacheFile(name, i, targets[i])
+		}
+		bytesBase, bytesTotal = bytesBase+bytesTotal, 0
+		transfer.setTarget(targets[i])
+		opts.Progress = ProgressFuncs{
+			Phase: setPhase,
+			File: func(relPath string, n, total int) {
+				transfer.setFile(relPath, n, total)
+				report(false)
+			},
+			Delete: func(done, total int) {
+				transfer.setDeleted(done, total)
+				report(false)
+			},
+			Bytes: func(done, total int64) {
+				bytesTotal = total
+				transfer.update(bytesBase+done, bytesBase+total)
+				report(true)
+			},
+			// 同步进度写入任务状态
+			Progress: func(progress float64) {
+				progress = (float64(i)*100 + progress) / float64(len(targets))
+				log.Printf("[Task: %s] Progress: %.1f%%", task.Name, progress)
+				transfer.setProgress(progress)
+				m.events.publish(Event{Type: EventProgress, Task: name, Status: StatusRunning, Progress: progress})
+				report(false)
+			},
+		}
+		return nil
+	}
 
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("[Task: %s] Backup failed: %v", task.Name, r)
-			}
-		}()
-		errChan <- Sync(task.SourcePath, task.TargetPath, progressChan)
-		close(progressChan)
-		close(errChan)
-	}()
+	stats, errs := runSafely(context.Background(), opts, targets, configure)
 
-outer:
-	for {
-		select {
-		case err := <-errChan:
-			if err != nil {
-				log.Printf("[Task: %s] Backup failed: %v", task.Name, err)
-			}
-			break outer
-		case progress := <-progressChan:
-			log.Printf("[Task: %s] Progress: %.1f%%", task.Name, progress)
-			m.mu.Lock()
-			task.Progress = progress
-			m.mu.Unlock()
+	// 源目录仍在变化时跳过本次备份，与源目录不可用一样不算失败
+	var unavailable *unavailableError
+	if errors.As(errs[0], &unavailable) {
+		log.Printf("[Task: %s] Skipping backup: %v", name, unavailable)
+		m.mu.Lock()
+		delete(m.transfers, name)
+		if task.Status == StatusRunning {
+			task.Status = StatusUnavailable
+			task.Error = unavailable.Error()
+			task.Progress = lastProgress
+		}
+		m.events.publish(Event{Type: EventSkipped, Task: name, Status: task.Status, Error: unavailable.Error()})
+		m.mu.Unlock()
+		return nil
+	}
+
+	// 第一个失败的目标决定任务状态，错误信息包含所有失败的目标
+	var syncErr error
+	var failures []string
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if syncErr == nil {
+			syncErr = err
+		}
+		if len(targets) > 1 {
+			log.Printf("[Task: %s] Backup to %s failed: %v", task.Name, targets[i], err)
+			failures = append(failures, fmt.Sprintf("target %s: %v", targets[i], err))
+		} else {
+			log.Printf("[Task: %s] Backup failed: %v", task.Name, err)
 		}
 	}
 
 	m.mu.Lock()
-	task.Status = "Ready"
-	task.Progress = 100 // 完成备份时设置为 100
-	task.LastBackup = time.Now()
-	log.Printf("[Task: %s] Backup completed successfully at %s",
-		task.Name, task.LastBackup.Format("2006-01-02 15:04:05"))
+	delete(m.transfers, name)
+	finishedAt := time.Now()
+	// 备份期间任务可能已被停止或暂停，此时保留新的状态
+	if task.Status == StatusRunning {
+		task.Progress = transfer.currentProgress()
+		if syncErr != nil {
+			task.Status = failureStatus(syncErr)
+		} else {
+			task.Status = StatusReady
+		}
+	}
+	if syncErr != nil {
+		msg := syncErr.Error()
+		if len(failures) > 0 {
+			msg = strings.Join(failures, "; ")
+		}
+		task.recordFailure(msg, finishedAt)
+		if task.ConsecutiveFailures > 1 {
+			log.Printf("[Task: %s] Backup has failed %d times in a row", task.Name, task.ConsecutiveFailures)
+		}
+	} else {
+		task.ConsecutiveFailures = 0
+		task.ForceFull = false
+		task.Progress = 100 // 完成备份时设置为 100
+		task.LastBackup = finishedAt
+		log.Printf("[Task: %s] Backup completed successfully at %s",
+			task.Name, task.LastBackup.Format("2006-01-02 15:04:05"))
+	}
+	task.TargetStates = targetStates(task.TargetStates, targets, errs, finishedAt)
+	m.updateCadence(task, retrying)
+	if syncErr != nil {
+		m.events.publish(Event{Type: EventFailed, Task: name, Status: task.Status, Error: task.Error,
+			FilesCopied: stats.FilesCopied, FilesDeleted: stats.FilesDeleted, BytesTransferred: stats.BytesTransferred})
+	} else {
+		m.events.publish(Event{Type: EventFinished, Task: name, Status: task.Status, Progress: task.Progress,
+			FilesCopied: stats.FilesCopied, FilesDeleted: stats.FilesDeleted, BytesTransferred: stats.BytesTransferred})
+	}
+	task.UnreadableFiles = 0
+	if opts.UnreadablePolicy == UnreadableWarn {
+		task.UnreadableFiles = stats.FilesUnreadable
+	}
+	task.ExcludedFiles, task.ExcludedBytes = stats.FilesExcluded, stats.BytesExcluded
+	task.CaseConflicts = stats.CaseConflicts
+	task.LongPaths = stats.PathsTooLong
+	task.DeferredFiles = stats.FilesDeferred
+	// 目标的扫描失败时没有统计，保留上次的值
+	if stats.TargetFiles > 0 || stats.TargetBytes > 0 || syncErr == nil {
+		task.TargetFiles, task.TargetBytes = stats.TargetFiles, stats.TargetBytes
+	}
+
+	// 记录本次备份结果并保存
+	record := RunRecord{
+		StartedAt:        startedAt,
+		FinishedAt:       finishedAt,
+		Success:          syncErr == nil,
+		FilesCopied:      stats.FilesCopied,
+		FilesDeleted:     stats.FilesDeleted,
+		BytesTransferred: stats.BytesTransferred,
+		FilesExcluded:    stats.FilesExcluded,
+		BytesExcluded:    stats.BytesExcluded,
+	}
+	if syncErr != nil {
+		record.Error = task.Error
+	}
+	task.addRunRecord(record)
+	task.TotalBytesTransferred += stats.BytesTransferred
+
+	// 平均耗时超过间隔时备份实际上一个接一个地进行，间隔失去了意义
+	warning := ""
+	if interval, err := parseSchedule(task.Schedule); err == nil {
+		if avg := task.averageDuration(); avg > interval {
+			warning = fmt.Sprintf("interval %s is shorter than the average backup duration %s",
+				interval, avg.Round(time.Second))
+		}
+	}
+	if warning != "" && task.ScheduleWarning == "" {
+		log.Printf("[Task: %s] Warning: %s", task.Name, warning)
+	}
+	task.ScheduleWarning = warning
+	m.persist()
 	m.mu.Unlock()
 
+	// 依赖本任务而被跳过的任务现在可以备份
+	if syncErr == nil {
+		m.runBlocked(name)
+	}
+
+	// 输出本次备份的统计信息，便于通过日志了解备份情况
+	log.Printf("[Task: %s] Backup summary: scanned=%d copied=%d deleted=%d unreadable=%d excluded=%d deduped=%d bytes=%d scan=%s copy=%s total=%s",
+		task.Name, stats.FilesScanned, stats.FilesCopied, stats.FilesDeleted, stats.FilesUnreadable, stats.FilesExcluded,
+		stats.FilesDeduped, stats.BytesTransferred, stats.ScanDuration.Round(time.Millisecond),
+		stats.CopyDuration.Round(time.Millisecond), stats.TotalDuration.Round(time.Millisecond))
+	if stats.FilesOrphaned > 0 {
+		log.Printf("[Task: %s] Kept %d files in target that are not in source (deletion disabled)",
+			task.Name, stats.FilesOrphaned)
+	}
+	if stats.CaseConflicts > 0 {
+		log.Printf("[Task: %s] Skipped %d files whose paths differ only in case from other files",
+			task.Name, stats.CaseConflicts)
+	}
+	if stats.PathsTooLong > 0 {
+		log.Printf("[Task: %s] Skipped %d files or directories whose paths in the target are too long",
+			task.Name, stats.PathsTooLong)
+	}
+	if stats.FilesExcluded > 0 || stats.DirsExcluded > 0 {
+		log.Printf("[Task: %s] Skipped %d files (%s) and %d directories by exclude rules",
+			task.Name, stats.FilesExcluded, formatSize(stats.BytesExcluded), stats.DirsExcluded)
+	}
+	if stats.FilesDeferred > 0 {
+		log.Printf("[Task: %s] Deferred %d recently modified files to a later backup",
+			task.Name, stats.FilesDeferred)
+	}
+
 	return nil
 }
+
+// performScrub re-hashes the files in each of a task's targets and compares
+// them with the hashes recorded by earlier backups, recopying corrupt files
+// from the source where it still holds the same content. A scrub that comes
+// due while a backup is running is skipped and retried later.
+func (m *Manager) performScrub(name string) error {
+	m.mu.Lock()
+	task := m.tasks[name]
+	if task == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("task %s does not exist", name)
+	}
+	if _, running := m.transfers[name]; running {
+		log.Printf("[Task: %s] Skipping scrub: %s", name, m.describeRun(name))
+		m.mu.Unlock()
+		return nil
+	}
+	opts, err := task.syncOptions()
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	transfer := &transferState{startedAt: time.Now(), scrub: true}
+	m.transfers[name] = transfer
+	targets := task.targets()
+	m.mu.Unlock()
+
+	log.Printf("[Task: %s] Starting scrub of %s", name, strings.Join(targets, ", "))
+	opts.SharedLimiter = m.limiter
+	var result ScrubResult
+	var scrubErr error
+	for i, target := range targets {
+		opts.TargetPath = target
+		opts.TargetCacheFile = m.targetCacheFile(name, i, target)
+		targetResult, err := scrubTarget(context.Background(), opts)
+		result.add(targetResult)
+		if err != nil {
+			log.Printf("[Task: %s] Scrub of %s failed: %v", name, target, err)
+			if scrubErr == nil {
+				scrubErr = err
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.transfers, name)
+	event := Event{Type: EventScrubbed, Task: name, Status: task.Status}
+	if scrubErr == nil {
+		task.LastScrub = time.Now()
+		task.ScrubCorrupt, task.ScrubRepaired = len(result.Corrupt), result.Repaired
+		if len(result.Corrupt) > 0 {
+			event.Error = fmt.Sprintf("%d corrupt files, %d repaired", len(result.Corrupt), result.Repaired)
+		}
+		m.persist()
+	} else {
+		event.Error = scrubErr.Error()
+	}
+	m.events.publish(event)
+
+	log.Printf("[Task: %s] Scrub summary: checked=%d changed=%d missing=%d corrupt=%d repaired=%d",
+		name, result.Checked, result.Changed, result.Missing, len(result.Corrupt), result.Repaired)
+	return scrubErr
+}
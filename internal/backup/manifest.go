@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// sourceManifestVersion 源目录清单文件格式的版本，格式发生不兼容的变化时递增
+const sourceManifestVersion = 1
+
+// manifestSettleTime 修改时间距扫描开始不足该时长的目录下次扫描时不复用
+// 同一时刻内的后续修改可能不会再改变目录的修改时间，下次扫描无法察觉
+const manifestSettleTime = 2 * time.Second
+
+// sourceManifest 源目录清单：上次扫描时每个目录的修改时间和其中文件的信息
+// 目录的修改时间只在其中的条目被创建、删除或重命名时改变，修改时间未变的目录可以直接复用记录的文件，
+// 不再读取目录和文件的元数据；文件被原地修改时目录的修改时间不变，这类修改要等到完整备份或目录变化时才会发现
+type sourceManifest struct {
+	Version    int              `json:"version"`
+	SourcePath string           `json:"source_path"`
+	Exclude    []string         `json:"exclude,omitempty"`
+	MaxDepth   int              `json:"max_depth,omitempty"`
+	Dirs       map[string]int64 `json:"dirs"` // 目录的相对路径 -> 修改时间（纳秒），为 -1 时每次都重新读取
+	Files      hashCache        `json:"files"`
+
+	files   map[string][]string // 目录 -> 其中文件的相对路径，加载时生成
+	subdirs map[string][]string // 目录 -> 其中子目录的相对路径，加载时生成
+}
+
+// loadSourceManifest 加载同步 opts 的源目录清单
+// 文件不存在、损坏或属于其他源目录和扫描设置时返回 nil，本次扫描读取所有文件
+func loadSourceManifest(path string, opts SyncOptions) *sourceManifest {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read source manifest %s: %v", path, err)
+		}
+		return nil
+	}
+
+	var manifest sourceManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		log.Printf("Ignoring corrupt source manifest %s: %v", path, err)
+		return nil
+	}
+	switch {
+	case manifest.Version != sourceManifestVersion:
+		log.Printf("Ignoring source manifest %s: format version %d is not supported, rescanning", path, manifest.Version)
+		return nil
+	case manifest.SourcePath != filepath.Clean(opts.SourcePath):
+		log.Printf("Ignoring source manifest %s: it was built for %s, rescanning", path, manifest.SourcePath)
+		return nil
+	case !slices.Equal(manifest.Exclude, opts.Exclude) || manifest.MaxDepth != opts.MaxDepth:
+		log.Printf("Ignoring source manifest %s: the scan settings have changed, rescanning", path)
+		return nil
+	}
+
+	manifest.files = make(map[string][]string)
+	manifest.subdirs = make(map[string][]string)
+	for relPath := range manifest.Files {
+		dir := filepath.Dir(relPath)
+		manifest.files[dir] = append(manifest.files[dir], relPath)
+	}
+	for relPath := range manifest.Dirs {
+		// 不复用的目录也要记录，复用其上级目录时仍需扫描它们
+		if relPath != "." {
+			dir := filepath.Dir(relPath)
+			manifest.subdirs[dir] = append(manifest.subdirs[dir], relPath)
+		}
+	}
+	return &manifest
+}
+
+// unchanged 返回目录的修改时间是否与清单中记录的相同
+func (m *sourceManifest) unchanged(relDir string, info os.FileInfo) bool {
+	modTime, ok := m.Dirs[relDir]
+	return ok && modTime >= 0 && modTime == info.ModTime().UnixNano()
+}
+
+// saveSourceManifest 根据扫描结果写入源目录清单
+// dirs 为扫描到的目录及其修改时间，其中的 volatile 目录和刚修改过的目录下次扫描时重新读取
+func saveSourceManifest(path string, opts SyncOptions, files map[string]*FileInfo, dirs map[string]int64,
+	volatile map[string]bool, scanStart time.Time) error {
+	manifest := sourceManifest{
+		Version:    sourceManifestVersion,
+		SourcePath: filepath.Clean(opts.SourcePath),
+		Exclude:    opts.Exclude,
+		MaxDepth:   opts.MaxDepth,
+		Dirs:       make(map[string]int64, len(dirs)),
+		Files:      newHashCache(files),
+	}
+	settled := scanStart.Add(-manifestSettleTime).UnixNano()
+	for relDir, modTime := range dirs {
+		if volatile[relDir] || modTime >= settled {
+			modTime = -1
+		}
+		manifest.Dirs[relDir] = modTime
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + tmpSuffix
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PathMapping 把相对于源目录的路径前缀（如 "src"）改写为目标中的另一个前缀（如 "archive/source"）
+// 前缀按完整的路径组成部分匹配
+type PathMapping struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// pathMapper 按顺序排列的路径映射规则，每个路径只应用第一条匹配的规则
+type pathMapper []PathMapping
+
+// checkPathMap 检查映射规则：两端都必须是目标目录之内的相对路径，且同一前缀只能映射一次
+func checkPathMap(rules []PathMapping) error {
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		for _, p := range []string{rule.From, rule.To} {
+			clean := filepath.Clean(p)
+			if p == "" || clean == "." || filepath.IsAbs(p) || clean == ".." ||
+				strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("invalid path mapping %s=%s: both sides must be relative paths below the directory", rule.From, rule.To)
+			}
+		}
+		from := filepath.Clean(rule.From)
+		if seen[from] {
+			return fmt.Errorf("duplicate path mapping for %s", rule.From)
+		}
+		seen[from] = true
+	}
+	return nil
+}
+
+// reversed 返回反向的映射规则，用于从按映射布局保存的目录拉取
+func (m pathMapper) reversed() pathMapper {
+	result := make(pathMapper, len(m))
+	for i, rule := range m {
+		result[i] = PathMapping{From: rule.To, To: rule.From}
+	}
+	return result
+}
+
+// apply 将相对路径中第一条匹配的前缀替换为映射后的前缀，没有匹配的规则时原样返回
+func (m pathMapper) apply(relPath string) string {
+	for _, rule := range m {
+		from := filepath.Clean(rule.From)
+		if relPath == from {
+			return filepath.Clean(rule.To)
+		}
+		if rest, ok := strings.CutPrefix(relPath, from+string(filepath.Separator)); ok {
+			return filepath.Join(rule.To, rest)
+		}
+	}
+	return relPath
+}
+
+// applyAll 映射路径列表中的每个路径
+func (m pathMapper) applyAll(paths []string) []string {
+	result := make([]string, len(paths))
+	for i, relPath := range paths {
+		result[i] = m.apply(relPath)
+	}
+	return result
+}
+
+// mapFiles 将源文件的相对路径映射为目标中的路径
+// 映射后路径的上级目录不在源目录中时补充为目录，使它们在目标中被创建且不会被当作孤立文件删除；
+// 两个源文件映射到同一路径时返回错误
+func (m pathMapper) mapFiles(files map[string]*FileInfo) (map[string]*FileInfo, error) {
+	mapped := make(map[string]*FileInfo, len(files))
+	from := make(map[string]string, len(files))
+	var implied []string
+	for relPath, file := range files {
+		target := m.apply(relPath)
+		if other, exists := from[target]; exists {
+			return nil, fmt.Errorf("path mapping maps both %s and %s to %s", other, relPath, target)
+		}
+		mapped[target], from[target] = file, relPath
+		if target != relPath {
+			implied = append(implied, target)
+		}
+	}
+
+	for _, target := range implied {
+		for dir := filepath.Dir(target); dir != "."; dir = filepath.Dir(dir) {
+			if existing, exists := mapped[dir]; exists {
+				if !existing.IsDir {
+					return nil, fmt.Errorf("path mapping places %s below the file %s", from[target], from[dir])
+				}
+				break
+			}
+			mapped[dir] = &FileInfo{IsDir: true}
+		}
+	}
+	return mapped, nil
+}
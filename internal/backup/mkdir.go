@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// 创建目录遇到暂时性错误时的重试次数和首次重试前的等待时间（之后逐次增加）
+const (
+	mkdirRetries    = 3
+	mkdirRetryDelay = 200 * time.Millisecond
+)
+
+// dirMaker 在一次同步中创建目标目录，已创建或确认存在的目录不再重复调用 MkdirAll
+type dirMaker struct {
+	created map[string]bool
+}
+
+func newDirMaker() *dirMaker {
+	return &dirMaker{created: make(map[string]bool)}
+}
+
+// mkdirAll 创建目录及其父目录，网络文件系统上的暂时性错误会短暂等待后重试
+func (d *dirMaker) mkdirAll(ctx context.Context, path string) error {
+	if d.created[path] {
+		return nil
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = os.MkdirAll(path, 0755)
+		if err == nil || attempt > mkdirRetries || !isTransient(err) {
+			break
+		}
+		log.Printf("Retrying creation of %s after transient error: %v", path, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(mkdirRetryDelay * time.Duration(attempt)):
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// MkdirAll 成功说明所有父目录也已存在
+	for dir := path; !d.created[dir]; dir = filepath.Dir(dir) {
+		d.created[dir] = true
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return nil
+}
+
+// isTransient 判断文件系统错误是否可能在短暂等待后自行消失，常见于网络文件系统
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) ||
+		errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.ESTALE)
+}
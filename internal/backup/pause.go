@@ -0,0 +1,84 @@
+package backup
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// waitFunc 同步被暂停时阻塞到恢复，ctx 被取消时返回错误
+type waitFunc func(ctx context.Context) error
+
+// pauseGate 暂停和恢复正在进行的备份的复制
+// 暂停后复制在下一个文件开始前或当前文件的下一次读取时阻塞，恢复后从原处继续，已复制的部分不受影响
+type pauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // 暂停时不为 nil，恢复时关闭
+	since   time.Time     // 暂停的开始时间
+	timer   *time.Timer   // 到期后自动恢复的定时器
+}
+
+// pause 暂停复制，d 大于 0 时到期后自动恢复并调用 onExpire；已经暂停时返回 false
+func (g *pauseGate) pause(d time.Duration, onExpire func()) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	g.since = time.Now()
+	if d > 0 {
+		g.timer = time.AfterFunc(d, func() {
+			if g.resume() {
+				onExpire()
+			}
+		})
+	}
+	return true
+}
+
+// resume 恢复复制，没有暂停时返回 false
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	return true
+}
+
+// pausedSince 返回暂停的开始时间，没有暂停时返回零值
+func (g *pauseGate) pausedSince() time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed == nil {
+		return time.Time{}
+	}
+	return g.since
+}
+
+// wait 暂停时阻塞到恢复或 ctx 被取消
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
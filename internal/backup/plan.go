@@ -0,0 +1,25 @@
+package backup
+
+import "sort"
+
+// 同步计划中的操作
+const (
+	PlanAdd    = "+" // 目标中不存在，将被复制
+	PlanChange = "~" // 内容不同，将被覆盖
+	PlanDelete = "-" // 源目录中已不存在，将从目标中删除
+)
+
+// PlanEntry 试运行时记录的同步将对目标做的一项修改
+type PlanEntry struct {
+	Target     string `json:"target"`
+	Action     string `json:"action"`
+	Path       string `json:"path"`
+	IsDir      bool   `json:"is_dir,omitempty"`
+	Size       int64  `json:"size"`                  // 复制时为源文件大小，删除时为目标文件大小
+	TargetSize int64  `json:"target_size,omitempty"` // 覆盖前目标文件的大小
+}
+
+// sortPlan 按路径排序，使同一计划的输出稳定
+func sortPlan(plan []PlanEntry) {
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Path < plan[j].Path })
+}
@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// probeSizes 探测目标时写入和读取的文件大小
+var probeSizes = []int64{4 << 10, 1 << 20, 16 << 20}
+
+// probeGranularities 依次尝试的修改时间精度，从细到粗
+var probeGranularities = []time.Duration{
+	time.Nanosecond, time.Microsecond, time.Millisecond, 10 * time.Millisecond,
+	100 * time.Millisecond, time.Second, 2 * time.Second,
+}
+
+// ProbeResult 在目标上写入、读取和删除一个指定大小的文件的实测性能
+type ProbeResult struct {
+	Size      int64         `json:"size"`
+	Write     time.Duration `json:"write"` // 包括 fsync
+	Read      time.Duration `json:"read"`
+	Delete    time.Duration `json:"delete"`
+	WriteRate float64       `json:"write_rate"` // 字节/秒
+	ReadRate  float64       `json:"read_rate"`  // 字节/秒
+}
+
+// ProbeReport 描述目标目录是否适合备份
+type ProbeReport struct {
+	Path    string        `json:"path"`
+	FSType  string        `json:"fs_type,omitempty"`
+	Results []ProbeResult `json:"results"`
+	// MtimePreserved 目标能否保存复制时设置的修改时间
+	MtimePreserved bool `json:"mtime_preserved"`
+	// MtimeGranularity 目标保存修改时间的精度，MtimePreserved 为 false 时为 0
+	MtimeGranularity time.Duration `json:"mtime_granularity"`
+	// MtimePrecision 备份时自动选择的修改时间比较精度
+	MtimePrecision time.Duration `json:"mtime_precision"`
+	Warnings       []string      `json:"warnings,omitempty"`
+}
+
+// ProbeTarget 检查目标目录是否可写，并测量其延迟、吞吐量和修改时间精度
+// 测试在目标中的一个临时隐藏目录里进行，结束后删除
+func ProbeTarget(path string) (*ProbeReport, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("target %s is not accessible: %v", path, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("target %s is not a directory", path)
+	}
+
+	// 以 . 开头的目录不会被扫描，即使探测中断也不会被当作备份内容
+	dir, err := os.MkdirTemp(path, ".watchman-probe-")
+	if err != nil {
+		return nil, fmt.Errorf("target %s is not writable: %v", path, err)
+	}
+	defer os.RemoveAll(dir)
+
+	report := &ProbeReport{Path: path}
+	report.FSType, report.MtimePrecision = detectMtimePrecision(path)
+
+	for i, size := range probeSizes {
+		result, err := probeFile(filepath.Join(dir, fmt.Sprintf("probe-%d", i)), size)
+		if err != nil {
+			return nil, err
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	granularity, err := probeMtime(filepath.Join(dir, "mtime"))
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("cannot set modification times: %v", err))
+	}
+	report.MtimePreserved = granularity > 0
+	report.MtimeGranularity = granularity
+
+	switch {
+	case !report.MtimePreserved && err == nil:
+		report.Warnings = append(report.Warnings,
+			"modification times are not preserved; backups compare files by hash and will still work, but every run updates the target's timestamps")
+	case granularity > report.MtimePrecision:
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"modification times are stored with %s granularity but backups would compare them with %s precision; set -mtime-precision %s to avoid re-touching every file on each run",
+			granularity, report.MtimePrecision, granularity))
+	}
+
+	return report, nil
+}
+
+// probeFile 写入、读取并删除一个 size 字节的文件，测量各自的耗时
+func probeFile(path string, size int64) (ProbeResult, error) {
+	result := ProbeResult{Size: size}
+
+	// 随机内容避免文件系统压缩或去重影响测量
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return result, err
+	}
+
+	start := time.Now()
+	file, err := os.Create(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to create probe file: %v", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return result, fmt.Errorf("failed to write probe file: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return result, fmt.Errorf("failed to sync probe file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return result, fmt.Errorf("failed to write probe file: %v", err)
+	}
+	result.Write = time.Since(start)
+
+	// 刚写入的文件通常仍在页缓存中，本地目标的读取速度会偏高
+	start = time.Now()
+	file, err = os.Open(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to open probe file: %v", err)
+	}
+	n, err := io.Copy(io.Discard, file)
+	file.Close()
+	if err != nil {
+		return result, fmt.Errorf("failed to read probe file: %v", err)
+	}
+	if n != size {
+		return result, fmt.Errorf("probe file read back %d bytes, wrote %d", n, size)
+	}
+	result.Read = time.Since(start)
+
+	start = time.Now()
+	if err := os.Remove(path); err != nil {
+		return result, fmt.Errorf("failed to delete probe file: %v", err)
+	}
+	result.Delete = time.Since(start)
+
+	result.WriteRate = float64(size) / result.Write.Seconds()
+	result.ReadRate = float64(size) / result.Read.Seconds()
+	return result, nil
+}
+
+// probeMtime 设置一个带小数秒的奇数秒修改时间并读回，返回目标保存修改时间的精度
+// 读回的时间与设置的时间相差过大（如被替换为当前时间）时返回 0
+func probeMtime(path string) (time.Duration, error) {
+	if err := os.WriteFile(path, []byte("mtime"), 0644); err != nil {
+		return 0, err
+	}
+
+	want := time.Date(2001, 1, 1, 0, 0, 1, 123456789, time.UTC)
+	if err := os.Chtimes(path, want, want); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	got := info.ModTime()
+	diff := got.Sub(want)
+	if diff < 0 {
+		diff = -diff
+	}
+	for _, granularity := range probeGranularities {
+		if got.UnixNano()%int64(granularity) == 0 && diff < granularity {
+			return granularity, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,83 @@
+package backup
+
+// Phase 同步所处的阶段
+type Phase string
+
+// 同步的各个阶段，按先后顺序排列；同步到多个目标时，目标相关的阶段对每个目标重复一次
+const (
+	PhaseScanSource Phase = "scan_source" // 扫描源目录并计算哈希值
+	PhaseScanTarget Phase = "scan_target" // 扫描目标目录
+	PhaseCopy       Phase = "copy"        // 复制新增和变化的文件
+	PhaseDelete     Phase = "delete"      // 删除目标中源目录已不存在的文件
+	PhaseDedup      Phase = "dedup"       // 对目标中的重复文件去重
+	PhaseDone       Phase = "done"        // 同步完成
+)
+
+// ProgressReporter 接收同步发出的结构化进度事件
+// 方法在执行同步的协程中调用，应当尽快返回
+type ProgressReporter interface {
+	// OnPhase 进入新的阶段时调用
+	OnPhase(phase Phase)
+	// OnFile 开始复制一个文件时调用，relPath 为相对于源目录的路径，n 为该文件在本次需要复制的 total 个文件中的序号（从 1 开始）
+	// 流式同步事先不知道总数，以下方法的 total 均为 0
+	OnFile(relPath string, n, total int)
+	// OnBytes 复制过程中调用，done 为已写入的字节数，total 为需要复制的总字节数
+	OnBytes(done, total int64)
+	// OnProgress 每处理完一个需要同步的文件后调用，percent 为完成的百分比；流式同步只在完成时以 100 调用
+	OnProgress(percent float64)
+	// OnDelete 删除阶段每删除一个条目后调用，done 为已删除的条目数，total 为需要删除的条目数
+	OnDelete(done, total int)
+}
+
+// ProgressFuncs 把普通的回调函数适配为 ProgressReporter
+// 为 nil 的回调会被跳过，调用者只需设置关心的事件
+type ProgressFuncs struct {
+	Phase    func(phase Phase)
+	File     func(relPath string, n, total int)
+	Bytes    func(done, total int64)
+	Progress func(percent float64)
+	Delete   func(done, total int)
+}
+
+// OnPhase 实现 ProgressReporter
+func (f ProgressFuncs) OnPhase(phase Phase) {
+	if f.Phase != nil {
+		f.Phase(phase)
+	}
+}
+
+// OnFile 实现 ProgressReporter
+func (f ProgressFuncs) OnFile(relPath string, n, total int) {
+	if f.File != nil {
+		f.File(relPath, n, total)
+	}
+}
+
+// OnBytes 实现 ProgressReporter
+func (f ProgressFuncs) OnBytes(done, total int64) {
+	if f.Bytes != nil {
+		f.Bytes(done, total)
+	}
+}
+
+// OnProgress 实现 ProgressReporter
+func (f ProgressFuncs) OnProgress(percent float64) {
+	if f.Progress != nil {
+		f.Progress(percent)
+	}
+}
+
+// OnDelete 实现 ProgressReporter
+func (f ProgressFuncs) OnDelete(done, total int) {
+	if f.Delete != nil {
+		f.Delete(done, total)
+	}
+}
+
+// reporter 返回同步使用的进度接收者，未设置时丢弃所有事件
+func (opts SyncOptions) reporter() ProgressReporter {
+	if opts.Progress != nil {
+		return opts.Progress
+	}
+	return ProgressFuncs{}
+}
@@ -0,0 +1,105 @@
+package backup
+
+import (
+	"slices"
+	"sort"
+	"sync"
+)
+
+// backupQueue 限制同时进行的备份数，limit 为 0 时不限制
+// 名额已满时备份排队等待，空出名额时优先启动优先级最高的任务，优先级相同时按排队的先后顺序
+type backupQueue struct {
+	mu      sync.Mutex
+	limit   int
+	active  map[string]bool // 占用名额的任务
+	waiting []*queuedBackup // 等待中的任务，按启动顺序排列
+}
+
+// queuedBackup 一个等待名额的备份
+type queuedBackup struct {
+	name     string
+	priority int
+	ready    chan struct{} // 获得名额时关闭
+}
+
+func newBackupQueue(limit int) *backupQueue {
+	return &backupQueue{
+		limit:  limit,
+		active: make(map[string]bool),
+	}
+}
+
+// enqueue 为任务申请一个名额。有空闲名额时立即获得，position 为 0；
+// 否则按优先级插入等待队列，position 为排队的位置（从 1 开始），ready 关闭时获得名额
+// 任务已在排队或已占用名额时 ok 为 false。获得名额后必须调用 release 归还
+func (q *backupQueue) enqueue(name string, priority int) (ready <-chan struct{}, position int, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.active[name] || q.indexOf(name) >= 0 {
+		return nil, 0, false
+	}
+
+	entry := &queuedBackup{name: name, priority: priority, ready: make(chan struct{})}
+	if q.free() && len(q.waiting) == 0 {
+		q.active[name] = true
+		close(entry.ready)
+		return entry.ready, 0, true
+	}
+
+	// 插入到第一个优先级更低的任务之前，优先级相同的任务保持排队顺序
+	i := sort.Search(len(q.waiting), func(i int) bool {
+		return q.waiting[i].priority < priority
+	})
+	q.waiting = slices.Insert(q.waiting, i, entry)
+	return entry.ready, i + 1, true
+}
+
+// release 归还任务占用的名额，并把空出的名额交给排在最前面的等待任务
+func (q *backupQueue) release(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.active, name)
+	q.dispatch()
+}
+
+// resize 修改名额的上限，名额增加时立即启动等待中的任务；减少时正在进行的备份不受影响，
+// 之后的备份等到占用的名额少于新的上限时才开始
+func (q *backupQueue) resize(limit int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.limit = limit
+	q.dispatch()
+}
+
+// free 判断是否还有空闲的名额
+func (q *backupQueue) free() bool {
+	return q.limit <= 0 || len(q.active) < q.limit
+}
+
+// dispatch 把空闲的名额按顺序交给等待中的任务
+func (q *backupQueue) dispatch() {
+	for q.free() && len(q.waiting) > 0 {
+		next := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.active[next.name] = true
+		close(next.ready)
+	}
+}
+
+// position 返回任务在等待队列中的位置（从 1 开始）和等待的任务数，任务未在排队时位置为 0
+func (q *backupQueue) position(name string) (int, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.indexOf(name) + 1, len(q.waiting)
+}
+
+// indexOf 返回任务在等待队列中的下标，未在排队时返回 -1
+func (q *backupQueue) indexOf(name string) int {
+	return slices.IndexFunc(q.waiting, func(entry *queuedBackup) bool {
+		return entry.name == name
+	})
+}
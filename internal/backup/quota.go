@@ -0,0 +1,42 @@
+package backup
+
+import "fmt"
+
+// projectTarget 计算同步完成后目标中的文件数和字节数
+// 源目录中的文件都会出现在目标中；其余目标文件只有 remains 返回 true 时才保留
+// 大小按源文件计算，启用压缩时会高估目标实际占用的空间
+func projectTarget(sourceFiles, targetFiles map[string]*FileInfo, remains func(relPath string) bool) (int, int64) {
+	var files int
+	var bytes int64
+	for _, file := range sourceFiles {
+		if !file.IsDir {
+			files++
+			bytes += file.Size
+		}
+	}
+	for relPath, file := range targetFiles {
+		if file.IsDir {
+			continue
+		}
+		if _, exists := sourceFiles[relPath]; exists || !remains(relPath) {
+			continue
+		}
+		files++
+		bytes += file.Size
+	}
+	return files, bytes
+}
+
+// checkQuota 检查同步完成后的目标是否超出配额
+// 超出配额需要调整配额或清理源目录，重试无法解决
+func checkQuota(files int, bytes int64, opts SyncOptions) error {
+	if opts.MaxTargetFiles > 0 && files > opts.MaxTargetFiles {
+		return &fatalError{fmt.Errorf("target quota exceeded: backup would leave %d files in %s, limit is %d",
+			files, opts.TargetPath, opts.MaxTargetFiles)}
+	}
+	if opts.MaxTargetBytes > 0 && bytes > opts.MaxTargetBytes {
+		return &fatalError{fmt.Errorf("target quota exceeded: backup would leave %s in %s, limit is %s",
+			formatSize(bytes), opts.TargetPath, formatSize(opts.MaxTargetBytes))}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package backup
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone FICLONE ioctl 的请求号
+const ficlone = 0x40049409
+
+// cloneFile 通过 FICLONE 让 dst 与 src 共享数据块（写时复制）
+// 文件系统不支持或两个文件不在同一文件系统上时返回错误
+func cloneFile(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package backup
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile 当前平台不支持克隆，总是回退到普通复制
+func cloneFile(dst, src *os.File) error {
+	return errors.ErrUnsupported
+}
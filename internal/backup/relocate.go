@@ -0,0 +1,158 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RelocateResult 描述 RelocateConfig 复制或移动的配置文件
+type RelocateResult struct {
+	Tasks     int              // 写入新配置文件的任务数
+	Files     []string         // 随配置文件一起复制的缓存文件和审计日志（新位置的路径）
+	Migration *ConfigMigration // 旧配置文件的格式升级，不需要升级时为 nil
+	Removed   bool             // 是否已删除旧配置文件及其缓存
+}
+
+// RelocateConfig 把配置文件从 from 复制到 to，连同其旁边的任务缓存和审计日志，
+// 使以新配置路径启动的守护进程从旧守护进程停下的地方继续。先校验每个任务，
+// 任一任务有问题或 to 已存在时不写入任何文件。删除任何文件之前先读回新文件校验；
+// move 时最后才删除旧的配置文件及其缓存
+func RelocateConfig(from, to string, move bool) (*RelocateResult, error) {
+	if resolvePath(from) == resolvePath(to) {
+		return nil, fmt.Errorf("%s and %s are the same file", from, to)
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return nil, fmt.Errorf("%s already exists, refusing to overwrite it", to)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// 任何任务有问题时不写入，避免新的守护进程加载时丢弃它
+	reports, _, err := ValidateConfig(from)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for i, report := range reports {
+		name := report.Name
+		if name == "" {
+			name = fmt.Sprintf("(task #%d)", i+1)
+		}
+		for _, problem := range report.Problems {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, problem))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("config file %s has problems, fix them first: %s", from, strings.Join(problems, "; "))
+	}
+
+	file, migration, err := readConfig(from)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(taskFile{SchemaVersion: SchemaVersion, Globals: file.Globals, Tasks: file.Tasks}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tasks: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %v", err)
+	}
+	if err := os.WriteFile(to, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write config file: %v", err)
+	}
+
+	// 读回新配置文件，确认守护进程能够加载
+	written, _, err := readConfig(to)
+	if err == nil && len(written.Tasks) != len(file.Tasks) {
+		err = fmt.Errorf("read back %d tasks, expected %d", len(written.Tasks), len(file.Tasks))
+	}
+	if err != nil {
+		os.Remove(to)
+		return nil, fmt.Errorf("failed to verify %s: %v", to, err)
+	}
+
+	result := &RelocateResult{Tasks: len(file.Tasks), Migration: migration}
+
+	// 缓存和审计日志位于配置文件所在目录，目录相同时无需复制
+	var copied []string
+	if resolvePath(filepath.Dir(from)) != resolvePath(filepath.Dir(to)) {
+		for _, pair := range stateFiles(from, to, file.Tasks) {
+			ok, err := copyStateFile(pair[0], pair[1])
+			if err != nil {
+				return result, fmt.Errorf("failed to copy %s: %v", pair[0], err)
+			}
+			if ok {
+				copied = append(copied, pair[0])
+				result.Files = append(result.Files, pair[1])
+			}
+		}
+	}
+
+	if move {
+		for _, path := range append(copied, from) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return result, fmt.Errorf("failed to remove %s: %v", path, err)
+			}
+		}
+		result.Removed = true
+	}
+	return result, nil
+}
+
+// stateFiles 返回配置文件 from 旁边的任务缓存和默认的审计日志，每个都与其在 to 旁边的路径配对
+func stateFiles(from, to string, tasks []BackupTask) [][2]string {
+	// 只用于按守护进程的规则计算缓存路径
+	src, dst := &Manager{configFile: from}, &Manager{configFile: to}
+
+	var pairs [][2]string
+	for i := range tasks {
+		task := &tasks[i]
+		for j, target := range task.targets() {
+			pairs = append(pairs, [2]string{src.targetCacheFile(task.Name, j, target), dst.targetCacheFile(task.Name, j, target)})
+		}
+		pairs = append(pairs, [2]string{src.sourceManifestFile(task.Name), dst.sourceManifestFile(task.Name)})
+	}
+	pairs = append(pairs, [2]string{
+		filepath.Join(filepath.Dir(from), "audit.log"),
+		filepath.Join(filepath.Dir(to), "audit.log"),
+	})
+	return pairs
+}
+
+// copyStateFile 复制一个缓存文件或审计日志，源文件不存在或目标已存在时返回 false
+func copyStateFile(src, dst string) (bool, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		// 新位置已有同名文件时保留它
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return false, err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,71 @@
+package backup
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultScanWorkers 未指定时扫描使用的工作协程数
+	defaultScanWorkers = 8
+	// maxAdaptiveScanWorkers 自适应扫描在未指定上限时最多使用的工作协程数
+	maxAdaptiveScanWorkers = 32
+	// scaleInterval 自适应扫描调整工作协程数的周期
+	scaleInterval = 250 * time.Millisecond
+)
+
+// scanScaler 根据扫描吞吐量和单个文件的处理耗时调整工作协程数：
+// 吞吐量仍在提升时增加协程，耗时明显上升（如网络挂载已饱和）而吞吐量没有提升时减少协程
+type scanScaler struct {
+	max     int
+	workers int
+	done    atomic.Int64 // 已处理的文件数
+	busy    atomic.Int64 // 处理文件的总耗时（纳秒）
+}
+
+// record 记录一个文件的处理耗时
+func (s *scanScaler) record(d time.Duration) {
+	s.done.Add(1)
+	s.busy.Add(int64(d))
+}
+
+// run 周期性地调整工作协程数，直到 stop 被关闭
+// add 启动一个新的工作协程，remove 让一个工作协程退出
+func (s *scanScaler) run(stop <-chan struct{}, add, remove func()) {
+	ticker := time.NewTicker(scaleInterval)
+	defer ticker.Stop()
+
+	var lastDone, lastBusy int64
+	var lastRate float64
+	var baseLatency time.Duration
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		done, busy := s.done.Load(), s.busy.Load()
+		n := done - lastDone
+		if n == 0 {
+			// 没有进度时（如正在遍历大目录）不调整
+			continue
+		}
+		rate := float64(n) / scaleInterval.Seconds()
+		latency := time.Duration((busy - lastBusy) / n)
+		lastDone, lastBusy = done, busy
+		if baseLatency == 0 || latency < baseLatency {
+			baseLatency = latency
+		}
+
+		switch {
+		case latency > 4*baseLatency && rate <= lastRate && s.workers > 1:
+			remove()
+			s.workers--
+		case rate > lastRate*1.1 && s.workers < s.max:
+			add()
+			s.workers++
+		}
+		lastRate = rate
+	}
+}
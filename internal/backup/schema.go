@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SchemaVersion 当前配置文件格式的版本，格式或字段的含义发生变化时递增，并在 migrations 中添加升级步骤
+// 版本 1 的配置文件是任务数组本身，没有记录版本
+const SchemaVersion = 2
+
+// taskFile 配置文件的内容
+type taskFile struct {
+	SchemaVersion int               `json:"schema_version"`
+	Globals       map[string]string `json:"globals,omitempty"` // 通过 SetGlobal 修改的全局设置
+	Tasks         []BackupTask      `json:"tasks"`
+}
+
+// ConfigMigration 描述旧版本 watchman 写入的配置文件在读取时如何升级
+type ConfigMigration struct {
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Changes []string `json:"changes,omitempty"` // 对各个任务所做的修改
+}
+
+// migration 将任务从版本 version-1 升级到 version，返回所做修改的说明
+type migration struct {
+	version int
+	migrate func(task *BackupTask) []string
+}
+
+// migrations 按版本排列的升级步骤，读取旧版本的配置文件时依次执行
+var migrations = []migration{
+	{version: 2, migrate: migrateV2},
+}
+
+// migrateV2 将带单位的间隔（如 "1h"、"30m"）换算为分钟数，并为缺少状态的任务补上默认状态
+func migrateV2(task *BackupTask) []string {
+	var changes []string
+	if _, err := strconv.Atoi(task.Schedule); err != nil {
+		if d, err := time.ParseDuration(task.Schedule); err == nil && d > 0 && d%time.Minute == 0 {
+			minutes := strconv.Itoa(int(d / time.Minute))
+			changes = append(changes, fmt.Sprintf("schedule %q converted to %s minutes", task.Schedule, minutes))
+			task.Schedule = minutes
+		}
+	}
+	if task.Status == "" {
+		changes = append(changes, fmt.Sprintf("missing status set to %s", StatusReady))
+		task.Status = StatusReady
+	}
+	return changes
+}
+
+// decodeTaskFile 解析配置文件的内容并升级到当前版本
+// 返回的 migration 在文件已是当前版本时为 nil；文件由更新的版本写入时返回错误，避免误解其中的字段
+func decodeTaskFile(data []byte) (*taskFile, *ConfigMigration, error) {
+	var file taskFile
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		file.SchemaVersion = 1
+		if err := json.Unmarshal(data, &file.Tasks); err != nil {
+			return nil, nil, err
+		}
+	} else if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case file.SchemaVersion > SchemaVersion:
+		return nil, nil, fmt.Errorf("schema version %d is newer than the supported version %d, upgrade watchman",
+			file.SchemaVersion, SchemaVersion)
+	case file.SchemaVersion < 1:
+		return nil, nil, fmt.Errorf("invalid schema version %d", file.SchemaVersion)
+	case file.SchemaVersion == SchemaVersion:
+		return &file, nil, nil
+	}
+
+	result := &ConfigMigration{From: file.SchemaVersion, To: SchemaVersion}
+	for _, step := range migrations {
+		if step.version <= file.SchemaVersion {
+			continue
+		}
+		for i := range file.Tasks {
+			task := &file.Tasks[i]
+			for _, change := range step.migrate(task) {
+				result.Changes = append(result.Changes, fmt.Sprintf("task %s: %s", task.Name, change))
+			}
+		}
+	}
+	return &file, result, nil
+}
+
+// backupOldConfig 升级前保留旧版本的配置文件，命名为 <配置文件>.v<版本>.bak
+func backupOldConfig(configFile string, version int) (string, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("%s.v%d.bak", configFile, version)
+	return path, os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,144 @@
+package backup
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scrubRetryDelay 校验到期时任务正在备份，或守护进程刚启动时，推迟校验的时长
+const scrubRetryDelay = 10 * time.Minute
+
+// ScrubResult 按之前备份记录的哈希值重新校验目标文件的结果
+type ScrubResult struct {
+	Checked  int      // 重新计算了哈希的文件数
+	Changed  int      // 大小或修改时间与记录不同而未校验的文件数，由下次备份处理
+	Missing  int      // 记录中存在但目标中已不存在的文件数
+	Corrupt  []string // 内容与记录的哈希不一致的文件，为目标中的路径
+	Repaired int      // 已从源目录重新复制的损坏文件数
+}
+
+// add 累加另一个目标的校验结果
+func (r *ScrubResult) add(other ScrubResult) {
+	r.Checked += other.Checked
+	r.Changed += other.Changed
+	r.Missing += other.Missing
+	r.Corrupt = append(r.Corrupt, other.Corrupt...)
+	r.Repaired += other.Repaired
+}
+
+// scrubTarget 按哈希缓存重新计算 opts.TargetPath 中文件的哈希，发现目标存储上的静默损坏
+// 只校验大小和修改时间与记录一致的文件，其他文件是被修改过的，不属于损坏
+// 源文件的内容仍与记录一致时从源目录重新复制损坏的文件；无法修复的文件从缓存中移除，
+// 下次备份会重新计算其哈希并按源目录覆盖或删除
+func scrubTarget(ctx context.Context, opts SyncOptions) (result ScrubResult, err error) {
+	defer func() {
+		err = ctxError(ctx, err)
+	}()
+
+	cache := loadHashCache(opts.TargetCacheFile, opts)
+	if len(cache) == 0 {
+		return result, nil
+	}
+
+	// 单个文件的源目录中只有该文件
+	single := false
+	if info, err := os.Stat(opts.SourcePath); err == nil && info.Mode().IsRegular() {
+		single = true
+	}
+
+	copyOpts := copyOptions{
+		limiter:       newRateLimiter(opts.RateLimit),
+		shared:        opts.SharedLimiter,
+		compress:      opts.Compress,
+		compressLevel: opts.CompressLevel,
+		fileMode:      opts.FileMode,
+	}
+
+	relPaths := make([]string, 0, len(cache))
+	for relPath := range cache {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+
+	for _, relPath := range relPaths {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		entry := cache[relPath]
+		targetFilePath := filepath.Join(opts.TargetPath, relPath)
+		info, err := os.Stat(targetFilePath)
+		if os.IsNotExist(err) {
+			result.Missing++
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if info.Size() != entry.Size || info.ModTime().Unix() != entry.ModTime {
+			result.Changed++
+			continue
+		}
+
+		hashFile := calculateHash
+		if opts.Compress && strings.HasSuffix(relPath, gzipSuffix) {
+			hashFile = calculateGzipHash
+		}
+		hash, err := hashFile(targetFilePath)
+		result.Checked++
+		if err == nil && hash == entry.Hash {
+			continue
+		}
+		if err != nil {
+			log.Printf("Scrub: failed to read %s: %v", targetFilePath, err)
+		} else {
+			log.Printf("Scrub: %s does not match its recorded hash", targetFilePath)
+		}
+		result.Corrupt = append(result.Corrupt, targetFilePath)
+
+		// 源文件的内容与备份时相同才重新复制，否则留给下次备份
+		sourceRel := relPath
+		if opts.Compress {
+			sourceRel = strings.TrimSuffix(relPath, gzipSuffix)
+		}
+		sourceFilePath := filepath.Join(opts.SourcePath, sourceRel)
+		if single {
+			sourceFilePath = opts.SourcePath
+		}
+		sourceInfo, err := os.Stat(sourceFilePath)
+		if err == nil && (!single || filepath.Base(opts.SourcePath) == sourceRel) {
+			var sourceHash string
+			if sourceHash, err = calculateHash(sourceFilePath); err == nil && sourceHash == entry.Hash {
+				if _, err = copyFile(ctx, sourceFilePath, targetFilePath, sourceInfo.ModTime().Unix(), sourceHash, copyOpts); err == nil {
+					if info, err = os.Stat(targetFilePath); err == nil {
+						cache[relPath] = cacheEntry{Size: info.Size(), ModTime: info.ModTime().Unix(), Hash: entry.Hash}
+						result.Repaired++
+						log.Printf("Scrub: repaired %s from %s", targetFilePath, sourceFilePath)
+						continue
+					}
+				}
+			}
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return result, ctxErr
+		}
+		if err != nil {
+			log.Printf("Scrub: cannot repair %s: %v", targetFilePath, err)
+		} else {
+			log.Printf("Scrub: cannot repair %s: the source has changed since the last backup", targetFilePath)
+		}
+		delete(cache, relPath)
+	}
+
+	if len(result.Corrupt) > 0 {
+		if err := cache.save(opts.TargetCacheFile, opts); err != nil {
+			log.Printf("Failed to save hash cache %s: %v", opts.TargetCacheFile, err)
+		}
+	}
+	return result, nil
+}
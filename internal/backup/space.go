@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkFreeSpace 检查目标所在文件系统的可用空间是否不低于 minFree 字节
+// 目标目录尚未创建时检查最近的已存在的上级目录；平台不支持时不做检查
+func checkFreeSpace(targetPath string, minFree int64) error {
+	if minFree <= 0 {
+		return nil
+	}
+
+	path := targetPath
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+
+	free, err := freeSpace(path)
+	if err != nil {
+		return nil
+	}
+	if free < uint64(minFree) {
+		return fmt.Errorf("below free-space floor: %s free on target, at least %s required",
+			formatSize(int64(free)), formatSize(minFree))
+	}
+	return nil
+}
+
+// formatSize 将字节数格式化为易读的形式
+func formatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
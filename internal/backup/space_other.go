@@ -0,0 +1,26 @@
+//go:build !linux && !darwin
+
+package backup
+
+import (
+	"errors"
+	"os"
+)
+
+// freeSpace 当前平台不支持查询可用空间
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// fileKey 唯一标识一个文件，当前平台不支持
+type fileKey struct{}
+
+// inodeKey 当前平台不支持识别硬链接
+func inodeKey(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
+
+// allocatedSize 当前平台按文件大小估算占用的磁盘空间
+func allocatedSize(info os.FileInfo) int64 {
+	return info.Size()
+}
@@ -0,0 +1,40 @@
+//go:build linux || darwin
+
+package backup
+
+import (
+	"os"
+	"syscall"
+)
+
+// freeSpace 返回 path 所在文件系统中非特权用户可用的字节数
+func freeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// fileKey 唯一标识一个文件的设备号和 inode 号
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+// inodeKey 返回文件的设备号和 inode 号
+func inodeKey(info os.FileInfo) (fileKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// allocatedSize 返回文件实际占用的磁盘空间
+func allocatedSize(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int64(st.Blocks) * 512
+	}
+	return info.Size()
+}
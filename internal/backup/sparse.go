@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"io"
+	"os"
+)
+
+// dataRegion 稀疏文件中一段有数据的区域，区域之间为空洞
+type dataRegion struct {
+	offset int64
+	length int64
+}
+
+// copySparse 只复制源文件中有数据的区域，跳过空洞使目标文件中的对应位置同样成为空洞
+// offset 之前的内容已在目标中（续传）；跳过的空洞通过 onHole 计入进度。返回实际写入的字节数
+// reader 从 source 的当前位置读取，如带取消和暂停检查的包装
+func copySparse(destination, source *os.File, reader io.Reader, writer io.Writer, regions []dataRegion,
+	offset, size int64, onHole func(n int64)) (int64, error) {
+	var written int64
+	pos := offset
+	for _, region := range regions {
+		start, end := max(region.offset, offset), region.offset+region.length
+		if start >= end {
+			continue
+		}
+		if onHole != nil && start > pos {
+			onHole(start - pos)
+		}
+
+		if _, err := source.Seek(start, io.SeekStart); err != nil {
+			return written, err
+		}
+		if _, err := destination.Seek(start, io.SeekStart); err != nil {
+			return written, err
+		}
+		n, err := io.CopyN(writer, reader, end-start)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		pos = end
+	}
+	if onHole != nil && size > pos {
+		onHole(size - pos)
+	}
+
+	// 末尾的空洞没有写入任何数据，需要把文件扩展到源文件的大小
+	return written, destination.Truncate(size)
+}
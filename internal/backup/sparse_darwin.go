@@ -0,0 +1,7 @@
+package backup
+
+// lseek 查找数据和空洞的 whence 参数，取值与 Linux 相反
+const (
+	seekHole = 3 // SEEK_HOLE
+	seekData = 4 // SEEK_DATA
+)
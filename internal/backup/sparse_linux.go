@@ -0,0 +1,7 @@
+package backup
+
+// lseek 查找数据和空洞的 whence 参数
+const (
+	seekData = 3 // SEEK_DATA
+	seekHole = 4 // SEEK_HOLE
+)
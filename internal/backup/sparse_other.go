@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package backup
+
+import "os"
+
+// sparseRegions 当前平台不支持查找空洞，总是按普通文件复制
+func sparseRegions(f *os.File) (regions []dataRegion, size int64, sparse bool) {
+	return nil, 0, false
+}
@@ -0,0 +1,50 @@
+//go:build linux || darwin
+
+package backup
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// sparseRegions 通过 SEEK_DATA 和 SEEK_HOLE 找出文件中有数据的区域及文件大小
+// 文件没有空洞、文件系统不支持或探测失败时 sparse 为 false，调用方按普通文件复制；文件的读写位置保持不变
+func sparseRegions(f *os.File) (regions []dataRegion, size int64, sparse bool) {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return nil, 0, false
+	}
+	size = info.Size()
+
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, false
+	}
+	defer f.Seek(pos, io.SeekStart)
+
+	for offset := int64(0); offset < size; {
+		data, err := f.Seek(offset, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			// offset 之后只剩空洞
+			break
+		}
+		if err != nil {
+			return nil, 0, false
+		}
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return nil, 0, false
+		}
+		hole = min(hole, size)
+		regions = append(regions, dataRegion{offset: data, length: hole - data})
+		offset = hole
+	}
+
+	// 不支持空洞的文件系统把整个文件报告为一段数据
+	if len(regions) == 1 && regions[0].offset == 0 && regions[0].length == size {
+		return nil, 0, false
+	}
+	return regions, size, true
+}
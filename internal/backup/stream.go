@@ -0,0 +1,551 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// checkStreaming 检查同步选项能否用于流式同步
+// 流式同步不保存完整的文件列表，需要完整列表的选项无法使用
+func (opts SyncOptions) checkStreaming() error {
+	var option string
+	switch {
+	case opts.Compress:
+		option = "compress"
+	case len(opts.PathMap) > 0:
+		option = "path map"
+	case opts.Dedup:
+		option = "dedup"
+	case opts.CaseInsensitiveTarget:
+		option = "case-insensitive target"
+	case opts.SkipTargetScan:
+		option = "skip target scan"
+	case opts.SourceManifestFile != "":
+		option = "incremental scan"
+	case opts.MaxTargetFiles > 0 || opts.MaxTargetBytes > 0:
+		option = "target quota"
+	case opts.QuiesceWindow > 0:
+		option = "quiesce window"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s cannot be used with streaming, it needs the full file list", option)
+}
+
+// streamSync 一次流式同步的状态
+type streamSync struct {
+	ctx           context.Context
+	opts          SyncOptions
+	progress      ProgressReporter
+	stats         *Summary
+	copyOpts      copyOptions
+	throttle      *deleteThrottle
+	modifiedAfter time.Time        // 不为零值时推迟在此之后修改的普通文件
+	ancestors     map[fileKey]bool // 当前路径上的源目录，用于识别指向它们而形成循环的符号链接
+	started       int              // 已开始复制的文件数
+	deleted       int              // 已删除的目标条目数
+}
+
+// streamTarget 以流式同步将 opts.SourcePath 同步到 opts.TargetPath：按路径顺序逐个目录归并比较源目录和目标目录，
+// 边比较边复制和删除，内存中只保存当前路径上各层目录的条目，而不是两棵树的完整文件列表
+// 大小和修改时间都相同的文件视为未变化，不计算哈希值；需要复制的文件数和字节数事先未知，进度汇报中的总数为 0
+func streamTarget(ctx context.Context, opts SyncOptions) (summary Summary, err error) {
+	if err := opts.checkStreaming(); err != nil {
+		return summary, err
+	}
+
+	// 单个文件没有需要节省的内存，按普通方式同步
+	info, statErr := os.Stat(opts.SourcePath)
+	if statErr == nil && info.Mode().IsRegular() {
+		scan, err := scanSource(ctx, opts)
+		if err != nil {
+			return scan.summary, err
+		}
+		return syncTarget(ctx, opts, scan)
+	}
+
+	start := time.Now()
+	defer func() {
+		// 扫描和复制交替进行，耗时都计入复制
+		summary.CopyDuration = time.Since(start)
+		summary.TotalDuration = summary.CopyDuration
+		err = ctxError(ctx, err)
+	}()
+
+	if statErr != nil {
+		return summary, fmt.Errorf("failed to scan source directory: %v", statErr)
+	}
+	targetPath := opts.TargetPath
+	if err := checkTarget(targetPath); err != nil {
+		return summary, err
+	}
+	if !opts.DryRun {
+		if err := newDirMaker().mkdirAll(ctx, targetPath); err != nil {
+			return summary, fmt.Errorf("failed to create target directory: %v", err)
+		}
+		// 流式同步不维护目标的哈希缓存，删除旧的缓存，以免之后的同步按过期的记录判断
+		if opts.TargetCacheFile != "" {
+			if err := os.Remove(opts.TargetCacheFile); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to remove hash cache %s: %v", opts.TargetCacheFile, err)
+			}
+		}
+	}
+
+	if opts.MtimePrecision <= 0 {
+		fsType, precision := detectMtimePrecision(targetPath)
+		if fsType != "" {
+			log.Printf("Detected %s filesystem on %s, using %s mtime precision", fsType, targetPath, precision)
+		}
+		opts.MtimePrecision = precision
+	}
+
+	s := &streamSync{
+		ctx:       ctx,
+		opts:      opts,
+		progress:  opts.reporter(),
+		stats:     &summary,
+		throttle:  newDeleteThrottle(opts.DeleteRate, opts.DeleteBatch),
+		ancestors: make(map[fileKey]bool),
+	}
+	if opts.MinFileAge > 0 {
+		s.modifiedAfter = start.Add(-opts.MinFileAge)
+	}
+	var bytesDone int64
+	s.copyOpts = copyOptions{
+		limiter:  newRateLimiter(opts.RateLimit),
+		shared:   opts.SharedLimiter,
+		reflink:  opts.Reflink,
+		fileMode: opts.FileMode,
+		wait:     opts.WaitIfPaused,
+		onWrite: func(n int64) {
+			bytesDone += n
+			s.progress.OnBytes(bytesDone, 0)
+		},
+	}
+	if key, ok := inodeKey(info); ok {
+		s.ancestors[key] = true
+	}
+
+	s.progress.OnPhase(PhaseCopy)
+	if err := s.syncDir("", 0, true); err != nil {
+		return summary, err
+	}
+
+	sortPlan(summary.Plan)
+	s.progress.OnProgress(100)
+	s.progress.OnPhase(PhaseDone)
+	return summary, nil
+}
+
+// streamTargets 依次以流式同步将源目录同步到每个目标，每个目标单独遍历一次源目录
+// 返回值和 configure 的含义与 runTargets 相同
+func streamTargets(ctx context.Context, opts SyncOptions, targets []string, configure func(i int, opts *SyncOptions) error) (Summary, []error) {
+	errs := make([]error, len(targets))
+	var total Summary
+	for i, target := range targets {
+		targetOpts := opts
+		targetOpts.TargetPath = target
+		if errs[i] = recoverTarget(func() error { return configure(i, &targetOpts) }); errs[i] != nil {
+			continue
+		}
+
+		var stats Summary
+		errs[i] = recoverTarget(func() (err error) {
+			stats, err = streamTarget(ctx, targetOpts)
+			return err
+		})
+		// 源目录的统计对每个目标相同，只计一次
+		total.FilesScanned = max(total.FilesScanned, stats.FilesScanned)
+		total.FilesUnreadable = max(total.FilesUnreadable, stats.FilesUnreadable)
+		total.FilesExcluded = max(total.FilesExcluded, stats.FilesExcluded)
+		total.DirsExcluded = max(total.DirsExcluded, stats.DirsExcluded)
+		total.BytesExcluded = max(total.BytesExcluded, stats.BytesExcluded)
+		total.FilesDeferred = max(total.FilesDeferred, stats.FilesDeferred)
+		total.PathsTooLong = max(total.PathsTooLong, stats.PathsTooLong)
+		total.FilesCopied += stats.FilesCopied
+		total.FilesDeleted += stats.FilesDeleted
+		total.FilesOrphaned += stats.FilesOrphaned
+		total.BytesTransferred += stats.BytesTransferred
+		total.Plan = append(total.Plan, stats.Plan...)
+		total.TargetFiles = max(total.TargetFiles, stats.TargetFiles)
+		total.TargetBytes = max(total.TargetBytes, stats.TargetBytes)
+		total.ScanDuration += stats.ScanDuration
+		total.CopyDuration += stats.CopyDuration
+		total.TotalDuration += stats.TotalDuration
+	}
+	return total, errs
+}
+
+// readStreamDir 按文件名顺序读取目录中参与同步的条目，跳过 . 开头的条目；
+// 上次中断留下的临时文件不参与同步，单独返回其文件名。目录不存在时返回空列表
+func readStreamDir(dir string) ([]os.DirEntry, []string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	kept := entries[:0]
+	var temps []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if !entry.IsDir() && strings.HasSuffix(name, tmpSuffix) {
+			temps = append(temps, name)
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept, temps, nil
+}
+
+// syncDir 归并比较源目录和目标目录中相对路径为 relDir 的目录，depth 为其层数（源目录本身为第 0 层）
+// inTarget 为 false 时目标中还没有该目录（试运行时不会创建），其内容都需要复制
+func (s *streamSync) syncDir(relDir string, depth int, inTarget bool) error {
+	sources, _, err := readStreamDir(filepath.Join(s.opts.SourcePath, relDir))
+	if err != nil {
+		// 无法读取的目录跳过其内容，目标中对应的内容保留不动
+		if s.opts.UnreadablePolicy != UnreadableFail && os.IsPermission(err) && relDir != "" {
+			log.Printf("Skipping unreadable file %s", filepath.Join(s.opts.SourcePath, relDir))
+			s.stats.FilesUnreadable++
+			return nil
+		}
+		return fmt.Errorf("failed to scan source directory: %v", err)
+	}
+	var targets []os.DirEntry
+	var temps []string
+	if inTarget {
+		if targets, temps, err = readStreamDir(filepath.Join(s.opts.TargetPath, relDir)); err != nil {
+			return fmt.Errorf("failed to scan target directory: %v", err)
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(sources) || j < len(targets) {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		switch {
+		case j == len(targets) || (i < len(sources) && sources[i].Name() < targets[j].Name()):
+			err = s.syncEntry(filepath.Join(relDir, sources[i].Name()), depth+1, false)
+			i++
+		case i == len(sources) || targets[j].Name() < sources[i].Name():
+			_, err = s.removeOrphan(filepath.Join(relDir, targets[j].Name()))
+			j++
+		default:
+			err = s.syncEntry(filepath.Join(relDir, sources[i].Name()), depth+1, true)
+			i++
+			j++
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// 源目录中已没有对应条目时，上次中断留下的临时文件不会再续传，随孤立条目一起删除
+	if !s.opts.DryRun {
+		return removeTemps(filepath.Join(s.opts.TargetPath, relDir), temps, func(name string) bool {
+			return !slices.ContainsFunc(sources, func(entry os.DirEntry) bool { return entry.Name() == name })
+		})
+	}
+	return nil
+}
+
+// syncEntry 同步源目录中的一个条目，inTarget 表示目标中已有同名条目
+func (s *streamSync) syncEntry(relPath string, depth int, inTarget bool) error {
+	opts := s.opts
+	sourcePath := filepath.Join(opts.SourcePath, relPath)
+	targetFilePath := filepath.Join(opts.TargetPath, relPath)
+
+	linkInfo, err := os.Lstat(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to scan source directory: %v", err)
+	}
+	info, err := os.Stat(sourcePath)
+	if err != nil && linkInfo.Mode()&os.ModeSymlink == 0 {
+		if opts.UnreadablePolicy != UnreadableFail && os.IsPermission(err) {
+			log.Printf("Skipping unreadable file %s", sourcePath)
+			s.stats.FilesUnreadable++
+			return nil
+		}
+		return fmt.Errorf("failed to scan source directory: %v", err)
+	}
+
+	// 被排除的文件和目录不参与备份，目标中已有的副本保留不动
+	if matchAny(relPath, opts.Exclude) {
+		if linkInfo.IsDir() {
+			s.stats.DirsExcluded++
+		} else {
+			s.stats.FilesExcluded++
+			s.stats.BytesExcluded += linkInfo.Size()
+		}
+		return nil
+	}
+
+	// 与完整扫描一样，无法解析的链接、形成循环的链接和特殊文件都不备份，目标中的同名条目按孤立条目处理
+	skip := ""
+	switch {
+	case err != nil:
+		skip = fmt.Sprintf("Skipping symlink %s: cannot resolve link: %v", sourcePath, err)
+	case linkInfo.Mode()&os.ModeSymlink != 0 && info.IsDir() && s.isAncestor(info):
+		skip = fmt.Sprintf("Skipping symlink %s: points to a directory being scanned, following it would create a cycle", sourcePath)
+	default:
+		if kind := specialFileKind(sourcePath, linkInfo); kind != "" {
+			skip = fmt.Sprintf("Skipping %s %s: only regular files and directories are backed up", kind, sourcePath)
+		}
+	}
+	if skip != "" {
+		log.Print(skip)
+		if inTarget {
+			_, err := s.removeOrphan(relPath)
+			return err
+		}
+		return nil
+	}
+
+	// 最近还在修改的文件推迟到之后的备份，目标中已有的旧副本保留不动
+	if !s.modifiedAfter.IsZero() && info.Mode().IsRegular() && info.ModTime().After(s.modifiedAfter) {
+		s.stats.FilesDeferred++
+		return nil
+	}
+
+	// 在目标中的路径超过系统限制时无法创建，跳过并报告，过长的目录中的内容不再读取
+	if err := pathTooLong(targetFilePath, info.IsDir()); err != nil {
+		log.Printf("Skipping %s: its path in the target is too long: %v", sourcePath, err)
+		s.stats.PathsTooLong++
+		return nil
+	}
+
+	if opts.WaitIfPaused != nil && !opts.DryRun {
+		if err := opts.WaitIfPaused(s.ctx); err != nil {
+			return err
+		}
+	}
+
+	var target os.FileInfo
+	if inTarget {
+		if target, err = os.Stat(targetFilePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to scan target directory: %v", err)
+		}
+	}
+	// 目标中同名的条目类型不同（文件与目录）时先删除，不允许删除时之后的复制会报告错误
+	if target != nil && target.IsDir() != info.IsDir() {
+		removed, err := s.removeOrphan(relPath)
+		if err != nil {
+			return err
+		}
+		if removed {
+			target = nil
+		}
+	}
+
+	s.stats.FilesScanned++
+	if info.IsDir() {
+		return s.syncSubdir(relPath, depth, info, target != nil)
+	}
+	s.stats.TargetFiles++
+	s.stats.TargetBytes += info.Size()
+	return s.syncFile(relPath, info, target)
+}
+
+// isAncestor 判断目录是否在当前路径上
+func (s *streamSync) isAncestor(info os.FileInfo) bool {
+	key, ok := inodeKey(info)
+	return ok && s.ancestors[key]
+}
+
+// syncSubdir 在目标中创建源目录中的子目录并继续同步其内容，exists 表示目标中已有该目录
+func (s *streamSync) syncSubdir(relPath string, depth int, info os.FileInfo, exists bool) error {
+	opts := s.opts
+	targetFilePath := filepath.Join(opts.TargetPath, relPath)
+	if !exists && !opts.DryRun {
+		if err := os.Mkdir(targetFilePath, 0755); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to create directory %s: %v", targetFilePath, err)
+		}
+		if opts.DirMode != 0 {
+			if err := os.Chmod(targetFilePath, opts.DirMode); err != nil {
+				return fmt.Errorf("failed to set mode of %s: %v", targetFilePath, err)
+			}
+		}
+	}
+
+	// 达到最大层数的目录不再深入，目标中其下的内容保留不动
+	if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+		return nil
+	}
+
+	key, ok := inodeKey(info)
+	if ok {
+		s.ancestors[key] = true
+		defer delete(s.ancestors, key)
+	}
+	return s.syncDir(relPath, depth, exists || !opts.DryRun)
+}
+
+// syncFile 比较源文件与目标中的同名文件，不同时复制；target 为 nil 表示目标中没有该文件
+// 大小和修改时间都相同的文件视为未变化；只有修改时间不同时比较哈希值，内容相同则只更新修改时间
+func (s *streamSync) syncFile(relPath string, info, target os.FileInfo) error {
+	opts := s.opts
+	sourcePath := filepath.Join(opts.SourcePath, relPath)
+	targetFilePath := filepath.Join(opts.TargetPath, relPath)
+	modTime := info.ModTime().Unix()
+
+	copyNeeded := true
+	switch {
+	case opts.ForceFull:
+		if opts.Debugf != nil {
+			opts.Debugf("copy %s: full backup forced", relPath)
+		}
+	case target == nil:
+		if opts.Debugf != nil {
+			opts.Debugf("copy %s: not in target (source %d bytes)", relPath, info.Size())
+		}
+	case target.Size() != info.Size():
+		if opts.Debugf != nil {
+			opts.Debugf("copy %s: size differs (source %d bytes, target %d bytes)", relPath, info.Size(), target.Size())
+		}
+	case sameModTime(modTime, target.ModTime().Unix(), opts.MtimePrecision):
+		if opts.Debugf != nil {
+			opts.Debugf("skip %s: same size and mtime", relPath)
+		}
+		copyNeeded = false
+	default:
+		sourceHash, err := calculateHash(sourcePath)
+		if err != nil {
+			if opts.UnreadablePolicy != UnreadableFail && os.IsPermission(err) {
+				log.Printf("Skipping unreadable file %s", sourcePath)
+				s.stats.FilesUnreadable++
+				return nil
+			}
+			return fmt.Errorf("failed to hash %s: %v", sourcePath, err)
+		}
+		targetHash, err := calculateHash(targetFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %v", targetFilePath, err)
+		}
+		if opts.Debugf != nil {
+			debugDecision(opts.Debugf, relPath, &FileInfo{Size: info.Size(), Hash: sourceHash, ModTime: modTime},
+				&FileInfo{Size: target.Size(), Hash: targetHash, ModTime: target.ModTime().Unix()}, opts.MtimePrecision)
+		}
+		if sourceHash == targetHash {
+			copyNeeded = false
+			if !opts.DryRun {
+				modTimeObj := time.Unix(modTime, 0)
+				if err := os.Chtimes(targetFilePath, modTimeObj, modTimeObj); err != nil {
+					return fmt.Errorf("failed to update modification time of %s: %v", targetFilePath, err)
+				}
+			}
+		}
+	}
+	if !copyNeeded {
+		return nil
+	}
+
+	s.started++
+	s.progress.OnFile(relPath, s.started, 0)
+	if opts.DryRun {
+		s.stats.FilesCopied++
+		s.stats.BytesTransferred += info.Size()
+		entry := PlanEntry{Target: opts.TargetPath, Action: PlanAdd, Path: relPath, Size: info.Size()}
+		if target != nil {
+			entry.Action, entry.TargetSize = PlanChange, target.Size()
+		}
+		s.stats.Plan = append(s.stats.Plan, entry)
+		return nil
+	}
+
+	written, err := copyFile(s.ctx, sourcePath, targetFilePath, modTime, "", s.copyOpts)
+	s.stats.BytesTransferred += written
+	if err != nil {
+		if opts.UnreadablePolicy != UnreadableFail && os.IsPermission(err) && written == 0 {
+			log.Printf("Skipping unreadable file %s", sourcePath)
+			s.stats.FilesUnreadable++
+			return nil
+		}
+		return fmt.Errorf("failed to copy file %s: %v", relPath, err)
+	}
+	s.stats.FilesCopied++
+	return nil
+}
+
+// removeOrphan 删除目标中源目录已不存在的条目，目录连同其内容作为一个条目删除，返回该条目是否已被（试运行时为将被）删除
+// 需要保留的条目不删除；目录中有需要保留的条目时逐个处理其内容，其余内容都删除后才删除目录
+func (s *streamSync) removeOrphan(relPath string) (bool, error) {
+	opts := s.opts
+	targetFilePath := filepath.Join(opts.TargetPath, relPath)
+	info, err := os.Stat(targetFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to scan target directory: %v", err)
+	}
+
+	if matchAny(relPath, opts.KeepInTarget) {
+		if opts.Debugf != nil {
+			opts.Debugf("keep %s: not in source, protected by keep rules", relPath)
+		}
+		if !info.IsDir() {
+			s.stats.TargetFiles++
+			s.stats.TargetBytes += info.Size()
+		}
+		return false, nil
+	}
+	if info.IsDir() && len(opts.KeepInTarget) > 0 {
+		entries, _, err := readStreamDir(targetFilePath)
+		if err != nil {
+			return false, fmt.Errorf("failed to scan target directory: %v", err)
+		}
+		emptied := true
+		for _, entry := range entries {
+			removed, err := s.removeOrphan(filepath.Join(relPath, entry.Name()))
+			if err != nil {
+				return false, err
+			}
+			emptied = emptied && removed
+		}
+		if !emptied {
+			return false, nil
+		}
+	}
+
+	if opts.NoDelete {
+		if opts.Debugf != nil {
+			opts.Debugf("keep %s: not in source, deletion disabled", relPath)
+		}
+		s.stats.FilesOrphaned++
+		if !info.IsDir() {
+			s.stats.TargetFiles++
+			s.stats.TargetBytes += info.Size()
+		}
+		return false, nil
+	}
+	if opts.Debugf != nil {
+		opts.Debugf("delete %s: not in source", relPath)
+	}
+
+	s.stats.FilesDeleted++
+	if opts.DryRun {
+		entry := PlanEntry{Target: opts.TargetPath, Action: PlanDelete, Path: relPath, IsDir: info.IsDir()}
+		if !info.IsDir() {
+			entry.Size = info.Size()
+		}
+		s.stats.Plan = append(s.stats.Plan, entry)
+		return true, nil
+	}
+	if err := s.throttle.wait(s.ctx, opts.WaitIfPaused); err != nil {
+		return false, err
+	}
+	if err := os.RemoveAll(targetFilePath); err != nil {
+		return false, fmt.Errorf("failed to remove %s: %v", targetFilePath, err)
+	}
+	s.deleted++
+	s.progress.OnDelete(s.deleted, 0)
+	return true, nil
+}
@@ -1,17 +1,133 @@
 package backup
 
 import (
+	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+// tmpSuffix 复制过程中临时文件的后缀，复制完成后重命名为目标文件
+const tmpSuffix = ".watchman.tmp"
+
+// 无法读取的源文件的处理策略
+const (
+	UnreadableSkip = "skip" // 记录日志并跳过
+	UnreadableWarn = "warn" // 跳过，并在任务上记录跳过的数量
+	UnreadableFail = "fail" // 中止本次备份
+)
+
+// SyncOptions 同步选项
+type SyncOptions struct {
+	// SourcePath 和 TargetPath 同步的源目录和目标目录
+	SourcePath string
+	TargetPath string
+	// DryRun 只统计需要复制和删除的文件，不修改目标目录
+	DryRun bool
+	// RateLimit 写入目标的速度上限（字节/秒），为 0 时不限速
+	RateLimit int64
+	// SharedLimiter 不为 nil 时与其他使用同一限速器的同步共同遵守的速度上限，与 RateLimit 同时生效
+	SharedLimiter *SharedLimiter
+	// MtimePrecision 比较修改时间时的精度，为 0 时根据目标文件系统自动检测
+	MtimePrecision time.Duration
+	// UnreadablePolicy 无法读取的源文件的处理策略
+	UnreadablePolicy string
+	// Dedup 同步完成后将目标目录中内容相同的文件替换为硬链接
+	Dedup bool
+	// TargetCacheFile 目标目录哈希缓存的保存路径，为空时每次都重新计算目标文件的哈希
+	TargetCacheFile string
+	// KeepInTarget 目标目录中匹配这些通配符的文件即使在源目录中不存在也不会被删除
+	KeepInTarget []string
+	// Exclude 源目录中匹配这些通配符的文件和目录不参与备份，目标中已有的副本保留不动
+	Exclude []string
+	// NoDelete 不删除目标目录中源目录已不存在的文件
+	NoDelete bool
+	// PathMap 写入目标之前按顺序改写源文件相对路径的前缀，使目标采用不同的目录布局；
+	// 孤立文件按映射后的路径判断
+	PathMap []PathMapping
+	// DeleteRate 每秒最多删除的目标条目数，为 0 时不限速，避免大量删除拖垮较慢的目标（如网络存储）
+	DeleteRate int
+	// DeleteBatch 每批删除的条目数，每批之前检查暂停并按 DeleteRate 等待；为 0 时使用默认值
+	DeleteBatch int
+	// ForceFull 复制所有源文件，不论目标中的文件哈希值是否相同，用于怀疑目标不一致时的完整备份
+	ForceFull bool
+	// MinFileAge 跳过修改时间距今不足该时长的源文件（如正在下载的文件），留到之后的备份；为 0 时不跳过
+	MinFileAge time.Duration
+	// QuiesceWindow 源目录中最近的修改距今不足该时长时跳过本次同步，避免复制到一组正在写入的文件的中间状态；为 0 时不检查
+	QuiesceWindow time.Duration
+	// MaxDepth 只扫描源目录下该层数以内的文件和目录（源目录中的直接子项为第 1 层），为 0 时不限制
+	MaxDepth int
+	// Streaming 逐个目录归并比较源目录和目标目录并立即同步，不在内存中保存完整的文件列表，用于文件数量极多的源目录；
+	// 大小和修改时间都相同的文件视为未变化，需要完整文件列表的选项不可用
+	Streaming bool
+	// SourceManifestFile 不为空时增量扫描源目录：修改时间未变的目录直接复用该清单中记录的文件，不读取其元数据；
+	// 扫描完成后更新清单。ForceFull 时不复用清单
+	SourceManifestFile string
+	// SkipTargetScan 不扫描目标目录，将 TargetCacheFile 中上次同步后的记录当作目标的内容，只复制与之不同的源文件、
+	// 删除其中源目录已不存在的文件；缓存不存在、为空、目标目录原本不存在或 ForceFull 时仍然扫描目标目录
+	SkipTargetScan bool
+	// Reflink 在支持的文件系统上通过写时复制克隆文件，不支持时回退到普通复制
+	Reflink bool
+	// Compress 将每个文件单独以 gzip 压缩后写入目标，文件名追加 .gz 后缀
+	Compress bool
+	// CompressLevel gzip 压缩级别，参见 compress/gzip 中的常量
+	CompressLevel int
+	// FileMode 写入目标的文件的权限，为 0 时由 umask 决定
+	FileMode os.FileMode
+	// DirMode 在目标中创建的目录的权限，为 0 时由 umask 决定
+	DirMode os.FileMode
+	// ScanWorkers 扫描使用的工作协程数，启用 AdaptiveScan 时为上限；为 0 时使用默认值
+	ScanWorkers int
+	// AdaptiveScan 根据扫描吞吐量和文件处理耗时动态调整工作协程数
+	AdaptiveScan bool
+	// CaseInsensitiveTarget 目标文件系统不区分大小写，比较和删除时只差大小写的路径视为同一个文件
+	CaseInsensitiveTarget bool
+	// MaxTargetFiles 和 MaxTargetBytes 同步完成后目标中文件数和字节数的上限，为 0 时不限制
+	MaxTargetFiles int
+	MaxTargetBytes int64
+	// Debugf 不为 nil 时输出每个文件的比较结果和删除决定，用于排查文件被反复复制等问题
+	Debugf func(format string, args ...any)
+	// Progress 接收同步的阶段、当前文件和字节进度，为 nil 时不汇报进度
+	Progress ProgressReporter
+	// WaitIfPaused 不为 nil 时在复制每个文件之前和复制过程中每次读取源文件之前调用，
+	// 同步被暂停时阻塞到恢复，返回错误时同步停止
+	WaitIfPaused func(ctx context.Context) error
+}
+
+// Summary 记录一次同步的统计信息，试运行时为将要复制和删除的数量
+type Summary struct {
+	FilesScanned     int           // 扫描到的源文件数
+	FilesCopied      int           // 复制的文件数
+	FilesDeleted     int           // 从目标目录删除的文件数
+	FilesOrphaned    int           // 因禁止删除而保留在目标目录中的孤立文件数
+	FilesUnreadable  int           // 因无法读取而跳过的源文件数
+	FilesExcluded    int           // 被排除规则跳过的源文件数
+	DirsExcluded     int           // 被排除规则跳过的源目录数（其中的内容不再扫描）
+	BytesExcluded    int64         // 被排除规则跳过的源文件的总字节数
+	FilesDeferred    int           // 因修改时间太近而推迟到之后备份的源文件数
+	FilesDeduped     int           // 被替换为硬链接的重复文件数
+	BytesReclaimed   int64         // 去重回收的字节数
+	BytesTransferred int64         // 实际写入目标的字节数
+	CaseConflicts    int           // 因与其他源文件只差大小写而跳过的源文件数
+	PathsTooLong     int           // 因在目标中的路径超过系统限制而跳过的源文件和目录数（只计最外层）
+	TargetFiles      int           // 同步完成后目标中的文件数
+	TargetBytes      int64         // 同步完成后目标中的字节数，按源文件的大小估算
+	ScanDuration     time.Duration // 扫描耗时
+	CopyDuration     time.Duration // 复制耗时
+	TotalDuration    time.Duration // 总耗时
+	Plan             []PlanEntry   // 试运行时将要复制、覆盖和删除的文件，按目标和路径排序
+}
+
 // FileInfo 存储文件信息
 type FileInfo struct {
 	Path    string
@@ -38,7 +154,8 @@ func calculateHash(path string) (string, error) {
 }
 
 // getFileInfo 获取文件信息
-func getFileInfo(path string) (*FileInfo, error) {
+// 如果缓存中记录的大小和修改时间与文件一致，则直接使用缓存的哈希值
+func getFileInfo(path, relPath string, opts scanOptions) (*FileInfo, error) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
@@ -51,8 +168,17 @@ func getFileInfo(path string) (*FileInfo, error) {
 		IsDir:   info.IsDir(),
 	}
 
-	if !info.IsDir() {
-		hash, err := calculateHash(path)
+	if !info.IsDir() && !opts.metadataOnly {
+		if hash, ok := opts.cache.lookup(relPath, fileInfo.Size, fileInfo.ModTime); ok {
+			fileInfo.Hash = hash
+			return fileInfo, nil
+		}
+
+		hashFile := calculateHash
+		if opts.gunzip && strings.HasSuffix(relPath, gzipSuffix) {
+			hashFile = calculateGzipHash
+		}
+		hash, err := hashFile(path)
 		if err != nil {
 			return nil, err
 		}
@@ -62,24 +188,62 @@ func getFileInfo(path string) (*FileInfo, error) {
 	return fileInfo, nil
 }
 
+// scanOptions 扫描目录时的选项
+type scanOptions struct {
+	skipUnreadable bool                                   // 跳过没有读取权限的文件和目录
+	cache          hashCache                              // 大小和修改时间未变的文件复用缓存中的哈希值
+	gunzip         bool                                   // .gz 文件按解压后的内容计算哈希值
+	exclude        []string                               // 跳过匹配这些通配符的文件和目录
+	onExclude      func(relPath string, info os.FileInfo) // 每跳过一个被排除的文件或目录时回调
+	modifiedAfter  time.Time                              // 不为零值时跳过在此之后修改的普通文件
+	maxDepth       int                                    // 大于 0 时不再深入扫描达到该层数的目录
+	onTooDeep      func(relPath string)                   // 每遇到一个因达到最大层数而不再深入扫描的目录时回调
+	onDefer        func(relPath string)                   // 每跳过一个修改时间太近的文件时回调
+	manifest       *sourceManifest                        // 不为 nil 时修改时间未变的目录直接复用清单中记录的文件
+	onDir          func(relPath string, modTime int64)    // 每扫描或复用一个目录时回调，修改时间为纳秒
+	onSymlink      func(relPath string)                   // 每扫描一个符号链接时回调
+	onTemp         func(relPath string)                   // 每跳过一个上次中断留下的临时文件时回调
+	metadataOnly   bool                                   // 只读取大小和修改时间，不计算哈希值
+	workers        int                                    // 工作协程数，自适应时为上限；为 0 时使用默认值
+	adaptive       bool                                   // 根据吞吐量动态调整工作协程数
+}
+
 // 添加一个工作协程的结构体
 type scanWorker struct {
 	jobs    chan string
 	results chan *scanResult
 	dir     string
+	opts    scanOptions
 	wg      *sync.WaitGroup
+	quit    <-chan struct{} // 自适应扫描减少协程时通知一个协程退出
+	scaler  *scanScaler     // 不为 nil 时记录每个文件的处理耗时
 }
 
 // 扫描结果
 type scanResult struct {
 	path     string
 	fileInfo *FileInfo
+	skipped  bool // 文件无法读取，已被跳过
 	err      error
 }
 
 // scanDirectory 扫描目录下的所有文件
-func scanDirectory(dir string) (map[string]*FileInfo, error) {
-	const numWorkers = 8 // 使用8个工作协程
+// 设置 skipUnreadable 时跳过没有读取权限的文件和目录，并返回它们的相对路径
+func scanDirectory(ctx context.Context, dir string, opts scanOptions) (map[string]*FileInfo, []string, error) {
+	numWorkers := opts.workers
+	if numWorkers <= 0 {
+		numWorkers = defaultScanWorkers
+	}
+
+	// 自适应扫描从少量协程开始，由 scaler 逐步调整
+	var scaler *scanScaler
+	if opts.adaptive {
+		if opts.workers <= 0 {
+			numWorkers = maxAdaptiveScanWorkers
+		}
+		scaler = &scanScaler{max: numWorkers, workers: min(2, numWorkers)}
+		numWorkers = scaler.workers
+	}
 
 	files := make(map[string]*FileInfo)
 	var mu sync.Mutex // 用于保护 files map
@@ -90,19 +254,38 @@ func scanDirectory(dir string) (map[string]*FileInfo, error) {
 	results := make(chan *scanResult, 100)
 
 	// 启动工作协程
-	for i := 0; i < numWorkers; i++ {
+	quit := make(chan struct{})
+	startWorker := func() {
 		wg.Add(1)
 		worker := &scanWorker{
 			jobs:    jobs,
 			results: results,
 			dir:     dir,
+			opts:    opts,
 			wg:      &wg,
+			quit:    quit,
+			scaler:  scaler,
 		}
 		go worker.run()
 	}
+	for i := 0; i < numWorkers; i++ {
+		startWorker()
+	}
+
+	stopScaler := make(chan struct{})
+	scalerDone := make(chan struct{})
+	if scaler != nil {
+		go func() {
+			scaler.run(stopScaler, startWorker, func() { quit <- struct{}{} })
+			close(scalerDone)
+		}()
+	} else {
+		close(scalerDone)
+	}
 
 	// 启动结果处理协程
 	var processErr error
+	var skipped []string
 	done := make(chan struct{})
 	go func() {
 		for result := range results {
@@ -110,6 +293,10 @@ func scanDirectory(dir string) (map[string]*FileInfo, error) {
 				processErr = result.err
 				continue
 			}
+			if result.skipped {
+				skipped = append(skipped, result.path)
+				continue
+			}
 			mu.Lock()
 			files[result.path] = result.fileInfo
 			mu.Unlock()
@@ -118,8 +305,20 @@ func scanDirectory(dir string) (map[string]*FileInfo, error) {
 	}()
 
 	// 遍历目录并发送任务
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	var walkSkipped []string
+	var walk filepath.WalkFunc
+	walk = func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
+			// 无法读取的目录直接跳过其内容
+			if opts.skipUnreadable && os.IsPermission(err) && path != dir {
+				if relPath, relErr := filepath.Rel(dir, path); relErr == nil {
+					walkSkipped = append(walkSkipped, relPath)
+				}
+				return nil
+			}
 			return err
 		}
 
@@ -131,12 +330,128 @@ func scanDirectory(dir string) (map[string]*FileInfo, error) {
 			return nil
 		}
 
+		// 跳过上次中断留下的临时文件
+		if !info.IsDir() && strings.HasSuffix(info.Name(), tmpSuffix) {
+			if relPath, relErr := filepath.Rel(dir, path); relErr == nil && opts.onTemp != nil {
+				opts.onTemp(relPath)
+			}
+			return nil
+		}
+
+		// 跳过被排除的文件和目录，被排除的目录不再深入扫描
+		if len(opts.exclude) > 0 && path != dir {
+			if relPath, relErr := filepath.Rel(dir, path); relErr == nil && matchAny(relPath, opts.exclude) {
+				if opts.onExclude != nil {
+					opts.onExclude(relPath, info)
+				}
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		// 跳过最近还在修改的文件（如正在下载的文件），不计算哈希值
+		if !opts.modifiedAfter.IsZero() && info.Mode().IsRegular() && info.ModTime().After(opts.modifiedAfter) {
+			if relPath, relErr := filepath.Rel(dir, path); relErr == nil && opts.onDefer != nil {
+				opts.onDefer(relPath)
+			}
+			return nil
+		}
+
+		// filepath.Walk 不会进入指向目录的符号链接，这类链接在下面与普通目录一样深入扫描
+		dirInfo, linkedDir := info, false
+		if info.Mode()&os.ModeSymlink != 0 {
+			if opts.onSymlink != nil {
+				if relPath, relErr := filepath.Rel(dir, path); relErr == nil {
+					opts.onSymlink(relPath)
+				}
+			}
+			target, skip := checkSymlink(dir, path)
+			if skip != nil {
+				log.Printf("Skipping symlink %s: %v", path, skip)
+				return nil
+			}
+			if target.IsDir() {
+				dirInfo, linkedDir = target, true
+			}
+		}
+
+		// 设备、socket、命名管道等无法按文件复制，读取命名管道还会一直阻塞
+		if kind := specialFileKind(path, info); kind != "" {
+			log.Printf("Skipping %s %s: only regular files and directories are backed up", kind, path)
+			return nil
+		}
+
 		// 发送任务到工作协程
 		jobs <- path
+
+		// 跳过目录时，符号链接按普通条目返回 nil，SkipDir 会跳过其所在目录中余下的条目
+		skipDir := filepath.SkipDir
+		if linkedDir {
+			skipDir = nil
+		}
+
+		// 达到最大层数的目录不再深入扫描
+		if opts.maxDepth > 0 && dirInfo.IsDir() && path != dir {
+			if relPath, relErr := filepath.Rel(dir, path); relErr == nil &&
+				strings.Count(relPath, string(filepath.Separator))+1 >= opts.maxDepth {
+				if opts.onTooDeep != nil {
+					opts.onTooDeep(relPath)
+				}
+				return skipDir
+			}
+		}
+
+		if dirInfo.IsDir() && (opts.onDir != nil || opts.manifest != nil) {
+			relPath, relErr := filepath.Rel(dir, path)
+			if relErr != nil {
+				return relErr
+			}
+			if opts.onDir != nil {
+				opts.onDir(relPath, dirInfo.ModTime().UnixNano())
+			}
+			// 修改时间未变的目录中的文件直接取自清单，子目录仍需逐个检查
+			if opts.manifest != nil && opts.manifest.unchanged(relPath, dirInfo) {
+				for _, fileRel := range opts.manifest.files[relPath] {
+					entry := opts.manifest.Files[fileRel]
+					results <- &scanResult{path: fileRel, fileInfo: &FileInfo{
+						Path:    filepath.Join(dir, fileRel),
+						Size:    entry.Size,
+						Hash:    entry.Hash,
+						ModTime: entry.ModTime,
+					}}
+				}
+				for _, subdir := range opts.manifest.subdirs[relPath] {
+					if err := filepath.Walk(filepath.Join(dir, subdir), walk); err != nil {
+						return err
+					}
+				}
+				return skipDir
+			}
+		}
+
+		if linkedDir {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return walk(path, info, err)
+			}
+			for _, entry := range entries {
+				if err := filepath.Walk(filepath.Join(path, entry.Name()), walk); err != nil {
+					return err
+				}
+			}
+		}
 		return nil
-	})
+	}
+	err := filepath.Walk(dir, walk)
 
-	// 关闭任务通道，等待所有工作协程完成
+	// 先停止调整协程数，再关闭任务通道，等待所有工作协程完成
+	close(stopScaler)
+	<-scalerDone
+	if scaler != nil {
+		log.Printf("Adaptive scan of %s finished with %d workers", dir, scaler.workers)
+	}
 	close(jobs)
 	wg.Wait()
 	close(results)
@@ -145,156 +460,1071 @@ func scanDirectory(dir string) (map[string]*FileInfo, error) {
 	<-done
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if processErr != nil {
-		return nil, processErr
+		return nil, nil, processErr
+	}
+
+	return files, append(skipped, walkSkipped...), nil
+}
+
+// scanFile 以与 scanDirectory 相同的规则扫描单个源文件，相对路径为其文件名
+func scanFile(path string, info os.FileInfo, opts scanOptions) (map[string]*FileInfo, []string, error) {
+	relPath := filepath.Base(path)
+	files := make(map[string]*FileInfo)
+
+	if matchAny(relPath, opts.exclude) {
+		if opts.onExclude != nil {
+			opts.onExclude(relPath, info)
+		}
+		return files, nil, nil
+	}
+	if !opts.modifiedAfter.IsZero() && info.ModTime().After(opts.modifiedAfter) {
+		if opts.onDefer != nil {
+			opts.onDefer(relPath)
+		}
+		return files, nil, nil
 	}
 
-	return files, nil
+	fileInfo, err := getFileInfo(path, relPath, opts)
+	if err != nil {
+		if opts.skipUnreadable && os.IsPermission(err) {
+			return files, []string{relPath}, nil
+		}
+		return nil, nil, err
+	}
+	files[relPath] = fileInfo
+	return files, nil, nil
+}
+
+// checkSymlink 检查 root 下的符号链接能否安全地加入扫描，返回链接指向的文件或跳过的原因
+// 指向目录的链接会被跟随扫描；无法解析的链接（悬空或相互引用形成的链接循环）
+// 以及指向自身所在路径上某个目录（如上级目录）而形成循环的链接都会被跳过
+func checkSymlink(root, path string) (os.FileInfo, error) {
+	target, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve link: %v", err)
+	}
+	if !target.IsDir() {
+		return target, nil
+	}
+	root = filepath.Clean(root)
+	for p := path; p != root; {
+		parent := filepath.Dir(p)
+		if parent == p {
+			break
+		}
+		p = parent
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve link: %v", err)
+		}
+		if os.SameFile(info, target) {
+			return nil, fmt.Errorf("points to a directory being scanned, following it would create a cycle")
+		}
+	}
+	return target, nil
+}
+
+// specialFileKind 返回设备、socket、命名管道等特殊文件的类型
+// 普通文件和目录以及指向它们的符号链接返回空字符串
+func specialFileKind(path string, info os.FileInfo) string {
+	mode := info.Mode()
+	if mode&os.ModeSymlink != 0 {
+		target, err := os.Stat(path)
+		if err != nil {
+			return ""
+		}
+		mode = target.Mode()
+	}
+
+	switch {
+	case mode.IsRegular(), mode.IsDir():
+		return ""
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	default:
+		return "special file"
+	}
 }
 
 // 工作协程的处理函数
 func (w *scanWorker) run() {
 	defer w.wg.Done()
 
-	for path := range w.jobs {
-		fileInfo, err := getFileInfo(path)
-		if err != nil {
-			w.results <- &scanResult{err: err}
+	for {
+		select {
+		case <-w.quit:
+			return
+		case path, ok := <-w.jobs:
+			if !ok {
+				return
+			}
+			start := time.Now()
+			w.results <- w.scan(path)
+			if w.scaler != nil {
+				w.scaler.record(time.Since(start))
+			}
+		}
+	}
+}
+
+// scan 读取单个文件的信息
+func (w *scanWorker) scan(path string) *scanResult {
+	// 计算相对路径
+	relPath, err := filepath.Rel(w.dir, path)
+	if err != nil {
+		return &scanResult{err: err}
+	}
+
+	fileInfo, err := getFileInfo(path, relPath, w.opts)
+	if err != nil {
+		if w.opts.skipUnreadable && os.IsPermission(err) {
+			return &scanResult{path: relPath, skipped: true}
+		}
+		return &scanResult{err: err}
+	}
+
+	return &scanResult{
+		path:     relPath,
+		fileInfo: fileInfo,
+		err:      nil,
+	}
+}
+
+// Run 将 opts.SourcePath 增量同步到 opts.TargetPath，返回本次同步的统计信息
+// Run 与守护进程的定时器和配置文件无关，可以直接调用；文件是否变化按内容的 SHA256 哈希值判断（流式同步除外，参见 Streaming）
+// ctx 被取消时尽快停止并返回 ctx.Err()，已复制完成的文件保留在目标目录中
+func Run(ctx context.Context, opts SyncOptions) (Summary, error) {
+	if opts.SourcePath == "" || opts.TargetPath == "" {
+		return Summary{}, fmt.Errorf("source and target paths are required")
+	}
+	if opts.Streaming {
+		return streamTarget(ctx, opts)
+	}
+
+	scan, err := scanSource(ctx, opts)
+	if err != nil {
+		return scan.summary, err
+	}
+	return syncTarget(ctx, opts, scan)
+}
+
+// runTargets 只扫描一次源目录，然后依次同步到每个目标，返回所有目标合计的统计信息和每个目标的错误
+// configure 在同步每个目标之前调用，用于设置该目标的缓存文件和回调；返回错误时跳过该目标
+func runTargets(ctx context.Context, opts SyncOptions, targets []string, configure func(i int, opts *SyncOptions) error) (Summary, []error) {
+	errs := make([]error, len(targets))
+	if opts.Streaming {
+		return streamTargets(ctx, opts, targets, configure)
+	}
+
+	scan, err := scanSource(ctx, opts)
+	if err != nil {
+		for i := range targets {
+			errs[i] = err
+		}
+		return scan.summary, errs
+	}
+
+	total := scan.summary
+	for i, target := range targets {
+		targetOpts := opts
+		targetOpts.TargetPath = target
+		if errs[i] = recoverTarget(func() error { return configure(i, &targetOpts) }); errs[i] != nil {
 			continue
 		}
 
-		// 计算相对路径
-		relPath, err := filepath.Rel(w.dir, path)
+		// 同步中途出错时只计入扫描阶段的统计
+		stats := scan.summary
+		errs[i] = recoverTarget(func() (err error) {
+			stats, err = syncTarget(ctx, targetOpts, scan)
+			return err
+		})
+		// 源目录的扫描统计只计一次
+		total.FilesCopied += stats.FilesCopied
+		total.FilesDeleted += stats.FilesDeleted
+		total.FilesOrphaned += stats.FilesOrphaned
+		total.FilesDeduped += stats.FilesDeduped
+		total.BytesReclaimed += stats.BytesReclaimed
+		total.BytesTransferred += stats.BytesTransferred
+		total.Plan = append(total.Plan, stats.Plan...)
+		total.CaseConflicts = max(total.CaseConflicts, stats.CaseConflicts)
+		total.PathsTooLong = max(total.PathsTooLong, stats.PathsTooLong)
+		// 配额对每个目标单独生效，记录占用最多的目标
+		total.TargetFiles = max(total.TargetFiles, stats.TargetFiles)
+		total.TargetBytes = max(total.TargetBytes, stats.TargetBytes)
+		total.ScanDuration += stats.ScanDuration - scan.summary.ScanDuration
+		total.CopyDuration += stats.CopyDuration
+		total.TotalDuration += stats.TotalDuration - scan.summary.TotalDuration
+	}
+	return total, errs
+}
+
+// recoverTarget 执行一个目标的同步中的一步，把 panic 转换为只属于该目标的错误，其余目标仍会备份
+func recoverTarget(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic during sync: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// sourceScan 源目录的扫描结果，可以依次同步到多个目标而不必重复计算哈希值
+type sourceScan struct {
+	files      map[string]*FileInfo
+	unreadable []string // 因无法读取而跳过的相对路径
+	excluded   []string // 被排除规则跳过的相对路径
+	deferred   []string // 因修改时间太近而推迟备份的相对路径
+	tooDeep    []string // 达到最大层数而未扫描其内容的目录的相对路径
+	single     bool     // 源路径是单个文件，files 中只有以其文件名为相对路径的这一个文件
+	summary    Summary  // 扫描阶段的统计信息
+}
+
+// scanSource 扫描并计算源目录中所有文件的哈希值
+func scanSource(ctx context.Context, opts SyncOptions) (scan *sourceScan, err error) {
+	scan = &sourceScan{}
+	stats := &scan.summary
+	start := time.Now()
+	defer func() {
+		stats.ScanDuration = time.Since(start)
+		stats.TotalDuration = stats.ScanDuration
+		err = ctxError(ctx, err)
+	}()
+
+	opts.reporter().OnPhase(PhaseScanSource)
+	var modifiedAfter time.Time
+	if opts.MinFileAge > 0 {
+		modifiedAfter = start.Add(-opts.MinFileAge)
+	}
+	scanOpts := scanOptions{
+		skipUnreadable: opts.UnreadablePolicy != UnreadableFail,
+		workers:        opts.ScanWorkers,
+		adaptive:       opts.AdaptiveScan,
+		exclude:        opts.Exclude,
+		onExclude: func(relPath string, info os.FileInfo) {
+			scan.excluded = append(scan.excluded, relPath)
+			if info.IsDir() {
+				stats.DirsExcluded++
+			} else {
+				stats.FilesExcluded++
+				stats.BytesExcluded += info.Size()
+			}
+		},
+		modifiedAfter: modifiedAfter,
+		onDefer: func(relPath string) {
+			scan.deferred = append(scan.deferred, relPath)
+		},
+		maxDepth: opts.MaxDepth,
+		onTooDeep: func(relPath string) {
+			scan.tooDeep = append(scan.tooDeep, relPath)
+		},
+	}
+
+	// 增量扫描：记录每个目录的修改时间，其中有排除、推迟、无法读取、超过最大层数的条目或符号链接的目录每次都重新读取，
+	// 否则复用该目录时这些条目不会被报告，或其变化无法通过目录的修改时间察觉
+	// 清单中文件的哈希值同时用作缓存，重新读取的目录中大小和修改时间未变的文件也不再计算哈希
+	var dirs map[string]int64
+	volatile := make(map[string]bool)
+	if opts.SourceManifestFile != "" {
+		if !opts.ForceFull {
+			if scanOpts.manifest = loadSourceManifest(opts.SourceManifestFile, opts); scanOpts.manifest != nil {
+				scanOpts.cache = scanOpts.manifest.Files
+			}
+		}
+		dirs = make(map[string]int64)
+		scanOpts.onDir = func(relPath string, modTime int64) {
+			dirs[relPath] = modTime
+		}
+		scanOpts.onSymlink = func(relPath string) {
+			volatile[filepath.Dir(relPath)] = true
+		}
+		onExclude, onDefer, onTooDeep := scanOpts.onExclude, scanOpts.onDefer, scanOpts.onTooDeep
+		scanOpts.onExclude = func(relPath string, info os.FileInfo) {
+			volatile[filepath.Dir(relPath)] = true
+			onExclude(relPath, info)
+		}
+		scanOpts.onDefer = func(relPath string) {
+			volatile[filepath.Dir(relPath)] = true
+			onDefer(relPath)
+		}
+		scanOpts.onTooDeep = func(relPath string) {
+			volatile[filepath.Dir(relPath)] = true
+			onTooDeep(relPath)
+		}
+	}
+
+	// 源路径是单个文件时只备份该文件，不遍历目录
+	var files map[string]*FileInfo
+	var unreadable []string
+	if info, statErr := os.Stat(opts.SourcePath); statErr == nil && info.Mode().IsRegular() {
+		scan.single = true
+		files, unreadable, err = scanFile(opts.SourcePath, info, scanOpts)
 		if err != nil {
-			w.results <- &scanResult{err: err}
+			return scan, fmt.Errorf("failed to scan source file: %v", err)
+		}
+	} else {
+		files, unreadable, err = scanDirectory(ctx, opts.SourcePath, scanOpts)
+		if err != nil {
+			return scan, fmt.Errorf("failed to scan source directory: %v", err)
+		}
+	}
+	for _, relPath := range unreadable {
+		if scan.single {
+			log.Printf("Skipping unreadable file %s", opts.SourcePath)
 			continue
 		}
+		log.Printf("Skipping unreadable file %s", filepath.Join(opts.SourcePath, relPath))
+	}
 
-		w.results <- &scanResult{
-			path:     relPath,
-			fileInfo: fileInfo,
-			err:      nil,
+	if dirs != nil && !scan.single {
+		for _, relPath := range unreadable {
+			volatile[filepath.Dir(relPath)] = true
+		}
+		if err := saveSourceManifest(opts.SourceManifestFile, opts, files, dirs, volatile, start); err != nil {
+			log.Printf("Failed to save source manifest %s: %v", opts.SourceManifestFile, err)
+		}
+	}
+
+	scan.files, scan.unreadable = files, unreadable
+	stats.FilesScanned = len(files)
+	stats.FilesUnreadable = len(unreadable)
+	stats.FilesDeferred = len(scan.deferred)
+	if opts.QuiesceWindow > 0 {
+		if err := checkQuiescent(scan, opts, start); err != nil {
+			return scan, err
 		}
 	}
+	return scan, nil
 }
 
-// Sync 执行增量同步
-func Sync(sourcePath, targetPath string, progressChan chan<- float64) error {
+// checkQuiescent 检查源目录在扫描开始前的 QuiesceWindow 内是否有修改，有则返回 unavailableError，本次同步跳过而不是失败
+// 推迟备份的文件不在扫描结果中，但它们在 MinFileAge 内修改过，同样说明源目录仍在变化
+func checkQuiescent(scan *sourceScan, opts SyncOptions, start time.Time) error {
+	var latest int64
+	for _, file := range scan.files {
+		latest = max(latest, file.ModTime)
+	}
+	since := start.Sub(time.Unix(latest, 0))
+	if len(scan.deferred) > 0 {
+		since = min(since, opts.MinFileAge)
+	}
+	if since < opts.QuiesceWindow {
+		return &unavailableError{fmt.Errorf("source not quiescent: modified %s ago, within the quiesce window %s",
+			max(since, 0).Round(time.Second), opts.QuiesceWindow)}
+	}
+	return nil
+}
+
+// syncTarget 将扫描好的源目录同步到 opts.TargetPath
+func syncTarget(ctx context.Context, opts SyncOptions, scan *sourceScan) (summary Summary, err error) {
+	targetPath := opts.TargetPath
+	summary = scan.summary
+	stats := &summary
+	progress := opts.reporter()
+	start := time.Now()
+	defer func() {
+		stats.TotalDuration = scan.summary.TotalDuration + time.Since(start)
+		err = ctxError(ctx, err)
+	}()
+
+	// 目标是文件时 MkdirAll 只会报告含糊的 "not a directory"，且每次备份都会重复失败
+	if err := checkTarget(targetPath); err != nil {
+		return summary, err
+	}
+
 	// 确保目标目录存在
-	if err := os.MkdirAll(targetPath, 0755); err != nil {
-		return fmt.Errorf("failed to create target directory: %v", err)
+	_, statErr := os.Stat(targetPath)
+	dirs := newDirMaker()
+	if !opts.DryRun {
+		if err := dirs.mkdirAll(ctx, targetPath); err != nil {
+			return summary, fmt.Errorf("failed to create target directory: %v", err)
+		}
 	}
 
-	// 扫描源目录和目标目录
-	sourceFiles, err := scanDirectory(sourcePath)
-	if err != nil {
-		return fmt.Errorf("failed to scan source directory: %v", err)
+	// 未指定修改时间精度时按目标文件系统自动选择，避免在 FAT 等文件系统上反复判定为变化
+	if opts.MtimePrecision <= 0 {
+		fsType, precision := detectMtimePrecision(targetPath)
+		if fsType != "" {
+			log.Printf("Detected %s filesystem on %s, using %s mtime precision", fsType, targetPath, precision)
+		}
+		opts.MtimePrecision = precision
 	}
 
-	targetFiles, err := scanDirectory(targetPath)
-	if err != nil {
-		return fmt.Errorf("failed to scan target directory: %v", err)
+	// 压缩时目标中的文件名带 .gz 后缀，按目标中的文件名与目标目录比较
+	// 无法读取、被排除、推迟备份或超过最大层数的源文件对应的压缩文件同样需要保留
+	sourceFiles, unreadable, excluded, deferred, tooDeep := scan.files, scan.unreadable, scan.excluded, scan.deferred, scan.tooDeep
+	// 按映射规则改写源文件在目标中的路径，保护孤立文件的列表也改写为目标中的路径
+	if len(opts.PathMap) > 0 {
+		mapper := pathMapper(opts.PathMap)
+		if sourceFiles, err = mapper.mapFiles(sourceFiles); err != nil {
+			return summary, err
+		}
+		unreadable = mapper.applyAll(unreadable)
+		excluded = mapper.applyAll(excluded)
+		deferred = mapper.applyAll(deferred)
+		tooDeep = mapper.applyAll(tooDeep)
+	}
+	if opts.Compress {
+		sourceFiles = compressedNames(sourceFiles)
+		unreadable = withCompressedNames(unreadable)
+		excluded = withCompressedNames(excluded)
+		deferred = withCompressedNames(deferred)
+		tooDeep = withCompressedNames(tooDeep)
 	}
 
+	// 目标目录中大小和修改时间未变的文件复用上次缓存的哈希值
+	var targetCache hashCache
+	if opts.TargetCacheFile != "" {
+		targetCache = loadHashCache(opts.TargetCacheFile, opts)
+		if opts.Debugf != nil {
+			opts.Debugf("loaded %d cached target hashes from %s", len(targetCache), opts.TargetCacheFile)
+		}
+	}
+	progress.OnPhase(PhaseScanTarget)
+	targetFiles := make(map[string]*FileInfo)
+	var temps []string // 上次中断留下的临时文件的相对路径
+	if opts.SkipTargetScan && !opts.ForceFull && statErr == nil && len(targetCache) > 0 {
+		// 目标目录原本就存在时才信任缓存，避免更换的空磁盘上只复制了变化的文件
+		targetFiles = targetCache.files(targetPath)
+		if opts.Debugf != nil {
+			opts.Debugf("skipping scan of %s, using %d cached target files", targetPath, len(targetFiles))
+		}
+	} else if !opts.DryRun || statErr == nil {
+		targetFiles, _, err = scanDirectory(ctx, targetPath, scanOptions{
+			cache:    targetCache,
+			gunzip:   opts.Compress,
+			workers:  opts.ScanWorkers,
+			adaptive: opts.AdaptiveScan,
+			onTemp: func(relPath string) {
+				temps = append(temps, relPath)
+			},
+		})
+		if err != nil {
+			return summary, fmt.Errorf("failed to scan target directory: %v", err)
+		}
+	}
+	stats.ScanDuration += time.Since(start)
+
+	// 目标不区分大小写时，只差大小写的源文件会相互覆盖，只保留其中一个并报告冲突
+	if opts.CaseInsensitiveTarget {
+		var conflicts []string
+		sourceFiles, conflicts = foldSourcePaths(sourceFiles)
+		for _, relPath := range conflicts {
+			log.Printf("Skipping %s: its path differs only in case from another file and would collide on %s",
+				filepath.Join(opts.SourcePath, relPath), targetPath)
+		}
+		stats.CaseConflicts = len(conflicts)
+		targetFiles = foldTargetPaths(targetFiles, sourceFiles)
+	}
+
+	// 在目标中的路径超过系统限制的文件无法创建，跳过并报告，而不是在复制中途使整个备份失败
+	sourceFiles, tooLong := skipLongPaths(sourceFiles, opts.SourcePath, targetPath)
+	stats.PathsTooLong = len(tooLong)
+
 	totalFiles := len(sourceFiles)
 	if totalFiles == 0 {
-		if progressChan != nil {
-			progressChan <- 100
-		}
-		return nil
+		progress.OnProgress(100)
+		progress.OnPhase(PhaseDone)
+		return summary, nil
 	}
 
 	processedFiles := 0
 	filesToSync := 0
+	filesToCopy, filesStarted := 0, 0
+	var bytesToSync int64
 
-	// 计算需要同步的文件数量
+	// needsCopy 判断源文件是否需要复制到目标，完整备份时复制所有文件
+	needsCopy := func(sourceFile, targetFile *FileInfo, exists bool) bool {
+		return opts.ForceFull || !exists || sourceFile.Hash != targetFile.Hash
+	}
+
+	// 计算需要同步的文件数量和字节数
 	for relPath, sourceFile := range sourceFiles {
 		targetFile, exists := targetFiles[relPath]
-		if !exists || sourceFile.Hash != targetFile.Hash {
+		if needsCopy(sourceFile, targetFile, exists) {
 			filesToSync++
+			if !sourceFile.IsDir {
+				filesToCopy++
+				bytesToSync += sourceFile.Size
+			}
 		}
 	}
 
-	// 如果没有文件需要同步，直接返回100%进度
-	if filesToSync == 0 {
-		if progressChan != nil {
-			progressChan <- 100
+	// 需要保留在目标目录中的文件
+	var kept []string
+	for relPath := range targetFiles {
+		if matchAny(relPath, opts.KeepInTarget) {
+			kept = append(kept, relPath)
 		}
-		return nil
+	}
+
+	// 源目录中已不存在的目标文件是否在同步结束时删除
+	// 源目录中无法读取、被排除、推迟备份、超过最大层数或路径过长的文件仍然存在，不能当作已删除处理；
+	// 需要保留的文件及包含它们的目录也不删除；备份单个文件时目标中的其他文件都不属于该任务
+	orphaned := func(relPath string) bool {
+		if scan.single {
+			return false
+		}
+		_, exists := sourceFiles[relPath]
+		return !exists && !underAny(relPath, unreadable) && !underAny(relPath, excluded) &&
+			!underAny(relPath, deferred) && !underAny(relPath, tooDeep) && !underAny(relPath, tooLong) &&
+			!containsAny(relPath, kept)
+	}
+
+	// 复制之前按同步完成后的目标检查配额，超出时不做任何修改
+	stats.TargetFiles, stats.TargetBytes = projectTarget(sourceFiles, targetFiles, func(relPath string) bool {
+		return opts.NoDelete || !orphaned(relPath)
+	})
+	if err := checkQuota(stats.TargetFiles, stats.TargetBytes, opts); err != nil {
+		return summary, err
+	}
+
+	// 按字节汇报复制进度
+	var bytesDone int64
+	copyOpts := copyOptions{
+		limiter:       newRateLimiter(opts.RateLimit),
+		shared:        opts.SharedLimiter,
+		reflink:       opts.Reflink,
+		compress:      opts.Compress,
+		compressLevel: opts.CompressLevel,
+		fileMode:      opts.FileMode,
+		wait:          opts.WaitIfPaused,
+		onWrite: func(n int64) {
+			bytesDone += n
+			progress.OnBytes(bytesDone, bytesToSync)
+		},
 	}
 
 	// 同步文件
+	progress.OnPhase(PhaseCopy)
+	copyStart := time.Now()
 	for relPath, sourceFile := range sourceFiles {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		if opts.WaitIfPaused != nil && !opts.DryRun {
+			if err := opts.WaitIfPaused(ctx); err != nil {
+				return summary, err
+			}
+		}
+
+		// 已存在的目标文件使用其实际路径，目标不区分大小写时它与源路径的大小写可能不同
 		targetFile, exists := targetFiles[relPath]
 		targetFilePath := filepath.Join(targetPath, relPath)
+		if exists {
+			targetFilePath = targetFile.Path
+		}
+		if opts.Debugf != nil && !sourceFile.IsDir && opts.ForceFull {
+			opts.Debugf("copy %s: full backup forced", relPath)
+		} else if opts.Debugf != nil && !sourceFile.IsDir {
+			var target *FileInfo
+			if exists && !targetFile.IsDir {
+				target = targetFile
+			}
+			debugDecision(opts.Debugf, relPath, sourceFile, target, opts.MtimePrecision)
+		}
+
+		// 试运行只统计并记录需要复制的文件，不修改目标目录
+		if opts.DryRun {
+			if needsCopy(sourceFile, targetFile, exists) {
+				if !sourceFile.IsDir {
+					filesStarted++
+					progress.OnFile(relPath, filesStarted, filesToCopy)
+					stats.FilesCopied++
+					stats.BytesTransferred += sourceFile.Size
+					entry := PlanEntry{Target: targetPath, Action: PlanAdd, Path: relPath, Size: sourceFile.Size}
+					if exists {
+						entry.Action, entry.TargetSize = PlanChange, targetFile.Size
+					}
+					stats.Plan = append(stats.Plan, entry)
+				}
+				processedFiles++
+			}
+			continue
+		}
+
+		// 内容相同但修改时间超出精度范围时，只更新目标文件的修改时间
+		if !opts.ForceFull && exists && !sourceFile.IsDir && sourceFile.Hash == targetFile.Hash &&
+			!sameModTime(sourceFile.ModTime, targetFile.ModTime, opts.MtimePrecision) {
+			modTimeObj := time.Unix(sourceFile.ModTime, 0)
+			if err := os.Chtimes(targetFilePath, modTimeObj, modTimeObj); err != nil {
+				return summary, fmt.Errorf("failed to update modification time of %s: %v", targetFilePath, err)
+			}
+			refreshTargetInfo(targetFiles, relPath, targetFilePath, sourceFile.Hash)
+		}
 
 		// 如果目标文件不存在或哈希值不同，则复制
-		if !exists || sourceFile.Hash != targetFile.Hash {
+		if needsCopy(sourceFile, targetFile, exists) {
 			if sourceFile.IsDir {
-				if err := os.MkdirAll(targetFilePath, 0755); err != nil {
-					return fmt.Errorf("failed to create directory %s: %v", targetFilePath, err)
+				if err := dirs.mkdirAll(ctx, targetFilePath); err != nil {
+					return summary, fmt.Errorf("failed to create directory %s: %v", targetFilePath, err)
+				}
+				// 父目录可能已在复制其中的文件时创建，这里统一设置权限
+				if opts.DirMode != 0 {
+					if err := os.Chmod(targetFilePath, opts.DirMode); err != nil {
+						return summary, fmt.Errorf("failed to set mode of %s: %v", targetFilePath, err)
+					}
 				}
 			} else {
 				// 确保目标文件的目录存在
-				if err := os.MkdirAll(filepath.Dir(targetFilePath), 0755); err != nil {
-					return fmt.Errorf("failed to create directory for %s: %v", targetFilePath, err)
+				if err := dirs.mkdirAll(ctx, filepath.Dir(targetFilePath)); err != nil {
+					return summary, fmt.Errorf("failed to create directory for %s: %v", targetFilePath, err)
 				}
 
 				// 复制文件
-				if err := copyFile(
-					filepath.Join(sourcePath, relPath),
+				filesStarted++
+				progress.OnFile(relPath, filesStarted, filesToCopy)
+				written, err := copyFile(
+					ctx,
+					sourceFile.Path,
 					targetFilePath,
 					sourceFile.ModTime,
-				); err != nil {
-					return fmt.Errorf("failed to copy file %s: %v", relPath, err)
+					sourceFile.Hash,
+					copyOpts,
+				)
+				stats.BytesTransferred += written
+				if err != nil {
+					return summary, fmt.Errorf("failed to copy file %s: %v", relPath, err)
 				}
+				stats.FilesCopied++
+				refreshTargetInfo(targetFiles, relPath, targetFilePath, sourceFile.Hash)
 			}
 			processedFiles++
-			if progressChan != nil {
-				progress := float64(processedFiles) / float64(filesToSync) * 100
-				progressChan <- progress
-			}
+			progress.OnProgress(float64(processedFiles) / float64(filesToSync) * 100)
 		}
 	}
 
+	stats.CopyDuration = time.Since(copyStart)
+
 	// 删除目标目录中不存在的文件
+	progress.OnPhase(PhaseDelete)
+	var orphans []string
 	for relPath := range targetFiles {
-		if _, exists := sourceFiles[relPath]; !exists {
+		if opts.Debugf != nil {
+			if _, exists := sourceFiles[relPath]; !exists {
+				switch {
+				case scan.single:
+					opts.Debugf("keep %s: not managed by a single-file backup", relPath)
+				case !orphaned(relPath):
+					opts.Debugf("keep %s: not in source, protected by unreadable, exclude, min age, max depth or keep rules", relPath)
+				case opts.NoDelete:
+					opts.Debugf("keep %s: not in source, deletion disabled", relPath)
+				default:
+					opts.Debugf("delete %s: not in source", relPath)
+				}
+			}
+		}
+		if orphaned(relPath) {
+			if opts.NoDelete {
+				stats.FilesOrphaned++
+				continue
+			}
+			orphans = append(orphans, relPath)
+		}
+	}
+
+	// 按路径顺序分批删除，目录排在其中的条目之前，随目录一起删除的条目不再单独删除
+	sort.Strings(orphans)
+	throttle := newDeleteThrottle(opts.DeleteRate, opts.DeleteBatch)
+	removedDirs := make(map[string]bool)
+	if !opts.DryRun && len(orphans) > 0 {
+		progress.OnDelete(0, len(orphans))
+	}
+	for i, relPath := range orphans {
+		targetFile := targetFiles[relPath]
+		if opts.DryRun {
+			stats.FilesDeleted++
+			entry := PlanEntry{Target: targetPath, Action: PlanDelete, Path: relPath, IsDir: targetFile.IsDir}
+			if !targetFile.IsDir {
+				entry.Size = targetFile.Size
+			}
+			stats.Plan = append(stats.Plan, entry)
+			continue
+		}
+		if !removedUnder(relPath, removedDirs) {
+			if err := throttle.wait(ctx, opts.WaitIfPaused); err != nil {
+				return summary, err
+			}
 			targetFilePath := filepath.Join(targetPath, relPath)
 			if err := os.RemoveAll(targetFilePath); err != nil {
-				return fmt.Errorf("failed to remove %s: %v", targetFilePath, err)
+				return summary, fmt.Errorf("failed to remove %s: %v", targetFilePath, err)
+			}
+			if targetFile.IsDir {
+				removedDirs[relPath] = true
 			}
 		}
+		delete(targetFiles, relPath)
+		stats.FilesDeleted++
+		progress.OnDelete(i+1, len(orphans))
+	}
+
+	// 源文件已不存在时，上次中断留下的临时文件不会再续传，随孤立文件一起删除
+	if !opts.DryRun {
+		if err := removeTemps(targetPath, temps, orphaned); err != nil {
+			return summary, err
+		}
+	}
+
+	// 对目标目录中的重复文件去重
+	if opts.Dedup && !opts.DryRun {
+		progress.OnPhase(PhaseDedup)
+		stats.FilesDeduped, stats.BytesReclaimed = dedupTarget(targetPath, sourceFiles)
+	}
+
+	sortPlan(stats.Plan)
+
+	// 保存目标目录的哈希缓存，供下次扫描复用
+	if opts.TargetCacheFile != "" && !opts.DryRun {
+		if err := newHashCache(targetFiles).save(opts.TargetCacheFile, opts); err != nil {
+			log.Printf("Failed to save hash cache %s: %v", opts.TargetCacheFile, err)
+		}
 	}
 
 	// 确保最后发送100%进度
-	if progressChan != nil {
-		progressChan <- 100
+	progress.OnProgress(100)
+	progress.OnPhase(PhaseDone)
+
+	return summary, nil
+}
+
+// ctxError 在 ctx 已被取消时用 ctx.Err() 代替 err，便于调用方判断
+func ctxError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
 	}
+	return err
+}
 
+// refreshTargetInfo 在目标文件被写入后重新读取其大小和修改时间，哈希值沿用源文件的
+// 这样保存的缓存记录与目标文件系统上实际的修改时间一致
+func refreshTargetInfo(targetFiles map[string]*FileInfo, relPath, path, hash string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(targetFiles, relPath)
+		return
+	}
+
+	targetFiles[relPath] = &FileInfo{
+		Path:    path,
+		Size:    info.Size(),
+		Hash:    hash,
+		ModTime: info.ModTime().Unix(),
+		IsDir:   info.IsDir(),
+	}
+}
+
+// removeTemps 删除目标目录中上次复制中断留下的临时文件，temps 为相对于 targetPath 的路径，
+// 只删除去掉后缀后的路径被 orphaned 判断为孤立的临时文件；禁止删除时也删除，它们只是不完整的副本
+func removeTemps(targetPath string, temps []string, orphaned func(relPath string) bool) error {
+	for _, relPath := range temps {
+		if !orphaned(strings.TrimSuffix(relPath, tmpSuffix)) {
+			continue
+		}
+		path := filepath.Join(targetPath, relPath)
+		if err := os.Remove(path); err != nil {
+			// 所在目录可能已随孤立目录一起删除
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+		log.Printf("Removed leftover temporary file %s", path)
+	}
 	return nil
 }
 
+// removedUnder 判断相对路径是否位于已删除的目录中
+func removedUnder(relPath string, removedDirs map[string]bool) bool {
+	for dir := filepath.Dir(relPath); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if removedDirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// underAny 判断相对路径是否等于或位于给定路径列表中的某一项之下
+func underAny(relPath string, paths []string) bool {
+	for _, p := range paths {
+		if relPath == p || strings.HasPrefix(relPath, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny 判断相对路径是否等于给定路径列表中的某一项，或是其上级目录
+func containsAny(relPath string, paths []string) bool {
+	for _, p := range paths {
+		if p == relPath || strings.HasPrefix(p, relPath+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny 判断相对路径是否匹配任一通配符
+// 不含路径分隔符的通配符同时匹配文件名，含分隔符的通配符匹配完整的相对路径
+func matchAny(relPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, relPath); ok {
+			return true
+		}
+		if !strings.ContainsRune(pattern, filepath.Separator) {
+			if ok, _ := filepath.Match(pattern, filepath.Base(relPath)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameModTime 判断两个修改时间（Unix 秒）在给定精度内是否相同
+func sameModTime(a, b int64, precision time.Duration) bool {
+	if precision < time.Second {
+		precision = time.Second
+	}
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	return time.Duration(diff)*time.Second < precision
+}
+
+// copyOptions 复制单个文件时的选项
+type copyOptions struct {
+	limiter       *rateLimiter   // 不为 nil 时限制写入目标的速度
+	shared        *SharedLimiter // 不为 nil 时与其他同步共同限制写入速度
+	reflink       bool           // 优先尝试写时复制克隆
+	compress      bool           // 以 gzip 压缩后写入
+	compressLevel int            // gzip 压缩级别
+	fileMode      os.FileMode    // 目标文件的权限，为 0 时由 umask 决定
+	onWrite       func(n int64)  // 每次写入后回调读取的源文件字节数（续传时已有的部分也会计入）
+	wait          waitFunc       // 不为 nil 时每次读取源文件之前调用，同步被暂停时阻塞
+}
+
 // copyFile 复制文件并保持修改时间
-func copyFile(src, dst string, modTime int64) error {
+// 数据先写入 dst.watchman.tmp，完成后再重命名为 dst；
+// 如果存在上次中断留下的临时文件且与源文件前缀一致，则从已有偏移处继续复制，
+// 续传的结果在重命名之前与 srcHash（扫描时计算的源文件哈希值，为空时从源文件计算）比较
+// 返回本次实际写入的字节数
+func copyFile(ctx context.Context, src, dst string, modTime int64, srcHash string, opts copyOptions) (int64, error) {
 	source, err := os.Open(src)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer source.Close()
 
-	destination, err := os.Create(dst)
+	// 压缩后的内容无法与源文件逐块比较，不续传
+	tmpPath := dst + tmpSuffix
+	var offset int64
+	var digest hash.Hash
+	if !opts.compress {
+		offset, digest, err = resumeOffset(source, tmpPath)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var destination *os.File
+	if offset > 0 {
+		log.Printf("Resuming copy of %s from offset %d", dst, offset)
+		destination, err = os.OpenFile(tmpPath, os.O_WRONLY, 0644)
+	} else {
+		destination, err = os.Create(tmpPath)
+	}
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer destination.Close()
 
-	if _, err := io.Copy(destination, source); err != nil {
-		return err
+	if _, err := source.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := destination.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var written int64
+	if cloned, size := tryClone(destination, source, offset, opts); cloned {
+		written = size
+	} else {
+		var writer io.Writer = destination
+		if opts.limiter != nil || opts.shared != nil {
+			writer = &throttledWriter{ctx: ctx, w: destination, limiter: opts.limiter, shared: opts.shared}
+		}
+		var compressor *gzip.Writer
+		if opts.compress {
+			compressor, err = gzip.NewWriterLevel(writer, opts.compressLevel)
+			if err != nil {
+				return 0, err
+			}
+			writer = compressor
+		}
+		// 续传时在写入的同时继续计算临时文件的哈希值，跳过的空洞按零计入
+		onHole := opts.onWrite
+		if offset > 0 {
+			writer = io.MultiWriter(writer, digest)
+			onHole = func(n int64) {
+				io.CopyN(digest, zeroReader{}, n)
+				if opts.onWrite != nil {
+					opts.onWrite(n)
+				}
+			}
+		}
+		if opts.onWrite != nil {
+			opts.onWrite(offset)
+			writer = &countingWriter{w: writer, onWrite: opts.onWrite}
+		}
+
+		// 稀疏文件（如虚拟机磁盘）只复制有数据的区域，否则空洞会在目标中展开为实际占用的零
+		reader := &contextReader{ctx: ctx, r: source, wait: opts.wait}
+		if regions, size, sparse := sparseRegions(source); sparse && compressor == nil {
+			written, err = copySparse(destination, source, reader, writer, regions, offset, size, onHole)
+		} else {
+			written, err = io.Copy(writer, reader)
+		}
+		if err != nil {
+			return written, err
+		}
+
+		// 压缩时实际写入的字节数为压缩后的大小
+		if compressor != nil {
+			if err := compressor.Close(); err != nil {
+				return written, err
+			}
+			if written, err = destination.Seek(0, io.SeekCurrent); err != nil {
+				return written, err
+			}
+		}
+	}
+	if err := destination.Close(); err != nil {
+		return written, err
+	}
+
+	// 续传的文件在重命名之前与源文件的哈希值比较，源文件在中断期间被修改时从头重新复制
+	if offset > 0 {
+		if srcHash == "" {
+			if srcHash, err = calculateHash(src); err != nil {
+				return written, err
+			}
+		}
+		if hex.EncodeToString(digest.Sum(nil)) != srcHash {
+			log.Printf("Resumed copy of %s does not match the source, copying it again", dst)
+			if err := os.Remove(tmpPath); err != nil {
+				return written, err
+			}
+			n, err := copyFile(ctx, src, dst, modTime, srcHash, opts)
+			return written + n, err
+		}
+	}
+
+	// Chmod 不受 umask 影响
+	if opts.fileMode != 0 {
+		if err := os.Chmod(tmpPath, opts.fileMode); err != nil {
+			return written, err
+		}
 	}
 
 	modTimeObj := time.Unix(modTime, 0)
-	return os.Chtimes(dst, modTimeObj, modTimeObj)
+	if err := os.Chtimes(tmpPath, modTimeObj, modTimeObj); err != nil {
+		return written, err
+	}
+	return written, os.Rename(tmpPath, dst)
+}
+
+// tryClone 在启用 reflink 且不是续传时尝试克隆整个文件，返回是否成功及文件大小
+func tryClone(destination, source *os.File, offset int64, opts copyOptions) (bool, int64) {
+	if !opts.reflink || opts.compress || offset != 0 {
+		return false, 0
+	}
+
+	info, err := source.Stat()
+	if err != nil {
+		return false, 0
+	}
+	if err := cloneFile(destination, source); err != nil {
+		return false, 0
+	}
+
+	if opts.onWrite != nil {
+		opts.onWrite(info.Size())
+	}
+	return true, info.Size()
+}
+
+// countingWriter 在每次写入后回调写入的字节数
+type countingWriter struct {
+	w       io.Writer
+	onWrite func(n int64)
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.onWrite(int64(n))
+	return n, err
+}
+
+// resumeOffset 检查临时文件能否续传，返回可以继续复制的偏移量和已读入临时文件内容的哈希状态
+// 临时文件的全部内容必须与源文件同样长度的开头部分哈希一致，否则返回 0 重新复制
+func resumeOffset(source *os.File, tmpPath string) (int64, hash.Hash, error) {
+	info, err := os.Stat(tmpPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, nil, nil
+	}
+
+	sourceInfo, err := source.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	offset := info.Size()
+	if offset == 0 || offset > sourceInfo.Size() {
+		return 0, nil, nil
+	}
+
+	partial, err := os.Open(tmpPath)
+	if err != nil {
+		return 0, nil, nil
+	}
+	defer partial.Close()
+
+	sourceHash, err := chunkHash(source, 0, offset)
+	if err != nil {
+		return 0, nil, err
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, io.NewSectionReader(partial, 0, offset)); err != nil {
+		return 0, nil, nil
+	}
+	// Sum 不改变哈希状态，续传时继续写入剩余部分
+	if hex.EncodeToString(digest.Sum(nil)) != sourceHash {
+		return 0, nil, nil
+	}
+	return offset, digest, nil
+}
+
+// zeroReader 读出无限的零字节，用于把稀疏文件的空洞计入哈希值
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// chunkHash 计算文件指定区间的SHA256哈希值
+func chunkHash(r io.ReaderAt, offset, length int64) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(r, offset, length)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
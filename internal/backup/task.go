@@ -1,6 +1,53 @@
 package backup
 
-import "time"
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 任务状态
+const (
+	StatusReady       = "Ready"       // 等待下次备份
+	StatusRunning     = "Running"     // 正在备份
+	StatusRetrying    = "Retrying"    // 上次备份失败，将在下次定时触发时重试（设置了重试间隔时按重试间隔）
+	StatusUnavailable = "Unavailable" // 源目录不存在、为空（如外接硬盘未连接）、仍在变化或依赖的任务尚未成功备份，跳过了上次备份，下次定时触发时再检查
+	StatusFatal       = "Fatal"       // 上次备份因重试无法解决的问题失败（如源路径不是目录），需要人工处理
+	StatusDrifted     = "Drifted"     // 启动时的快速校验发现目标与源目录不一致或已不存在，下次备份成功后恢复
+	StatusError       = "Error"       // 任务配置有误，定时器未能启动
+	StatusPaused      = "Paused"      // 已暂停，到期后自动恢复
+	StatusStopped     = "Stopped"     // 已停止
+)
+
+// 任务的同步方向
+const (
+	DirectionPush   = "push"    // 将 SourcePath 备份到 TargetPath（默认）
+	DirectionPull   = "pull"    // 将 TargetPath（如远程挂载的目录）拉取到 SourcePath
+	DirectionTwoWay = "two-way" // 双向同步，尚不支持
+)
+
+// fatalError 表示重试也无法解决、需要人工处理的备份错误
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string { return e.err.Error() }
+
+func (e *fatalError) Unwrap() error { return e.err }
+
+// failureStatus returns the task status for a failed backup
+func failureStatus(err error) string {
+	var fatal *fatalError
+	if errors.As(err, &fatal) {
+		return StatusFatal
+	}
+	return StatusRetrying
+}
 
 // BackupTask represents a backup task
 type BackupTask struct {
@@ -12,4 +59,547 @@ type BackupTask struct {
 	Progress   float64   `json:"progress"`
 	LastBackup time.Time `json:"last_backup"`
 	Error      string    `json:"error,omitempty"`
+
+	// LastErrorTime 最近一次备份失败的时间
+	LastErrorTime time.Time `json:"last_error_time"`
+	// ConsecutiveFailures 连续失败的备份次数，备份成功后清零
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty"`
+	// RetryInterval 备份失败后改用的较短间隔（如 "10m"），直到重试 RetryMax 次仍失败后恢复正常间隔；为空时按正常间隔重试
+	RetryInterval string `json:"retry_interval,omitempty"`
+	// RetryMax 按 RetryInterval 重试的最多次数，为 0 时使用默认值
+	RetryMax int `json:"retry_max,omitempty"`
+	// RetryAttempt 任务处于重试节奏时下次重试的序号（从 1 开始），按正常间隔备份时为 0；只在查询任务时计算，不保存
+	RetryAttempt int `json:"retry_attempt,omitempty"`
+
+	// ScrubInterval 定期重新校验目标中文件哈希的间隔（如 "168h"），为空时不校验
+	ScrubInterval string `json:"scrub_interval,omitempty"`
+	// LastScrub 上次校验完成的时间
+	LastScrub time.Time `json:"last_scrub"`
+	// ScrubCorrupt 和 ScrubRepaired 上次校验发现的损坏文件数和已从源目录修复的文件数
+	ScrubCorrupt  int `json:"scrub_corrupt,omitempty"`
+	ScrubRepaired int `json:"scrub_repaired,omitempty"`
+
+	// Direction 同步方向：push（默认）或 pull
+	Direction string `json:"direction,omitempty"`
+
+	// ScheduleWarning 最近几次成功备份的平均耗时超过备份间隔时的提示，此时备份实际上一个接一个地进行
+	ScheduleWarning string `json:"schedule_warning,omitempty"`
+
+	// ForceFull 下次备份复制所有源文件，不论目标中的文件看起来是否相同；备份成功后自动清除
+	ForceFull bool `json:"force_full,omitempty"`
+
+	// MirrorTargets 除 TargetPath 之外同时备份到的目标目录，源目录只扫描一次
+	MirrorTargets []string `json:"mirror_targets,omitempty"`
+	// TargetStates 上次备份中每个目标的结果，只在配置了 MirrorTargets 时记录
+	TargetStates []TargetState `json:"target_states,omitempty"`
+
+	// CaseInsensitiveTarget 目标文件系统不区分大小写（如 exFAT、macOS 默认的 APFS）
+	CaseInsensitiveTarget bool `json:"case_insensitive_target,omitempty"`
+	// CaseConflicts 上次备份中因与其他源文件只差大小写而跳过的文件数
+	CaseConflicts int `json:"case_conflicts,omitempty"`
+	// LongPaths 上次备份中因在目标中的路径超过系统限制而跳过的文件和目录数（跳过的目录中的内容不计）
+	LongPaths int `json:"long_paths,omitempty"`
+
+	// MtimePrecision 比较修改时间的精度（如 "2s"），为空时根据目标文件系统自动检测
+	MtimePrecision string `json:"mtime_precision,omitempty"`
+
+	// UnreadablePolicy 无法读取的源文件的处理策略：skip、warn（默认）或 fail
+	UnreadablePolicy string `json:"unreadable_policy,omitempty"`
+	// UnreadableFiles 上次备份中因无法读取而跳过的文件数（warn 策略下记录）
+	UnreadableFiles int `json:"unreadable_files,omitempty"`
+
+	// Dedup 备份后将目标目录中内容相同的文件替换为硬链接
+	Dedup bool `json:"dedup,omitempty"`
+
+	// KeepInTarget 目标目录中永不删除的文件的通配符列表
+	KeepInTarget []string `json:"keep_in_target,omitempty"`
+
+	// NoDelete 从不删除目标目录中源目录已不存在的文件
+	NoDelete bool `json:"no_delete,omitempty"`
+	// PathMap 按顺序改写源文件相对路径前缀的规则，如将 src 保存为目标中的 archive/source；拉取时反向应用
+	PathMap []PathMapping `json:"path_map,omitempty"`
+	// DeleteRate 每秒最多删除的目标条目数，为 0 时不限速
+	DeleteRate int `json:"delete_rate,omitempty"`
+	// DeleteBatch 每批删除的条目数，每批之间检查暂停和限速；为 0 时使用默认值
+	DeleteBatch int `json:"delete_batch,omitempty"`
+	// MinFileAge 跳过最近修改过的文件（如 "60s"），留到文件不再变化后的备份中，为空时不跳过
+	MinFileAge string `json:"min_file_age,omitempty"`
+	// QuiesceWindow 源目录在该时长内（如 "5m"）有修改时跳过本次备份，等它静止后再复制，为空时不检查
+	QuiesceWindow string `json:"quiesce_window,omitempty"`
+	// Streaming 逐个目录归并比较源目录和目标目录并立即同步，不在内存中保存完整的文件列表，用于文件数量极多的源目录；
+	// 大小和修改时间都相同的文件视为未变化，不能与需要完整文件列表的选项（如压缩、去重、校验）同时使用
+	Streaming bool `json:"streaming,omitempty"`
+	// MaxDepth 只备份源目录下该层数以内的文件和目录（直接子项为第 1 层），更深的内容不扫描也不从目标中删除；为 0 时不限制
+	MaxDepth int `json:"max_depth,omitempty"`
+	// DeferredFiles 上次备份中因修改时间太近而推迟的文件数
+	DeferredFiles int `json:"deferred_files,omitempty"`
+
+	// AllowEmptySource 源目录为空时仍然备份（会删除目标中的文件），默认将空的源目录视为未挂载而跳过
+	AllowEmptySource bool `json:"allow_empty_source,omitempty"`
+
+	// NoDeleteFirstRun 在第一次成功备份之前不删除目标目录中的文件，便于检查已有的目标目录
+	NoDeleteFirstRun bool `json:"no_delete_first_run,omitempty"`
+
+	// Exclude 源目录中不参与备份的文件和目录的通配符列表
+	Exclude []string `json:"exclude,omitempty"`
+	// ExcludeTypes 按内置的文件类型分组（如 video、cache）排除，与 Exclude 合并使用
+	ExcludeTypes []string `json:"exclude_types,omitempty"`
+	// ExcludedFiles 和 ExcludedBytes 上次备份中被排除规则跳过的文件数和字节数
+	ExcludedFiles int   `json:"excluded_files,omitempty"`
+	ExcludedBytes int64 `json:"excluded_bytes,omitempty"`
+
+	// Reflink 在支持的文件系统上通过写时复制克隆文件
+	Reflink bool `json:"reflink,omitempty"`
+
+	// RehashTarget 每次备份都重新计算目标文件的哈希，不使用缓存
+	RehashTarget bool `json:"rehash_target,omitempty"`
+
+	// Compress 将每个文件单独以 gzip 压缩后写入目标（文件名追加 .gz），保持目录结构
+	Compress bool `json:"compress,omitempty"`
+	// CompressLevel gzip 压缩级别 1-9，为 0 时使用默认级别
+	CompressLevel int `json:"compress_level,omitempty"`
+
+	// ScanWorkers 扫描使用的工作协程数（1-256），启用 AdaptiveScan 时为上限；为 0 时使用默认值
+	ScanWorkers int `json:"scan_workers,omitempty"`
+	// AdaptiveScan 根据存储的吞吐量自动调整扫描的工作协程数
+	AdaptiveScan bool `json:"adaptive_scan,omitempty"`
+	// IncrementalScan 修改时间未变的源目录直接复用上次扫描记录的文件，不读取其中文件的元数据；
+	// 原地修改的文件要等到所在目录变化或完整备份时才会被发现
+	IncrementalScan bool `json:"incremental_scan,omitempty"`
+	// Priority 守护进程限制了同时进行的备份数时的排队优先级，数值大的先开始，默认为 0
+	Priority int `json:"priority,omitempty"`
+	// DependsOn 必须先备份的任务：它们正在备份时等待其完成，最近一次备份未成功或已超过它们自己的间隔时跳过本次备份
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// SkipTargetScan 不扫描目标目录，按上次同步后保存的目标哈希缓存判断需要复制和删除的文件；
+	// 目标中被其他程序修改或删除的文件要等到重新扫描或完整备份时才会修复
+	SkipTargetScan bool `json:"skip_target_scan,omitempty"`
+	// MaxParallelism 同时计算哈希和复制的协程数上限，限制备份占用的 CPU 核数；为 0 时不限制
+	MaxParallelism int `json:"max_parallelism,omitempty"`
+
+	// FileMode 写入目标的文件的权限（八进制，如 0640），为空时由守护进程的 umask 决定
+	FileMode string `json:"file_mode,omitempty"`
+
+	// DirMode 在目标中创建的目录的权限（八进制，如 0750），为空时由守护进程的 umask 决定
+	DirMode string `json:"dir_mode,omitempty"`
+
+	// RateLimit 写入目标的速度上限（字节/秒），为 0 时不限速
+	RateLimit int64 `json:"rate_limit,omitempty"`
+
+	// MinFreeSpace 目标所在文件系统的最小可用空间（字节），低于该值时跳过备份
+	MinFreeSpace int64 `json:"min_free_space,omitempty"`
+
+	// MaxTargetFiles 和 MaxTargetBytes 目标中文件数和字节数的上限，为 0 时不限制
+	MaxTargetFiles int   `json:"max_target_files,omitempty"`
+	MaxTargetBytes int64 `json:"max_target_bytes,omitempty"`
+	// TargetFiles 和 TargetBytes 上次备份后目标中的文件数和字节数，用于计算配额余量
+	TargetFiles int   `json:"target_files,omitempty"`
+	TargetBytes int64 `json:"target_bytes,omitempty"`
+
+	// TotalBytesTransferred 任务所有备份（包括失败的备份）累计写入目标的字节数
+	TotalBytesTransferred int64 `json:"total_bytes_transferred,omitempty"`
+
+	// History 最近的备份记录，按时间先后排列
+	History []RunRecord `json:"history,omitempty"`
+
+	// 临时加速：在 BoostUntil 之前使用 BoostSchedule 代替 Schedule
+	BoostSchedule string    `json:"boost_schedule,omitempty"`
+	BoostUntil    time.Time `json:"boost_until"`
+
+	// SnoozeUntil 暂停到该时间后自动恢复，为零值时未暂停
+	SnoozeUntil time.Time `json:"snooze_until,omitempty"`
+
+	// 临时改用的目标：OriginalTarget 不为空时 TargetPath 为临时目标，恢复时改回 OriginalTarget；
+	// RedirectUntil 不为零值时到期自动恢复
+	OriginalTarget string    `json:"original_target,omitempty"`
+	RedirectUntil  time.Time `json:"redirect_until,omitempty"`
+}
+
+// TargetState is the outcome of the last backup to one of a task's targets
+type TargetState struct {
+	Path       string    `json:"path"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	LastBackup time.Time `json:"last_backup"`
+}
+
+// syncSource returns the directory or file a backup of the task reads from,
+// which is the target path for a pull task
+func (t *BackupTask) syncSource() string {
+	if t.Direction == DirectionPull {
+		return t.TargetPath
+	}
+	return t.SourcePath
+}
+
+// targets returns the task's primary target followed by its mirror targets.
+// A pull task writes to its source path and has no mirrors.
+func (t *BackupTask) targets() []string {
+	if t.Direction == DirectionPull {
+		return []string{t.SourcePath}
+	}
+	return append([]string{t.TargetPath}, t.MirrorTargets...)
+}
+
+// maxHistory is the number of run records kept per task
+const maxHistory = 100
+
+// RunRecord is the outcome of a single backup run
+type RunRecord struct {
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at"`
+	Success          bool      `json:"success"`
+	Error            string    `json:"error,omitempty"`
+	FilesCopied      int       `json:"files_copied"`
+	FilesDeleted     int       `json:"files_deleted"`
+	BytesTransferred int64     `json:"bytes_transferred"`
+	FilesExcluded    int       `json:"files_excluded,omitempty"`
+	BytesExcluded    int64     `json:"bytes_excluded,omitempty"`
+}
+
+// durationSamples is the number of recent successful runs averaged to
+// estimate how long a backup of the task takes
+const durationSamples = 5
+
+// averageDuration returns the mean duration of the task's most recent
+// successful runs, or 0 if it has none
+func (t *BackupTask) averageDuration() time.Duration {
+	var total time.Duration
+	n := 0
+	for i := len(t.History) - 1; i >= 0 && n < durationSamples; i-- {
+		if record := t.History[i]; record.Success {
+			total += record.FinishedAt.Sub(record.StartedAt)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / time.Duration(n)
+}
+
+// recordFailure records a failed backup's error and counts it towards the
+// consecutive failures
+func (t *BackupTask) recordFailure(msg string, at time.Time) {
+	t.Error = msg
+	t.LastErrorTime = at
+	t.ConsecutiveFailures++
+}
+
+// clearState resets the fields the daemon records while running a task, so
+// that a task added by a client keeps only its options
+func (t *BackupTask) clearState() {
+	t.copyState(&BackupTask{})
+}
+
+// copyState copies the fields the daemon records while running a task from
+// another task, keeping the options of t
+func (t *BackupTask) copyState(from *BackupTask) {
+	t.Status = from.Status
+	t.Progress = from.Progress
+	t.LastBackup = from.LastBackup
+	t.Error = from.Error
+	t.LastErrorTime = from.LastErrorTime
+	t.ConsecutiveFailures = from.ConsecutiveFailures
+	t.RetryAttempt = from.RetryAttempt
+	t.LastScrub = from.LastScrub
+	t.ScrubCorrupt = from.ScrubCorrupt
+	t.ScrubRepaired = from.ScrubRepaired
+	t.ScheduleWarning = from.ScheduleWarning
+	t.ForceFull = from.ForceFull
+	t.TargetStates = from.TargetStates
+	t.CaseConflicts = from.CaseConflicts
+	t.LongPaths = from.LongPaths
+	t.UnreadableFiles = from.UnreadableFiles
+	t.DeferredFiles = from.DeferredFiles
+	t.ExcludedFiles = from.ExcludedFiles
+	t.ExcludedBytes = from.ExcludedBytes
+	t.TargetFiles = from.TargetFiles
+	t.TargetBytes = from.TargetBytes
+	t.TotalBytesTransferred = from.TotalBytesTransferred
+	t.History = from.History
+	t.BoostSchedule = from.BoostSchedule
+	t.BoostUntil = from.BoostUntil
+	t.SnoozeUntil = from.SnoozeUntil
+	t.OriginalTarget = from.OriginalTarget
+	t.RedirectUntil = from.RedirectUntil
+}
+
+// addRunRecord appends a run to the task's history, dropping the oldest
+// records once the history is full
+func (t *BackupTask) addRunRecord(record RunRecord) {
+	t.History = append(t.History, record)
+	if len(t.History) > maxHistory {
+		t.History = t.History[len(t.History)-maxHistory:]
+	}
+}
+
+// TaskDetail is the complete state of a task, including runtime scheduling info
+type TaskDetail struct {
+	BackupTask
+	NextBackup    time.Time `json:"next_backup"`
+	FirstBackup   time.Time `json:"first_backup"`             // 定时器启动后尚未开始的首次备份的时间，已开始时为零值
+	Running       bool      `json:"running"`                  // 是否有备份正在进行
+	RunStartedAt  time.Time `json:"run_started_at"`           // 正在进行的备份的开始时间
+	Debug         bool      `json:"debug"`                    // 是否临时开启了详细日志
+	BlockedBy     string    `json:"blocked_by,omitempty"`     // 因该依赖尚未成功备份而跳过了上次备份
+	QueuePosition int       `json:"queue_position,omitempty"` // 等待备份名额时的排队位置（从 1 开始）
+	QueueLength   int       `json:"queue_length,omitempty"`   // 等待名额的备份数
+	SaveError     string    `json:"save_error,omitempty"`     // 配置文件无法写入时的错误，此时任务状态只保存在内存中
+}
+
+// syncOptions builds the sync options from the task's settings
+func (t *BackupTask) syncOptions() (SyncOptions, error) {
+	opts := SyncOptions{
+		SourcePath: t.syncSource(),
+		TargetPath: t.targets()[0],
+	}
+
+	switch t.Direction {
+	case "", DirectionPush:
+	case DirectionPull:
+		if len(t.MirrorTargets) > 0 {
+			return opts, fmt.Errorf("mirror targets cannot be used with direction %s", t.Direction)
+		}
+	case DirectionTwoWay:
+		return opts, fmt.Errorf("direction %s is not supported, use push or pull", t.Direction)
+	default:
+		return opts, fmt.Errorf("invalid direction: %s", t.Direction)
+	}
+
+	// 每个目标只能出现一次，否则同一目录会被同步两次且共用缓存
+	seen := map[string]bool{filepath.Clean(t.TargetPath): true}
+	for _, mirror := range t.MirrorTargets {
+		if mirror == "" {
+			return opts, fmt.Errorf("invalid mirror target: empty path")
+		}
+		if seen[filepath.Clean(mirror)] {
+			return opts, fmt.Errorf("duplicate mirror target: %s", mirror)
+		}
+		seen[filepath.Clean(mirror)] = true
+	}
+
+	if t.MtimePrecision != "" {
+		precision, err := time.ParseDuration(t.MtimePrecision)
+		if err != nil || precision < 0 {
+			return opts, fmt.Errorf("invalid mtime precision: %s", t.MtimePrecision)
+		}
+		opts.MtimePrecision = precision
+	}
+
+	if t.MinFileAge != "" {
+		age, err := time.ParseDuration(t.MinFileAge)
+		if err != nil || age < 0 {
+			return opts, fmt.Errorf("invalid min file age: %s", t.MinFileAge)
+		}
+		opts.MinFileAge = age
+	}
+
+	if t.QuiesceWindow != "" {
+		window, err := time.ParseDuration(t.QuiesceWindow)
+		if err != nil || window < 0 {
+			return opts, fmt.Errorf("invalid quiesce window: %s", t.QuiesceWindow)
+		}
+		opts.QuiesceWindow = window
+	}
+
+	if _, err := t.scrubInterval(); err != nil {
+		return opts, err
+	}
+	if _, err := t.retryInterval(); err != nil {
+		return opts, err
+	}
+	if t.RetryMax < 0 {
+		return opts, fmt.Errorf("invalid retry max: %d", t.RetryMax)
+	}
+
+	if err := checkPathMap(t.PathMap); err != nil {
+		return opts, err
+	}
+	// 拉取时目标目录按映射后的布局保存，需要反向映射回源目录的布局
+	opts.PathMap = t.PathMap
+	if t.Direction == DirectionPull {
+		opts.PathMap = pathMapper(t.PathMap).reversed()
+	}
+
+	if t.DeleteRate < 0 {
+		return opts, fmt.Errorf("invalid delete rate: %d", t.DeleteRate)
+	}
+	if t.DeleteBatch < 0 {
+		return opts, fmt.Errorf("invalid delete batch: %d", t.DeleteBatch)
+	}
+	opts.DeleteRate, opts.DeleteBatch = t.DeleteRate, t.DeleteBatch
+
+	if t.MaxDepth < 0 {
+		return opts, fmt.Errorf("invalid max depth: %d", t.MaxDepth)
+	}
+	opts.MaxDepth = t.MaxDepth
+
+	opts.ForceFull = t.ForceFull
+	opts.Dedup = t.Dedup
+	opts.NoDelete = t.NoDelete || (t.NoDeleteFirstRun && t.LastBackup.IsZero())
+	opts.Reflink = t.Reflink
+	opts.CaseInsensitiveTarget = t.CaseInsensitiveTarget
+
+	if t.ScanWorkers < 0 || t.ScanWorkers > 256 {
+		return opts, fmt.Errorf("invalid scan workers: %d", t.ScanWorkers)
+	}
+	opts.ScanWorkers = t.ScanWorkers
+	opts.AdaptiveScan = t.AdaptiveScan
+
+	if t.SkipTargetScan && t.RehashTarget {
+		return opts, fmt.Errorf("skip target scan requires the target hash cache, which rehash target disables")
+	}
+	opts.SkipTargetScan = t.SkipTargetScan
+
+	// 复制在扫描之后由单个协程依次进行，只需限制扫描的工作协程数（自适应扫描时为上限）
+	if t.MaxParallelism < 0 {
+		return opts, fmt.Errorf("invalid max parallelism: %d", t.MaxParallelism)
+	}
+	if t.MaxParallelism > 0 && (opts.ScanWorkers == 0 || opts.ScanWorkers > t.MaxParallelism) {
+		opts.ScanWorkers = t.MaxParallelism
+	}
+
+	if t.RateLimit < 0 {
+		return opts, fmt.Errorf("invalid rate limit: %d", t.RateLimit)
+	}
+	opts.RateLimit = t.RateLimit
+
+	if t.MaxTargetFiles < 0 {
+		return opts, fmt.Errorf("invalid max target files: %d", t.MaxTargetFiles)
+	}
+	if t.MaxTargetBytes < 0 {
+		return opts, fmt.Errorf("invalid max target bytes: %d", t.MaxTargetBytes)
+	}
+	opts.MaxTargetFiles = t.MaxTargetFiles
+	opts.MaxTargetBytes = t.MaxTargetBytes
+
+	opts.Compress = t.Compress
+	switch {
+	case t.CompressLevel == 0:
+		opts.CompressLevel = gzip.DefaultCompression
+	case t.CompressLevel >= gzip.BestSpeed && t.CompressLevel <= gzip.BestCompression:
+		opts.CompressLevel = t.CompressLevel
+	default:
+		return opts, fmt.Errorf("invalid compress level: %d", t.CompressLevel)
+	}
+
+	for _, pattern := range t.KeepInTarget {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return opts, fmt.Errorf("invalid keep pattern %q: %v", pattern, err)
+		}
+	}
+	opts.KeepInTarget = t.KeepInTarget
+
+	for _, pattern := range t.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return opts, fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+		}
+	}
+	opts.Exclude = t.Exclude
+	if len(t.ExcludeTypes) > 0 {
+		patterns, unknown := expandExcludeTypes(t.ExcludeTypes)
+		if unknown != "" {
+			return opts, fmt.Errorf("invalid exclude type %q, available types: %s",
+				unknown, strings.Join(ExcludeTypeNames(), ", "))
+		}
+		opts.Exclude = append(append([]string(nil), t.Exclude...), patterns...)
+	}
+
+	fileMode, err := parseMode(t.FileMode)
+	if err != nil {
+		return opts, fmt.Errorf("invalid file mode: %s", t.FileMode)
+	}
+	opts.FileMode = fileMode
+
+	dirMode, err := parseMode(t.DirMode)
+	if err != nil {
+		return opts, fmt.Errorf("invalid dir mode: %s", t.DirMode)
+	}
+	opts.DirMode = dirMode
+
+	switch t.UnreadablePolicy {
+	case "":
+		opts.UnreadablePolicy = UnreadableWarn
+	case UnreadableSkip, UnreadableWarn, UnreadableFail:
+		opts.UnreadablePolicy = t.UnreadablePolicy
+	default:
+		return opts, fmt.Errorf("invalid unreadable policy: %s", t.UnreadablePolicy)
+	}
+
+	// 校验和增量扫描依赖完整的文件列表和哈希缓存，流式同步不保存它们
+	if t.Streaming {
+		switch {
+		case t.ScrubInterval != "":
+			return opts, fmt.Errorf("scrub interval cannot be used with streaming, it needs the target hash cache")
+		case t.IncrementalScan:
+			return opts, fmt.Errorf("incremental scan cannot be used with streaming, it needs the full file list")
+		}
+		opts.Streaming = true
+		if err := opts.checkStreaming(); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+// scrubInterval returns the interval between integrity scrubs of the task's
+// targets, or 0 if scrubbing is disabled
+func (t *BackupTask) scrubInterval() (time.Duration, error) {
+	if t.ScrubInterval == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(t.ScrubInterval)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid scrub interval: %s", t.ScrubInterval)
+	}
+	return interval, nil
+}
+
+// defaultRetryMax 未指定 RetryMax 时按 RetryInterval 重试的次数
+const defaultRetryMax = 3
+
+// retryInterval returns the interval between retries after a failed backup,
+// or 0 when failed backups are retried on the normal schedule
+func (t *BackupTask) retryInterval() (time.Duration, error) {
+	if t.RetryInterval == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(t.RetryInterval)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid retry interval: %s", t.RetryInterval)
+	}
+	return interval, nil
+}
+
+// retryLimit returns the number of retries on the retry interval
+func (t *BackupTask) retryLimit() int {
+	if t.RetryMax > 0 {
+		return t.RetryMax
+	}
+	return defaultRetryMax
+}
+
+// retryAttempt returns the number of the next retry while the task is in its
+// retry cadence, or 0 when it runs on its normal schedule: the last backup
+// failed, a retry interval is set and the retries are not used up yet
+func (t *BackupTask) retryAttempt() int {
+	if t.RetryInterval == "" || t.Status != StatusRetrying || t.ConsecutiveFailures == 0 ||
+		t.ConsecutiveFailures > t.retryLimit() {
+		return 0
+	}
+	return t.ConsecutiveFailures
+}
+
+// parseMode 解析八进制的权限位，为空时返回 0
+func parseMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+	return os.FileMode(mode), nil
 }
@@ -0,0 +1,199 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter 将一次同步中写入目标的总速度限制在每秒 rate 字节以内
+type rateLimiter struct {
+	rate    int64
+	mu      sync.Mutex
+	start   time.Time
+	written int64
+}
+
+// newRateLimiter 创建限速器，rate 不大于 0 时返回 nil 表示不限速
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, start: time.Now()}
+}
+
+// wait 记录写入的 n 个字节，写入超前于限速时等待
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	l.written += int64(n)
+	due := time.Duration(float64(l.written) / float64(l.rate) * float64(time.Second))
+	delay := due - time.Since(l.start)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SharedLimiter 令牌桶，限制所有使用它的同步（如守护进程的所有任务）的总写入速度
+// 与单个同步的限速不同，空闲时最多只积累一秒的突发量
+type SharedLimiter struct {
+	rate   float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewSharedLimiter 创建总速度为每秒 rate 字节的限速器；rate 不为正数时返回 nil，表示不限速
+func NewSharedLimiter(rate int64) *SharedLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &SharedLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// SetRate 修改每秒的总字节数，对正在进行的写入立即生效；不为正数时取消限速
+func (l *SharedLimiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = float64(max(rate, 0))
+	l.tokens = l.rate
+	l.last = time.Now()
+}
+
+// wait 从令牌桶中取出 n 个令牌，令牌不足时预支并等待补足所需的时间
+// 预支使并发的写入按到达顺序排队，合计速度不超过 rate；rate 为 0 时不限速
+func (l *SharedLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledWriter 每次写入后按限速器等待，任务自己的限速和共享的限速都不为 nil 时依次等待
+type throttledWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	limiter *rateLimiter
+	shared  *SharedLimiter
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if t.limiter != nil {
+		if err := t.limiter.wait(t.ctx, n); err != nil {
+			return n, err
+		}
+	}
+	if t.shared != nil {
+		return n, t.shared.wait(t.ctx, n)
+	}
+	return n, nil
+}
+
+// contextReader 在 ctx 被取消后停止读取，wait 不为 nil 时每次读取之前调用，同步被暂停时阻塞
+type contextReader struct {
+	ctx  context.Context
+	r    io.Reader
+	wait waitFunc
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if c.wait != nil {
+		if err := c.wait(c.ctx); err != nil {
+			return 0, err
+		}
+	}
+	return c.r.Read(p)
+}
+
+// defaultDeleteBatch 未指定时每批删除的条目数
+const defaultDeleteBatch = 100
+
+// deleteThrottle 将删除目标条目分批进行：每批开始之前检查暂停，设置了速度上限时
+// 按每秒 rate 个条目等待，避免大量删除占满较慢的目标
+type deleteThrottle struct {
+	rate    int
+	batch   int
+	start   time.Time
+	deleted int
+}
+
+// newDeleteThrottle 创建删除的节流器，batch 为 0 时使用默认值，且不超过每秒的速度上限
+func newDeleteThrottle(rate, batch int) *deleteThrottle {
+	if batch <= 0 {
+		batch = defaultDeleteBatch
+		if rate > 0 {
+			batch = min(batch, rate)
+		}
+	}
+	return &deleteThrottle{rate: rate, batch: batch, start: time.Now()}
+}
+
+// wait 在删除下一个条目之前调用，ctx 被取消或暂停等待失败时返回错误
+func (t *deleteThrottle) wait(ctx context.Context, paused waitFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer func() { t.deleted++ }()
+	if t.deleted == 0 || t.deleted%t.batch != 0 {
+		return nil
+	}
+
+	if paused != nil {
+		if err := paused(ctx); err != nil {
+			return err
+		}
+	}
+	if t.rate <= 0 {
+		return nil
+	}
+	due := time.Duration(float64(t.deleted) / float64(t.rate) * float64(time.Second))
+	delay := due - time.Since(t.start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
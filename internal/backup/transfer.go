@@ -0,0 +1,168 @@
+package backup
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow 计算传输速率的移动平均值所用的时间窗口
+const rateWindow = 10 * time.Second
+
+// TransferStatus 任务备份进度的快照
+type TransferStatus struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Progress   float64   `json:"progress"`
+	BytesDone  int64     `json:"bytes_done"`
+	BytesTotal int64     `json:"bytes_total"`
+	Rate       float64   `json:"rate"` // 传输速率（字节/秒）
+	ETA        float64   `json:"eta"`  // 预计剩余时间（秒），-1 表示未知
+	Phase      Phase     `json:"phase,omitempty"`
+	Target     string    `json:"target,omitempty"`      // 正在同步的目标目录
+	File       string    `json:"file,omitempty"`        // 正在复制的文件
+	FileNumber int       `json:"file_number,omitempty"` // 正在复制的文件在需要复制的文件中的序号
+	FilesTotal int       `json:"files_total,omitempty"` // 正在同步的目标需要复制的文件数
+	FileTime   float64   `json:"file_time,omitempty"`   // 已在正在复制的文件上花费的时间（秒）
+	StartedAt  time.Time `json:"started_at"`            // 正在进行的备份的开始时间
+	Paused     bool      `json:"paused,omitempty"`      // 复制是否被 PauseRun 暂停
+	Deleted    int       `json:"deleted,omitempty"`     // 删除阶段已删除的目标条目数
+	ToDelete   int       `json:"to_delete,omitempty"`   // 删除阶段需要删除的目标条目数
+}
+
+// rateSample 某一时刻已完成的字节数
+type rateSample struct {
+	at   time.Time
+	done int64
+}
+
+// transferState 记录正在进行的备份：开始时间和字节进度。它存在于 manager 中也表示任务正在备份
+// 正在进行的校验同样会注册一个，使校验与备份不会重叠
+type transferState struct {
+	startedAt time.Time
+	scrub     bool      // 正在校验目标而不是备份
+	pause     pauseGate // 暂停和恢复备份的复制
+
+	// 备份进度只在这里更新，不占用管理器的锁，读取任务时由 taskProgress 合并
+	mu       sync.Mutex
+	done     int64
+	total    int64
+	samples  []rateSample
+	phase    Phase
+	target   string
+	file     activeFile
+	deleted  int
+	toDelete int
+	progress float64
+}
+
+// activeFile 正在复制的文件及其在需要复制的文件中的序号
+type activeFile struct {
+	path      string
+	n, total  int
+	startedAt time.Time
+}
+
+// update 记录最新的字节进度
+func (t *transferState) update(done, total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done = done
+	t.total = total
+
+	// 每 500 毫秒最多采样一次，并丢弃窗口之外的旧采样
+	now := time.Now()
+	if n := len(t.samples); n > 0 && now.Sub(t.samples[n-1].at) < 500*time.Millisecond {
+		return
+	}
+	t.samples = append(t.samples, rateSample{at: now, done: done})
+	for len(t.samples) > 2 && now.Sub(t.samples[0].at) > rateWindow {
+		t.samples = t.samples[1:]
+	}
+}
+
+// setPhase 记录同步进入的阶段
+func (t *transferState) setPhase(phase Phase) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.phase = phase
+	if phase != PhaseCopy {
+		t.file = activeFile{}
+	}
+	if phase != PhaseDelete {
+		t.deleted, t.toDelete = 0, 0
+	}
+}
+
+// setDeleted 记录目标中孤立的条目目前已删除的数量
+func (t *transferState) setDeleted(done, total int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.deleted, t.toDelete = done, total
+}
+
+// setTarget 记录正在同步的目标目录
+func (t *transferState) setTarget(target string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.target = target
+}
+
+// setProgress 记录备份的总体进度百分比
+func (t *transferState) setProgress(progress float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.progress = progress
+}
+
+// currentProgress 返回备份的总体进度百分比
+func (t *transferState) currentProgress() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.progress
+}
+
+// setFile 记录正在复制的文件，以及它在当前目标需要复制的 n 个文件中的序号
+func (t *transferState) setFile(relPath string, n, total int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.file = activeFile{path: relPath, n: n, total: total, startedAt: time.Now()}
+}
+
+// fillActivity 把当前的阶段、目标、正在复制的文件和删除进度填入 status
+func (t *transferState) fillActivity(status *TransferStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status.Phase, status.Target = t.phase, t.target
+	if t.file.path != "" {
+		status.File, status.FileNumber, status.FilesTotal = t.file.path, t.file.n, t.file.total
+		status.FileTime = time.Since(t.file.startedAt).Seconds()
+	}
+	status.Deleted, status.ToDelete = t.deleted, t.toDelete
+}
+
+// snapshot 返回字节进度、以每秒字节数计的移动平均速率和预计剩余秒数（未知时为 -1）
+func (t *transferState) snapshot() (done, total int64, rate, eta float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	eta = -1
+	if n := len(t.samples); n >= 2 {
+		first, last := t.samples[0], t.samples[n-1]
+		if elapsed := last.at.Sub(first.at).Seconds(); elapsed > 0 {
+			rate = float64(last.done-first.done) / elapsed
+		}
+	}
+	// 流式同步的总字节数未知（为 0），无法估算剩余时间
+	if rate > 0 && t.total > 0 {
+		eta = float64(t.total-t.done) / rate
+	}
+	return t.done, t.total, rate, eta
+}
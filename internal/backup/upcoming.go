@@ -0,0 +1,53 @@
+package backup
+
+import (
+	"sort"
+	"time"
+)
+
+// UpcomingRun 一个任务计划中的备份
+type UpcomingRun struct {
+	Name    string    `json:"name"`
+	At      time.Time `json:"at"`
+	Resumed bool      `json:"resumed,omitempty"` // 暂停结束后恢复时的首次备份
+}
+
+// Upcoming 返回在给定时长内计划开始的备份，按时间排序
+// 间隔短于该时长的任务在其中的每次备份都会出现一次
+func (m *Manager) Upcoming(within time.Duration) []UpcomingRun {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deadline := time.Now().Add(within)
+	var runs []UpcomingRun
+	for name, task := range m.tasks {
+		interval, err := taskInterval(task)
+		if err != nil {
+			continue
+		}
+
+		next, scheduled := m.nextRuns[name]
+		if !scheduled {
+			// 暂停的任务在暂停结束时立即备份一次，之后按间隔执行
+			if task.SnoozeUntil.IsZero() || task.Status == StatusStopped {
+				continue
+			}
+			if !task.SnoozeUntil.After(deadline) {
+				runs = append(runs, UpcomingRun{Name: name, At: task.SnoozeUntil, Resumed: true})
+			}
+			next = task.SnoozeUntil.Add(interval)
+		}
+
+		for ; !next.After(deadline); next = next.Add(interval) {
+			runs = append(runs, UpcomingRun{Name: name, At: next})
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].At.Equal(runs[j].At) {
+			return runs[i].Name < runs[j].Name
+		}
+		return runs[i].At.Before(runs[j].At)
+	})
+	return runs
+}
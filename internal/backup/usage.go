@@ -0,0 +1,65 @@
+package backup
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// TargetUsage 一个备份目标占用的磁盘空间
+type TargetUsage struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"` // 占用的磁盘空间，硬链接的文件只计一次
+	Error string `json:"error,omitempty"`
+}
+
+// TaskUsage 一个任务的所有目标占用的磁盘空间
+type TaskUsage struct {
+	Name    string        `json:"name"`
+	Targets []TargetUsage `json:"targets"`
+	Files   int           `json:"files"`
+	Bytes   int64         `json:"bytes"`
+}
+
+// targetUsage 遍历目标目录，统计文件数和占用的磁盘空间
+// 目标目录尚未创建时返回空的统计；遍历中无法访问的条目会被跳过
+func targetUsage(path string) TargetUsage {
+	usage := TargetUsage{Path: path}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return usage
+	}
+
+	seen := make(map[fileKey]bool)
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == path {
+				return err
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			usage.Bytes += allocatedSize(info)
+			return nil
+		}
+
+		// 去重产生的硬链接共享同一份数据
+		if key, ok := inodeKey(info); ok {
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+		}
+		usage.Files++
+		usage.Bytes += allocatedSize(info)
+		return nil
+	})
+	if err != nil {
+		usage.Error = err.Error()
+	}
+	return usage
+}
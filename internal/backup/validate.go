@@ -0,0 +1,248 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// TaskReport 配置文件中单个任务的校验结果
+type TaskReport struct {
+	Name     string   `json:"name"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// ValidateConfig 加载配置文件并检查每个任务，不启动任何定时器
+// 任务在执行待进行的格式迁移之后检查，迁移会一并返回以便调用者报告，配置文件已是最新版本时为 nil
+// 只有文件无法读取或解析时才返回错误
+func ValidateConfig(configFile string) ([]TaskReport, *ConfigMigration, error) {
+	file, migration, err := readConfig(configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("config file %s does not exist", configFile)
+		}
+		return nil, nil, err
+	}
+	tasks := file.Tasks
+
+	byName := make(map[string]*BackupTask, len(tasks))
+	for i := range tasks {
+		byName[tasks[i].Name] = &tasks[i]
+	}
+
+	seen := make(map[string]bool)
+	reports := make([]TaskReport, 0, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		problems := validateTask(task)
+		if task.Name != "" && seen[task.Name] {
+			problems = append(problems, "duplicate task name")
+		}
+		seen[task.Name] = true
+		if err := dependencyError(byName, task.Name); err != nil {
+			problems = append(problems, err.Error())
+		}
+
+		reports = append(reports, TaskReport{
+			Name:     task.Name,
+			Problems: problems,
+		})
+	}
+	return reports, migration, nil
+}
+
+// resolvePath 将路径转换为绝对路径并展开符号链接，用于判断两个路径是否指向同一目录；
+// 路径尚不存在时只做规范化
+func resolvePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// sameSyncPair 判断两个任务是否将同一源目录同步到同一目标，返回相同的目标
+// 这样的两个任务的定时器会同时写入相同的文件，备份时互相干扰
+func sameSyncPair(a, b *BackupTask) (string, bool) {
+	if resolvePath(a.syncSource()) != resolvePath(b.syncSource()) {
+		return "", false
+	}
+	for _, target := range a.targets() {
+		for _, other := range b.targets() {
+			if resolvePath(target) == resolvePath(other) {
+				return target, true
+			}
+		}
+	}
+	return "", false
+}
+
+// checkTaskName 拒绝不能用作文件名的任务名：任务名是其缓存路径的一部分，
+// 路径分隔符或 ".." 会使缓存位于缓存目录之外
+func checkTaskName(name string) error {
+	if strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid task name %q: must not contain path separators or \"..\"", name)
+	}
+	return nil
+}
+
+// validateTask 检查任务的必填字段、间隔、选项和路径
+func validateTask(task *BackupTask) []string {
+	var problems []string
+
+	if task.Name == "" {
+		problems = append(problems, "missing name")
+	} else if err := checkTaskName(task.Name); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if task.SourcePath == "" {
+		problems = append(problems, "missing source_path")
+	}
+	if task.TargetPath == "" {
+		problems = append(problems, "missing target_path")
+	}
+	if _, err := parseSchedule(task.Schedule); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := task.syncOptions(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if task.MinFreeSpace < 0 {
+		problems = append(problems, "min_free_space must not be negative")
+	}
+	if task.SourcePath != "" && task.TargetPath != "" {
+		pathProblems := checkPaths(task.syncSource(), task.targets()[0])
+		// pull 任务从 target_path 读取、写入 source_path，检查结果中的字段名需要对调
+		if task.Direction == DirectionPull {
+			swap := strings.NewReplacer("source_path", "target_path", "target_path", "source_path")
+			for i, problem := range pathProblems {
+				pathProblems[i] = swap.Replace(problem)
+			}
+		}
+		problems = append(problems, pathProblems...)
+	}
+	for i, mirror := range task.MirrorTargets {
+		if task.SourcePath == "" || mirror == "" {
+			continue
+		}
+		for _, problem := range checkPaths(task.SourcePath, mirror) {
+			problems = append(problems, fmt.Sprintf("mirror_targets[%d]: %s", i, problem))
+		}
+	}
+
+	return problems
+}
+
+// unavailableError 表示源目录暂时不可用（如外接硬盘未连接），本次备份跳过而不是失败
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string { return e.err.Error() }
+
+func (e *unavailableError) Unwrap() error { return e.err }
+
+// checkSource 在备份之前检查任务的源目录或源文件能否备份
+// 源路径不存在，或为空且未设置 allowEmpty 时报告为不可用，因为同步它会清空目标；返回的其他错误都是致命的
+func checkSource(sourcePath string, allowEmpty bool) error {
+	info, err := os.Stat(sourcePath)
+	switch {
+	case os.IsNotExist(err):
+		return &unavailableError{fmt.Errorf("source unavailable: %s does not exist", sourcePath)}
+	case os.IsPermission(err):
+		return &fatalError{fmt.Errorf("source path %s is not accessible: %v", sourcePath, err)}
+	case err != nil:
+		return err
+	case !info.IsDir() && !info.Mode().IsRegular():
+		return &fatalError{fmt.Errorf("source path %s is not a directory or regular file", sourcePath)}
+	}
+
+	// 未挂载的挂载点是一个空目录，同步它会删除目标中的所有文件
+	if !allowEmpty && info.IsDir() {
+		empty, err := isEmptyDir(sourcePath)
+		if err != nil {
+			return &fatalError{fmt.Errorf("source path %s is not accessible: %v", sourcePath, err)}
+		}
+		if empty {
+			return &unavailableError{fmt.Errorf("source unavailable: %s is empty", sourcePath)}
+		}
+	}
+	return nil
+}
+
+// checkTarget 检查目标路径是目录或能够创建为目录
+// 目标作为文件存在或位于文件之下是配置错误，重试无法解决，因此返回致命错误
+func checkTarget(targetPath string) error {
+	info, err := os.Stat(targetPath)
+	switch {
+	case errors.Is(err, syscall.ENOTDIR):
+		return &fatalError{fmt.Errorf("target %s is below a file, expected a directory", targetPath)}
+	case err != nil:
+		// 不存在的目标会在备份时创建，其他错误由备份时报告
+		return nil
+	case info.Mode().IsRegular():
+		return &fatalError{fmt.Errorf("target %s exists and is a file, expected a directory", targetPath)}
+	case !info.IsDir():
+		return &fatalError{fmt.Errorf("target %s exists and is not a directory", targetPath)}
+	}
+	return nil
+}
+
+// isEmptyDir 判断目录中是否没有会被备份的内容，以 . 开头的文件和目录不参与备份，不计入
+func isEmptyDir(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkPaths 检查源路径和目标路径是否合理
+func checkPaths(sourcePath, targetPath string) []string {
+	var problems []string
+
+	if !filepath.IsAbs(sourcePath) {
+		problems = append(problems, "source_path is not an absolute path")
+	}
+	if !filepath.IsAbs(targetPath) {
+		problems = append(problems, "target_path is not an absolute path")
+	}
+
+	if info, err := os.Stat(sourcePath); err != nil {
+		problems = append(problems, fmt.Sprintf("source_path is not accessible: %v", err))
+	} else if !info.IsDir() && !info.Mode().IsRegular() {
+		problems = append(problems, "source_path is not a directory or regular file")
+	}
+
+	if info, err := os.Stat(targetPath); err == nil && !info.IsDir() {
+		problems = append(problems, "target_path exists and is not a directory")
+	}
+
+	// 源目录和目标目录不能相同或相互包含，否则同步会复制或删除自身
+	source, target := filepath.Clean(sourcePath), filepath.Clean(targetPath)
+	switch {
+	case source == target:
+		problems = append(problems, "source_path and target_path are the same")
+	case isWithin(target, source):
+		problems = append(problems, "target_path is inside source_path")
+	case isWithin(source, target):
+		problems = append(problems, "source_path is inside target_path")
+	}
+
+	return problems
+}
+
+// isWithin 判断 path 是否位于 dir 之下
+func isWithin(path, dir string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
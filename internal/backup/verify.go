@@ -0,0 +1,165 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// treeSummary 目录中普通文件的数量和总大小
+type treeSummary struct {
+	files int
+	bytes int64
+}
+
+// summarizeTree 按备份扫描的规则遍历目录，统计其中文件的数量和总大小，不读取文件内容
+// 匹配 skip 的文件和目录、超过 maxDepth 层的内容，以及扫描时跳过的条目（. 开头的条目、复制中断留下的临时文件、
+// 无法解析的符号链接和特殊文件）不计入，指向文件的符号链接按其指向的文件计入；
+// trimGz 时去掉文件名的 .gz 后缀后再匹配，用于压缩的目标
+func summarizeTree(root string, skip []string, maxDepth int, trimGz bool) (treeSummary, error) {
+	if trimGz {
+		skip = slices.Clone(skip)
+		for _, pattern := range skip {
+			skip = append(skip, pattern+gzipSuffix)
+		}
+	}
+	files, _, err := scanDirectory(context.Background(), root, scanOptions{
+		skipUnreadable: true,
+		exclude:        skip,
+		maxDepth:       maxDepth,
+		metadataOnly:   true,
+	})
+	if err != nil {
+		return treeSummary{}, err
+	}
+
+	var summary treeSummary
+	for relPath, file := range files {
+		if file.IsDir || relPath == "." {
+			continue
+		}
+		summary.files++
+		summary.bytes += file.Size
+	}
+	return summary, nil
+}
+
+// checkDrift 快速比较任务的源目录和各个目标的文件数和总大小，返回发现的不一致；
+// exclude 为所有任务额外排除的通配符。源目录不可用时不做比较，留给下次备份处理
+func checkDrift(task *BackupTask, exclude []string) ([]string, error) {
+	opts, err := task.syncOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.Exclude = slices.Concat(opts.Exclude, exclude)
+	source := task.syncSource()
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, nil
+	}
+
+	// 源路径是单个文件时目标中只有同名的这一个文件
+	var want treeSummary
+	if info.Mode().IsRegular() {
+		want = treeSummary{files: 1, bytes: info.Size()}
+	} else if want, err = summarizeTree(source, opts.Exclude, opts.MaxDepth, false); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, target := range task.targets() {
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("target %s does not exist", target))
+			continue
+		}
+
+		var got treeSummary
+		if info.Mode().IsRegular() {
+			name := filepath.Join(target, filepath.Base(source))
+			if opts.Compress {
+				name += gzipSuffix
+			}
+			if fileInfo, err := os.Stat(name); err == nil {
+				got = treeSummary{files: 1, bytes: fileInfo.Size()}
+			}
+		} else {
+			skip := append(append([]string(nil), opts.Exclude...), opts.KeepInTarget...)
+			if got, err = summarizeTree(target, skip, opts.MaxDepth, opts.Compress); err != nil {
+				problems = append(problems, fmt.Sprintf("target %s cannot be read: %v", target, err))
+				continue
+			}
+		}
+
+		// 压缩后的大小无法与源文件比较，只比较文件数；不删除孤立文件时目标中可以多出文件
+		drifted := got.files != want.files || (!opts.Compress && got.bytes != want.bytes)
+		if opts.NoDelete {
+			drifted = got.files < want.files
+		}
+		if drifted {
+			problems = append(problems, fmt.Sprintf("target %s has %d files (%d bytes), source has %d files (%d bytes)",
+				target, got.files, got.bytes, want.files, want.bytes))
+		}
+	}
+	return problems, nil
+}
+
+// VerifyTargets 按文件数和总大小快速比较每个已备份过的任务的目标与源目录，不计算哈希也不复制，
+// 把目标已偏离或已消失的任务标记为 Drifted，下次成功备份后清除该状态
+// 用于守护进程启动后执行一次
+func (m *Manager) VerifyTargets() {
+	m.mu.RLock()
+	var tasks []BackupTask
+	for _, task := range m.tasks {
+		// 停止的任务和从未成功备份过的任务的目标本来就可能与源目录不同
+		if task.Status == StatusStopped || task.Status == StatusError || task.LastBackup.IsZero() {
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+	exclude := slices.Clone(m.opts.Exclude)
+	m.mu.RUnlock()
+
+	log.Printf("Verifying the targets of %d tasks", len(tasks))
+	drifted := 0
+	for i := range tasks {
+		problems, err := checkDrift(&tasks[i], exclude)
+		if err != nil {
+			log.Printf("[Task: %s] Cannot verify targets: %v", tasks[i].Name, err)
+			continue
+		}
+		if len(problems) == 0 {
+			continue
+		}
+		drifted++
+		for _, problem := range problems {
+			log.Printf("[Task: %s] Warning: %s", tasks[i].Name, problem)
+		}
+		m.markDrifted(tasks[i].Name, strings.Join(problems, "; "))
+	}
+	log.Printf("Target verification finished, %d of %d tasks drifted", drifted, len(tasks))
+}
+
+// markDrifted 将任务标记为目标与源目录不一致
+// 校验期间已开始备份（如启动时的首次备份）的任务只记录事件，由这次备份重新同步
+func (m *Manager) markDrifted(name, problem string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, exists := m.tasks[name]
+	if !exists || task.Status == StatusStopped {
+		return
+	}
+	if _, running := m.transfers[name]; running || task.Status == StatusRunning {
+		log.Printf("[Task: %s] A backup is already in progress and will resync the target", name)
+		m.events.publish(Event{Type: EventDrifted, Task: name, Status: task.Status, Error: problem})
+		return
+	}
+	task.Status = StatusDrifted
+	task.Error = problem
+	m.events.publish(Event{Type: EventDrifted, Task: name, Status: task.Status, Error: task.Error})
+	m.persist()
+}
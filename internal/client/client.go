@@ -1,8 +1,13 @@
 package client
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"syscall"
+	"time"
 
 	"github.com/tangthinker/watchman/internal/ipc"
 )
@@ -11,14 +16,50 @@ type Client struct {
 	conn net.Conn
 }
 
-// NewClient creates a new Unix domain socket client
+// DefaultConnectTimeout is how long NewClient keeps retrying while the
+// daemon's socket does not accept connections yet
+const DefaultConnectTimeout = 2 * time.Second
+
+// 重试连接的间隔，从 minRetryDelay 开始每次翻倍，不超过 maxRetryDelay
+const (
+	minRetryDelay = 50 * time.Millisecond
+	maxRetryDelay = 500 * time.Millisecond
+)
+
+// NewClient creates a new Unix domain socket client, retrying for up to
+// DefaultConnectTimeout while the daemon is still starting
 func NewClient() (*Client, error) {
-	conn, err := net.Dial("unix", ipc.SockAddr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to daemon: %v", err)
-	}
+	return Dial(DefaultConnectTimeout)
+}
 
-	return &Client{conn: conn}, nil
+// Dial connects to the daemon. While the socket does not exist yet or
+// refuses connections, as right after the daemon was started, it retries
+// with backoff until timeout has elapsed; other errors fail immediately.
+// A timeout of 0 tries only once.
+func Dial(timeout time.Duration) (*Client, error) {
+	deadline := time.Now().Add(timeout)
+	delay := minRetryDelay
+	for {
+		conn, err := net.Dial("unix", ipc.SockAddr)
+		if err == nil {
+			return &Client{conn: conn}, nil
+		}
+
+		// 守护进程尚未创建 socket 或尚未开始监听时重试
+		if !errors.Is(err, syscall.ENOENT) && !errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, fmt.Errorf("failed to connect to daemon: %v", err)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if timeout > 0 {
+				return nil, fmt.Errorf("failed to connect to daemon: no daemon accepted connections on %s within %s: %v",
+					ipc.SockAddr, timeout, err)
+			}
+			return nil, fmt.Errorf("failed to connect to daemon: %v", err)
+		}
+		time.Sleep(min(delay, remaining))
+		delay = min(2*delay, maxRetryDelay)
+	}
 }
 
 // Close closes the client connection
@@ -26,53 +67,119 @@ func (c *Client) Close() error {
 	return c.conn.Close()
 }
 
-// SendCommand sends a command to the daemon and returns the response
-func (c *Client) SendCommand(cmd *ipc.Command) (*ipc.Response, error) {
-	// Marshal and send command
+// send marshals and writes a command to the daemon
+func (c *Client) send(cmd *ipc.Command) error {
 	data, err := cmd.Marshal()
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal command: %v", err)
+		return fmt.Errorf("failed to marshal command: %v", err)
 	}
 
 	if _, err := c.conn.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to send command: %v", err)
+		return fmt.Errorf("failed to send command: %v", err)
 	}
+	return nil
+}
 
-	// Read response
-	buf := make([]byte, 4096)
-	n, err := c.conn.Read(buf)
-	if err != nil {
+// SendCommand sends a command to the daemon and returns the response
+func (c *Client) SendCommand(cmd *ipc.Command) (*ipc.Response, error) {
+	if err := c.send(cmd); err != nil {
+		return nil, err
+	}
+
+	// Read response. A decoder is used so responses larger than a single
+	// read (e.g. full task details) are received completely.
+	var resp ipc.Response
+	if err := json.NewDecoder(c.conn).Decode(&resp); err != nil {
 		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
-	// Unmarshal response
-	resp, err := ipc.UnmarshalResponse(buf[:n])
+	return &resp, nil
+}
+
+// AddTask sends an add task command to the daemon and returns the added task,
+// including when its first backup runs. The task is nil if it was deleted
+// right after being added.
+// options holds optional task settings keyed by their json field names.
+func (c *Client) AddTask(name, sourcePath, targetPath, schedule string, options map[string]any) (map[string]interface{}, error) {
+	payload := map[string]any{
+		"name":        name,
+		"source_path": sourcePath,
+		"target_path": targetPath,
+		"schedule":    schedule,
+	}
+	for key, value := range options {
+		payload[key] = value
+	}
+	cmd := ipc.NewCommand(ipc.CmdAdd, payload)
+
+	resp, err := c.SendCommand(cmd)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
 	}
 
-	return resp, nil
+	task, _ := resp.Data.(map[string]interface{})
+	return task, nil
 }
 
-// AddTask sends an add task command to the daemon
-func (c *Client) AddTask(name, sourcePath, targetPath, schedule string) error {
-	cmd := ipc.NewCommand(ipc.CmdAdd, map[string]any{
+// AddTasks adds several tasks in one request. Each task holds its fields
+// keyed by their json names, including name, source_path, target_path and
+// schedule. Either all tasks are added or none are. The result holds the
+// number of added tasks in "count" and the tasks themselves in "tasks".
+func (c *Client) AddTasks(tasks []map[string]any, force bool) (map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdAddBatch, map[string]any{
+		"tasks": tasks,
+		"force": force,
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	result, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return result, nil
+}
+
+// PreviewTask asks the daemon for the files the first backup of a task
+// would copy, overwrite and delete, without adding the task
+func (c *Client) PreviewTask(name, sourcePath, targetPath, schedule string, options map[string]any) (map[string]interface{}, error) {
+	payload := map[string]any{
 		"name":        name,
 		"source_path": sourcePath,
 		"target_path": targetPath,
 		"schedule":    schedule,
-	})
+		"dry_run":     true,
+	}
+	for key, value := range options {
+		payload[key] = value
+	}
+	cmd := ipc.NewCommand(ipc.CmdAdd, payload)
 
 	resp, err := c.SendCommand(cmd)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !resp.Success {
-		return fmt.Errorf(resp.Error)
+		return nil, errors.New(resp.Error)
 	}
 
-	return nil
+	result, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return result, nil
 }
 
 // ListTasks sends a list tasks command to the daemon
@@ -85,43 +192,535 @@ func (c *Client) ListTasks() (interface{}, error) {
 	}
 
 	if !resp.Success {
-		return nil, fmt.Errorf(resp.Error)
+		return nil, errors.New(resp.Error)
 	}
 
 	return resp.Data, nil
 }
 
-// DeleteTask sends a delete task command to the daemon
-func (c *Client) DeleteTask(name string) error {
-	cmd := ipc.NewCommand(ipc.CmdDelete, map[string]any{
+// GetTask sends a get command and returns the full detail of a task
+func (c *Client) GetTask(name string) (map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdGet, map[string]any{
+		"name": name,
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	task, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return task, nil
+}
+
+// Inspect returns a snapshot of a task's running backup, including the file
+// being copied and its position among the files to copy
+func (c *Client) Inspect(name string) (map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdInspect, map[string]any{
+		"name": name,
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	status, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return status, nil
+}
+
+// History sends a history command and returns the matching run records.
+// since limits the runs to a recent window; 0 returns all runs.
+func (c *Client) History(name string, since time.Duration, failedOnly bool) (map[string]interface{}, error) {
+	payload := map[string]any{
+		"name":        name,
+		"failed_only": failedOnly,
+	}
+	if since > 0 {
+		payload["since"] = since.String()
+	}
+	cmd := ipc.NewCommand(ipc.CmdHistory, payload)
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	result, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return result, nil
+}
+
+// TailLog streams the daemon's new log lines at or above the given level
+// (info, warn or error; empty for all). Lines are delivered on the returned
+// channel, which is closed when the connection ends.
+func (c *Client) TailLog(level string) (<-chan map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdTailLog, map[string]any{
+		"level": level,
+	})
+	if err := c.send(cmd); err != nil {
+		return nil, err
+	}
+
+	// 第一个响应确认是否开始输出
+	decoder := json.NewDecoder(c.conn)
+	var resp ipc.Response
+	if err := decoder.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	lines := make(chan map[string]interface{})
+	go func() {
+		defer close(lines)
+		for {
+			var resp ipc.Response
+			if err := decoder.Decode(&resp); err != nil {
+				return
+			}
+			if line, ok := resp.Data.(map[string]interface{}); ok {
+				lines <- line
+			}
+		}
+	}()
+	return lines, nil
+}
+
+// Subscribe subscribes to the events of all tasks. Events are delivered on
+// the returned channel, which is closed when the connection ends.
+func (c *Client) Subscribe() (<-chan map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdSubscribe, nil)
+	if err := c.send(cmd); err != nil {
+		return nil, err
+	}
+
+	// 第一个响应确认订阅是否成功
+	decoder := json.NewDecoder(c.conn)
+	var resp ipc.Response
+	if err := decoder.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	events := make(chan map[string]interface{})
+	go func() {
+		defer close(events)
+		for {
+			var resp ipc.Response
+			if err := decoder.Decode(&resp); err != nil {
+				return
+			}
+			if event, ok := resp.Data.(map[string]interface{}); ok {
+				events <- event
+			}
+		}
+	}()
+	return events, nil
+}
+
+// Plan returns the changes the next backup of a task would make to its targets
+func (c *Client) Plan(name string) (map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdPlan, map[string]any{
 		"name": name,
 	})
 
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	result, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return result, nil
+}
+
+// Upcoming returns the backups scheduled to start within the given window
+func (c *Client) Upcoming(within time.Duration) (map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdUpcoming, map[string]any{
+		"within": within.String(),
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	result, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return result, nil
+}
+
+// Usage sends a usage command and returns the disk space used by each
+// task's targets and the total
+func (c *Client) Usage() (map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdUsage, nil)
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	result, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return result, nil
+}
+
+// SetGlobal changes a daemon-wide setting such as max-concurrent; an empty
+// value reverts it to the daemon's startup value
+func (c *Client) SetGlobal(key, value string) error {
+	cmd := ipc.NewCommand(ipc.CmdSetGlobal, map[string]any{
+		"key":   key,
+		"value": value,
+	})
+
 	resp, err := c.SendCommand(cmd)
 	if err != nil {
 		return err
 	}
 
 	if !resp.Success {
-		return fmt.Errorf(resp.Error)
+		return errors.New(resp.Error)
 	}
 
 	return nil
 }
 
-// StopTask sends a stop task command to the daemon
-func (c *Client) StopTask(name string) error {
+// Globals returns the current value of every daemon-wide setting
+func (c *Client) Globals() (map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdGetGlobal, nil)
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	result, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return result, nil
+}
+
+// Watch streams progress events for a task, calling fn for each event
+// until the daemon ends the stream
+func (c *Client) Watch(name string, fn func(event map[string]interface{})) error {
+	cmd := ipc.NewCommand(ipc.CmdWatch, map[string]any{
+		"name": name,
+	})
+	if err := c.send(cmd); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(c.conn)
+	for {
+		var resp ipc.Response
+		if err := decoder.Decode(&resp); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read event: %v", err)
+		}
+
+		if !resp.Success {
+			return errors.New(resp.Error)
+		}
+
+		event, ok := resp.Data.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("unexpected event data: %T", resp.Data)
+		}
+		fn(event)
+	}
+}
+
+// DeleteTask sends a delete task command to the daemon and returns the task
+// as it was before deletion
+func (c *Client) DeleteTask(name string) (map[string]interface{}, error) {
+	cmd := ipc.NewCommand(ipc.CmdDelete, map[string]any{
+		"name": name,
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	task, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return task, nil
+}
+
+// StopTask sends a stop task command to the daemon and returns the stopped
+// task. Its "running" field is true if a backup in progress will still finish.
+func (c *Client) StopTask(name string) (map[string]interface{}, error) {
 	cmd := ipc.NewCommand(ipc.CmdStop, map[string]any{
 		"name": name,
 	})
 
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Error)
+	}
+
+	task, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response data: %T", resp.Data)
+	}
+	return task, nil
+}
+
+// BoostTask sends a boost command to temporarily change a task's interval
+func (c *Client) BoostTask(name, schedule string, duration time.Duration) error {
+	cmd := ipc.NewCommand(ipc.CmdBoost, map[string]any{
+		"name":     name,
+		"schedule": schedule,
+		"duration": duration.String(),
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// SetTarget temporarily points a task at another target, restoring the
+// original one after revertAfter if it is greater than 0
+func (c *Client) SetTarget(name, path string, revertAfter time.Duration) error {
+	payload := map[string]any{
+		"name": name,
+		"path": path,
+	}
+	if revertAfter > 0 {
+		payload["revert_after"] = revertAfter.String()
+	}
+	cmd := ipc.NewCommand(ipc.CmdSetTarget, payload)
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// PauseRun pauses the copying of a task's running backup, resuming it
+// automatically after d if it is greater than 0
+func (c *Client) PauseRun(name string, d time.Duration) error {
+	payload := map[string]any{
+		"name": name,
+	}
+	if d > 0 {
+		payload["duration"] = d.String()
+	}
+	cmd := ipc.NewCommand(ipc.CmdPauseRun, payload)
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// ResumeRun resumes a backup paused by PauseRun
+func (c *Client) ResumeRun(name string) error {
+	cmd := ipc.NewCommand(ipc.CmdPauseRun, map[string]any{
+		"name":   name,
+		"resume": true,
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// RevertTarget restores the target a task had before SetTarget
+func (c *Client) RevertTarget(name string) error {
+	cmd := ipc.NewCommand(ipc.CmdSetTarget, map[string]any{
+		"name": name,
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// SnoozeTask sends a snooze command to pause a task for the given duration
+func (c *Client) SnoozeTask(name string, duration time.Duration) error {
+	cmd := ipc.NewCommand(ipc.CmdSnooze, map[string]any{
+		"name":     name,
+		"duration": duration.String(),
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// SetDebug turns verbose per-file logging on or off for a task
+func (c *Client) SetDebug(name string, on bool) error {
+	cmd := ipc.NewCommand(ipc.CmdDebug, map[string]any{
+		"name": name,
+		"on":   on,
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// FullBackup asks the daemon to copy every source file on a task's next
+// backup, optionally starting it right away
+func (c *Client) FullBackup(name string, now bool) error {
+	cmd := ipc.NewCommand(ipc.CmdFull, map[string]any{
+		"name": name,
+		"now":  now,
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// ScrubTask asks the daemon to re-verify a task's targets against their
+// recorded hashes now; the scrub runs in the background
+func (c *Client) ScrubTask(name string) error {
+	cmd := ipc.NewCommand(ipc.CmdScrub, map[string]any{
+		"name": name,
+	})
+
+	resp, err := c.SendCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// RescanTask asks the daemon to discard a task's target hash cache,
+// optionally starting a backup right away
+func (c *Client) RescanTask(name string, now bool) error {
+	cmd := ipc.NewCommand(ipc.CmdRescan, map[string]any{
+		"name": name,
+		"now":  now,
+	})
+
 	resp, err := c.SendCommand(cmd)
 	if err != nil {
 		return err
 	}
 
 	if !resp.Success {
-		return fmt.Errorf(resp.Error)
+		return errors.New(resp.Error)
 	}
 
 	return nil
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/tangthinker/watchman/internal/backup"
+)
+
+// healthTimeout 管理器在该时长内没有响应时认为守护进程已卡住
+const healthTimeout = 5 * time.Second
+
+// HealthServer serves /healthz and /readyz over HTTP for container
+// liveness and readiness probes, independent of the control socket. It also
+// serves per-task counters at /metrics in the Prometheus text format.
+type HealthServer struct {
+	manager  *backup.Manager
+	listener net.Listener
+	server   *http.Server
+	ready    atomic.Bool
+}
+
+// NewHealthServer listens on addr, such as ":8080". The server reports not
+// ready until SetReady is called.
+func NewHealthServer(addr string, manager *backup.Manager) (*HealthServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	h := &HealthServer{manager: manager, listener: listener}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+	mux.HandleFunc("/metrics", h.handleMetrics)
+	h.server = &http.Server{Handler: mux, ReadHeaderTimeout: healthTimeout}
+	return h, nil
+}
+
+// Start serves health checks until the server is closed
+func (h *HealthServer) Start() error {
+	if err := h.server.Serve(h.listener); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("health server failed: %v", err)
+	}
+	return nil
+}
+
+// SetReady marks the daemon as ready once its tasks are loaded and the
+// control socket is listening
+func (h *HealthServer) SetReady() {
+	h.ready.Store(true)
+}
+
+// Close stops the health server
+func (h *HealthServer) Close() error {
+	return h.server.Close()
+}
+
+// handleHealthz 管理器的锁能及时获取时返回 200，与 systemd 看门狗的检查方式相同
+func (h *HealthServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	done := make(chan struct{})
+	go func() {
+		h.manager.ListTasks()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		fmt.Fprintln(w, "ok")
+	case <-time.After(healthTimeout):
+		http.Error(w, "backup manager is not responding", http.StatusServiceUnavailable)
+	}
+}
+
+// handleReadyz 任务加载完成、socket 开始监听后返回 200
+func (h *HealthServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !h.ready.Load() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// handleMetrics 以 Prometheus 文本格式输出每个任务的累计传输字节数和最近一次备份的结果
+func (h *HealthServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	tasks := h.manager.ListTasks()
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP watchman_task_bytes_transferred_total Bytes written to the targets by all backups of the task.")
+	fmt.Fprintln(w, "# TYPE watchman_task_bytes_transferred_total counter")
+	for _, task := range tasks {
+		fmt.Fprintf(w, "watchman_task_bytes_transferred_total{task=%q} %d\n", task.Name, task.TotalBytesTransferred)
+	}
+	fmt.Fprintln(w, "# HELP watchman_task_last_run_bytes_transferred Bytes written to the targets by the most recent backup of the task.")
+	fmt.Fprintln(w, "# TYPE watchman_task_last_run_bytes_transferred gauge")
+	for _, task := range tasks {
+		if n := len(task.History); n > 0 {
+			fmt.Fprintf(w, "watchman_task_last_run_bytes_transferred{task=%q} %d\n", task.Name, task.History[n-1].BytesTransferred)
+		}
+	}
+}
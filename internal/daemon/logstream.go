@@ -0,0 +1,90 @@
+package daemon
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 日志级别，按严重程度递增
+// 守护进程使用标准库 log 输出不带级别的日志，级别根据日志内容推断
+const (
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// logBufferSize 每个订阅者缓冲的日志行数，订阅者来不及处理时丢弃新的日志
+const logBufferSize = 256
+
+// logHub is an io.Writer that passes every log line written to it on to
+// the clients tailing the log, without ever blocking the logger
+type logHub struct {
+	mu   sync.Mutex
+	subs map[chan string]struct{}
+}
+
+func newLogHub() *logHub {
+	return &logHub{subs: make(map[chan string]struct{})}
+}
+
+// Write 将一行日志分发给所有订阅者；标准库 log 每次调用 Write 写入一整行
+func (h *logHub) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		select {
+		case sub <- line:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// subscribe 注册一个订阅者，返回接收日志行的通道和取消订阅的函数
+func (h *logHub) subscribe() (<-chan string, func()) {
+	sub := make(chan string, logBufferSize)
+	h.mu.Lock()
+	h.subs[sub] = struct{}{}
+	h.mu.Unlock()
+
+	return sub, func() {
+		h.mu.Lock()
+		delete(h.subs, sub)
+		h.mu.Unlock()
+	}
+}
+
+// 推断日志级别的关键词，按整词匹配，避免匹配到任务详情中的字段名（如 Error:、ConsecutiveFailures）
+var (
+	errorWords = regexp.MustCompile(`(?i)\b(failed|panic)\b`)
+	warnWords  = regexp.MustCompile(`(?i)\b(warning|skipping|skipped)\b`)
+)
+
+// logLevel 根据日志内容推断级别：包含 failed、panic 的为 error，包含 warning、skipping 的为 warn
+func logLevel(line string) string {
+	switch {
+	case errorWords.MatchString(line):
+		return LevelError
+	case warnWords.MatchString(line):
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
+
+// levelRank 返回级别的严重程度，未知的级别返回错误
+func levelRank(level string) (int, error) {
+	switch level {
+	case "", LevelInfo:
+		return 0, nil
+	case LevelWarn:
+		return 1, nil
+	case LevelError:
+		return 2, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q, expected info, warn or error", level)
+}
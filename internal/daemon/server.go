@@ -1,18 +1,36 @@
 package daemon
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/tangthinker/watchman/internal/backup"
 	"github.com/tangthinker/watchman/internal/ipc"
 )
 
+// maxConnections is the maximum number of client connections handled at once
+const maxConnections = 32
+
+// maxStreams is the maximum number of WATCH, SUBSCRIBE and TAIL clients. They
+// are counted separately so that long-lived streams cannot lock out commands.
+const maxStreams = 32
+
+// commandTimeout is how long a client has to send its command after
+// connecting, so idle connections do not hold a connection slot
+const commandTimeout = 10 * time.Second
+
 type Server struct {
 	listener net.Listener
 	manager  *backup.Manager
+	conns    chan struct{} // semaphore limiting concurrent connections
+	streams  chan struct{} // semaphore limiting concurrent streaming clients
+	logs     *logHub       // fans out the daemon's log lines to TAIL clients
 }
 
 // NewServer creates a new Unix domain socket server
@@ -37,9 +55,18 @@ func NewServer(manager *backup.Manager) (*Server, error) {
 	return &Server{
 		listener: listener,
 		manager:  manager,
+		conns:    make(chan struct{}, maxConnections),
+		streams:  make(chan struct{}, maxStreams),
+		logs:     newLogHub(),
 	}, nil
 }
 
+// LogWriter returns a writer whose lines are streamed to clients tailing the
+// daemon's log; the daemon adds it to the log output
+func (s *Server) LogWriter() io.Writer {
+	return s.logs
+}
+
 // Start starts the server and handles incoming connections
 func (s *Server) Start() error {
 	for {
@@ -47,7 +74,24 @@ func (s *Server) Start() error {
 		if err != nil {
 			return fmt.Errorf("failed to accept connection: %v", err)
 		}
-		go s.handleConnection(conn)
+
+		// Reject the client when too many connections are being handled
+		select {
+		case s.conns <- struct{}{}:
+		default:
+			log.Printf("Rejecting connection: too many concurrent connections")
+			sendError(conn, fmt.Errorf("too many concurrent connections, try again later"))
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			// 流式命令开始后提前释放连接名额，不再与普通命令共用
+			var once sync.Once
+			release := func() { once.Do(func() { <-s.conns }) }
+			defer release()
+			s.handleConnection(conn, release)
+		}()
 	}
 }
 
@@ -59,21 +103,52 @@ func (s *Server) Close() error {
 	return os.RemoveAll(ipc.SockAddr)
 }
 
-func (s *Server) handleConnection(conn net.Conn) {
+func (s *Server) handleConnection(conn net.Conn, release func()) {
 	defer conn.Close()
 
-	// Read command
-	buf := make([]byte, 4096)
-	n, err := conn.Read(buf)
-	if err != nil {
-		log.Printf("Failed to read from connection: %v", err)
+	// A panic in a handler must not bring down the daemon and its backups
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic while handling connection: %v", r)
+			sendError(conn, fmt.Errorf("internal error: %v", r))
+		}
+	}()
+
+	// Read command. A decoder is used so commands larger than a single read
+	// (e.g. a batch of tasks) are received completely.
+	var cmd ipc.Command
+	conn.SetReadDeadline(time.Now().Add(commandTimeout))
+	if err := json.NewDecoder(conn).Decode(&cmd); err != nil {
+		if err == io.EOF {
+			log.Printf("Failed to read from connection: %v", err)
+			return
+		}
+		sendError(conn, fmt.Errorf("invalid command: %v", err))
 		return
 	}
+	conn.SetReadDeadline(time.Time{})
 
-	// Parse command
-	cmd, err := ipc.UnmarshalCommand(buf[:n])
-	if err != nil {
-		sendError(conn, fmt.Errorf("invalid command: %v", err))
+	// Streaming commands write their own sequence of responses and hold a
+	// streaming slot instead of a connection slot
+	if cmd.Type == ipc.CmdWatch || cmd.Type == ipc.CmdSubscribe || cmd.Type == ipc.CmdTailLog {
+		release()
+		select {
+		case s.streams <- struct{}{}:
+			defer func() { <-s.streams }()
+		default:
+			log.Printf("Rejecting %s: too many streaming clients", cmd.Type)
+			sendError(conn, fmt.Errorf("too many streaming clients, try again later"))
+			return
+		}
+
+		switch cmd.Type {
+		case ipc.CmdWatch:
+			s.handleWatch(conn, cmd.Payload)
+		case ipc.CmdSubscribe:
+			s.handleSubscribe(conn)
+		case ipc.CmdTailLog:
+			s.handleTailLog(conn, cmd.Payload)
+		}
 		return
 	}
 
@@ -82,12 +157,46 @@ func (s *Server) handleConnection(conn net.Conn) {
 	switch cmd.Type {
 	case ipc.CmdAdd:
 		resp = s.handleAdd(cmd.Payload)
+	case ipc.CmdAddBatch:
+		resp = s.handleAddBatch(cmd.Payload)
 	case ipc.CmdList:
 		resp = s.handleList()
 	case ipc.CmdDelete:
 		resp = s.handleDelete(cmd.Payload)
 	case ipc.CmdStop:
 		resp = s.handleStop(cmd.Payload)
+	case ipc.CmdBoost:
+		resp = s.handleBoost(cmd.Payload)
+	case ipc.CmdSetTarget:
+		resp = s.handleSetTarget(cmd.Payload)
+	case ipc.CmdPauseRun:
+		resp = s.handlePauseRun(cmd.Payload)
+	case ipc.CmdSetGlobal:
+		resp = s.handleSetGlobal(cmd.Payload)
+	case ipc.CmdGetGlobal:
+		resp = ipc.NewResponse(true, map[string]interface{}{"settings": s.manager.Globals()}, nil)
+	case ipc.CmdGet:
+		resp = s.handleGet(cmd.Payload)
+	case ipc.CmdHistory:
+		resp = s.handleHistory(cmd.Payload)
+	case ipc.CmdInspect:
+		resp = s.handleInspect(cmd.Payload)
+	case ipc.CmdRescan:
+		resp = s.handleRescan(cmd.Payload)
+	case ipc.CmdFull:
+		resp = s.handleFull(cmd.Payload)
+	case ipc.CmdScrub:
+		resp = s.handleScrub(cmd.Payload)
+	case ipc.CmdSnooze:
+		resp = s.handleSnooze(cmd.Payload)
+	case ipc.CmdUsage:
+		resp = s.handleUsage()
+	case ipc.CmdPlan:
+		resp = s.handlePlan(cmd.Payload)
+	case ipc.CmdUpcoming:
+		resp = s.handleUpcoming(cmd.Payload)
+	case ipc.CmdDebug:
+		resp = s.handleDebug(cmd.Payload)
 	default:
 		resp = ipc.NewResponse(false, nil, fmt.Errorf("unknown command type: %s", cmd.Type))
 	}
@@ -113,25 +222,85 @@ func (s *Server) handleAdd(payload map[string]any) *ipc.Response {
 		return ipc.NewResponse(false, nil, fmt.Errorf("missing required fields"))
 	}
 
-	task := backup.BackupTask{
-		Name:       name,
-		SourcePath: sourcePath,
-		TargetPath: targetPath,
-		Schedule:   schedule,
+	// 载荷中的可选字段与任务的 json 字段一一对应
+	var task backup.BackupTask
+	if err := decodePayload(payload, &task); err != nil {
+		return ipc.NewResponse(false, nil, fmt.Errorf("invalid task options: %v", err))
+	}
+
+	// dry_run 为 true 时只返回该任务第一次备份的计划，不添加任务
+	if dryRun, _ := payload["dry_run"].(bool); dryRun {
+		entries, err := s.manager.PreviewTask(task)
+		if err != nil {
+			return ipc.NewResponse(false, nil, err)
+		}
+		return ipc.NewResponse(true, map[string]interface{}{
+			"count":   len(entries),
+			"entries": entries,
+		}, nil)
 	}
 
-	err := s.manager.AddTask(task)
+	// replace 为 true 时更新已存在的同名任务，而不是报错；
+	// force 为 true 时即使其他任务已将同一源目录备份到同一目标也添加
+	replace, _ := payload["replace"].(bool)
+	force, _ := payload["force"].(bool)
+	err := s.manager.AddTask(task, replace, force)
 	if err != nil {
 		log.Printf("Failed to add task: %v", err)
 		return ipc.NewResponse(false, nil, err)
 	}
 
 	log.Printf("Task added successfully")
-	return ipc.NewResponse(true, nil, nil)
+	// 返回添加后的任务，客户端据此显示首次备份的时间；任务随即被删除时只返回成功
+	detail, _ := s.manager.GetTask(task.Name)
+	return ipc.NewResponse(true, detail, nil)
+}
+
+// handleAddBatch adds every task in the payload's "tasks" list, or none of
+// them if any is invalid
+func (s *Server) handleAddBatch(payload map[string]any) *ipc.Response {
+	items, _ := payload["tasks"].([]any)
+	if len(items) == 0 {
+		return ipc.NewResponse(false, nil, fmt.Errorf("no tasks to add"))
+	}
+
+	tasks := make([]backup.BackupTask, 0, len(items))
+	for i, item := range items {
+		fields, _ := item.(map[string]any)
+		name, _ := fields["name"].(string)
+		sourcePath, _ := fields["source_path"].(string)
+		targetPath, _ := fields["target_path"].(string)
+		schedule, _ := fields["schedule"].(string)
+		if name == "" || sourcePath == "" || targetPath == "" || schedule == "" {
+			return ipc.NewResponse(false, nil, fmt.Errorf("task %d: missing required fields", i+1))
+		}
+
+		var task backup.BackupTask
+		if err := decodePayload(fields, &task); err != nil {
+			return ipc.NewResponse(false, nil, fmt.Errorf("task %s: invalid task options: %v", name, err))
+		}
+		tasks = append(tasks, task)
+	}
+
+	log.Printf("Received batch add request for %d tasks", len(tasks))
+	force, _ := payload["force"].(bool)
+	if err := s.manager.AddTasks(tasks, force); err != nil {
+		log.Printf("Failed to add tasks: %v", err)
+		return ipc.NewResponse(false, nil, err)
+	}
+
+	details := make([]*backup.TaskDetail, 0, len(tasks))
+	for _, task := range tasks {
+		if detail, err := s.manager.GetTask(task.Name); err == nil {
+			details = append(details, detail)
+		}
+	}
+	return ipc.NewResponse(true, map[string]interface{}{"count": len(tasks), "tasks": details}, nil)
 }
 
 func (s *Server) handleList() *ipc.Response {
 	tasks := s.manager.ListTasks()
+	saveErr := s.manager.SaveError()
 
 	// 将任务转换为map以便JSON序列化
 	taskMaps := make([]map[string]interface{}, len(tasks))
@@ -146,19 +315,307 @@ func (s *Server) handleList() *ipc.Response {
 			"last_backup": task.LastBackup.Format("2006-01-02 15:04:05"),
 			"error":       task.Error,
 		}
+		if task.Error != "" && !task.LastErrorTime.IsZero() {
+			taskMaps[i]["last_error_time"] = task.LastErrorTime.Format("2006-01-02 15:04:05")
+		}
+		if task.ForceFull {
+			taskMaps[i]["force_full"] = true
+		}
+		if task.ScheduleWarning != "" {
+			taskMaps[i]["schedule_warning"] = task.ScheduleWarning
+		}
+		if task.Direction != "" {
+			taskMaps[i]["direction"] = task.Direction
+		}
+		if task.Priority != 0 {
+			taskMaps[i]["priority"] = task.Priority
+		}
+		if len(task.DependsOn) > 0 {
+			taskMaps[i]["depends_on"] = task.DependsOn
+		}
+		if dep := s.manager.BlockedBy(task.Name); dep != "" {
+			taskMaps[i]["blocked_by"] = dep
+		}
+		if s.manager.RunPaused(task.Name) {
+			taskMaps[i]["run_paused"] = true
+		}
+		if position, waiting := s.manager.QueuePosition(task.Name); position > 0 {
+			taskMaps[i]["queue_position"] = position
+			taskMaps[i]["queue_length"] = waiting
+		}
+		if saveErr != nil {
+			taskMaps[i]["save_error"] = saveErr.Error()
+		}
+		if task.ConsecutiveFailures > 0 {
+			taskMaps[i]["consecutive_failures"] = task.ConsecutiveFailures
+		}
+		if task.RetryAttempt > 0 {
+			taskMaps[i]["retry_attempt"] = task.RetryAttempt
+			taskMaps[i]["retry_interval"] = task.RetryInterval
+		}
+		if task.ScrubInterval != "" {
+			taskMaps[i]["scrub_interval"] = task.ScrubInterval
+		}
+		if !task.LastScrub.IsZero() {
+			taskMaps[i]["last_scrub"] = task.LastScrub.Format("2006-01-02 15:04:05")
+			taskMaps[i]["scrub_corrupt"] = task.ScrubCorrupt
+			taskMaps[i]["scrub_repaired"] = task.ScrubRepaired
+		}
+		if task.UnreadableFiles > 0 {
+			taskMaps[i]["unreadable_files"] = task.UnreadableFiles
+		}
+		if task.DeferredFiles > 0 {
+			taskMaps[i]["deferred_files"] = task.DeferredFiles
+		}
+		if task.CaseConflicts > 0 {
+			taskMaps[i]["case_conflicts"] = task.CaseConflicts
+		}
+		if task.LongPaths > 0 {
+			taskMaps[i]["long_paths"] = task.LongPaths
+		}
+		if task.ExcludedFiles > 0 {
+			taskMaps[i]["excluded_files"] = task.ExcludedFiles
+			taskMaps[i]["excluded_bytes"] = task.ExcludedBytes
+		}
+		if task.TotalBytesTransferred > 0 {
+			taskMaps[i]["total_bytes_transferred"] = task.TotalBytesTransferred
+		}
+		if task.MaxTargetFiles > 0 || task.MaxTargetBytes > 0 {
+			taskMaps[i]["max_target_files"] = task.MaxTargetFiles
+			taskMaps[i]["max_target_bytes"] = task.MaxTargetBytes
+			taskMaps[i]["target_files"] = task.TargetFiles
+			taskMaps[i]["target_bytes"] = task.TargetBytes
+		}
+		if len(task.TargetStates) > 0 {
+			states := make([]map[string]interface{}, len(task.TargetStates))
+			for j, state := range task.TargetStates {
+				states[j] = map[string]interface{}{
+					"path":   state.Path,
+					"status": state.Status,
+				}
+				if !state.LastBackup.IsZero() {
+					states[j]["last_backup"] = state.LastBackup.Format("2006-01-02 15:04:05")
+				}
+			}
+			taskMaps[i]["target_states"] = states
+		}
+		if !task.SnoozeUntil.IsZero() {
+			taskMaps[i]["snooze_until"] = task.SnoozeUntil.Format(time.RFC3339)
+		}
+		if task.BoostSchedule != "" {
+			taskMaps[i]["boost_schedule"] = task.BoostSchedule
+			taskMaps[i]["boost_until"] = task.BoostUntil.Format("2006-01-02 15:04:05")
+		}
+		if task.OriginalTarget != "" {
+			taskMaps[i]["original_target"] = task.OriginalTarget
+			if !task.RedirectUntil.IsZero() {
+				taskMaps[i]["redirect_until"] = task.RedirectUntil.Format(time.RFC3339)
+			}
+		}
 	}
 
 	return ipc.NewResponse(true, taskMaps, nil)
 }
 
+func (s *Server) handleGet(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	if name == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
+	}
+
+	task, err := s.manager.GetTask(name)
+	if err != nil {
+		return ipc.NewResponse(false, nil, err)
+	}
+	return ipc.NewResponse(true, task, nil)
+}
+
+// handleInspect returns a snapshot of a task's running backup: the file
+// being copied and how many of the files to copy have been started
+func (s *Server) handleInspect(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	if name == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
+	}
+
+	status, err := s.manager.TransferStatus(name)
+	if err != nil {
+		return ipc.NewResponse(false, nil, err)
+	}
+	return ipc.NewResponse(true, status, nil)
+}
+
+func (s *Server) handleHistory(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	if name == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
+	}
+
+	var since time.Duration
+	if sinceStr, _ := payload["since"].(string); sinceStr != "" {
+		d, err := time.ParseDuration(sinceStr)
+		if err != nil {
+			return ipc.NewResponse(false, nil, fmt.Errorf("invalid since: %v", err))
+		}
+		since = d
+	}
+	failedOnly, _ := payload["failed_only"].(bool)
+
+	runs, err := s.manager.History(name, since, failedOnly)
+	if err != nil {
+		return ipc.NewResponse(false, nil, err)
+	}
+
+	return ipc.NewResponse(true, map[string]interface{}{
+		"count": len(runs),
+		"runs":  runs,
+	}, nil)
+}
+
+func (s *Server) handleUsage() *ipc.Response {
+	usages := s.manager.Usage()
+
+	var files int
+	var bytes int64
+	for _, usage := range usages {
+		files += usage.Files
+		bytes += usage.Bytes
+	}
+
+	return ipc.NewResponse(true, map[string]interface{}{
+		"tasks": usages,
+		"files": files,
+		"bytes": bytes,
+	}, nil)
+}
+
+// handleWatch streams a progress event for a task every second until its
+// current backup finishes or the client disconnects
+func (s *Server) handleWatch(conn net.Conn, payload map[string]any) {
+	name, _ := payload["name"].(string)
+	if name == "" {
+		sendError(conn, fmt.Errorf("task name is required"))
+		return
+	}
+
+	encoder := json.NewEncoder(conn)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		status, err := s.manager.TransferStatus(name)
+		if err != nil {
+			sendError(conn, err)
+			return
+		}
+		if err := encoder.Encode(ipc.NewResponse(true, status, nil)); err != nil {
+			log.Printf("Failed to send watch event: %v", err)
+			return
+		}
+		if status.Status != backup.StatusRunning {
+			return
+		}
+		<-ticker.C
+	}
+}
+
+// handleSubscribe streams the events of all tasks until the client
+// disconnects. The first response acknowledges the subscription.
+func (s *Server) handleSubscribe(conn net.Conn) {
+	events, unsubscribe := s.manager.Subscribe()
+	defer unsubscribe()
+
+	encoder := json.NewEncoder(conn)
+	if err := encoder.Encode(ipc.NewResponse(true, nil, nil)); err != nil {
+		log.Printf("Failed to acknowledge subscription: %v", err)
+		return
+	}
+
+	// 客户端不再发送数据，读取返回即表示连接已断开
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(gone)
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case event := <-events:
+			if err := encoder.Encode(ipc.NewResponse(true, event, nil)); err != nil {
+				log.Printf("Failed to send event: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// handleTailLog streams the daemon's new log lines at or above the requested
+// level until the client disconnects
+func (s *Server) handleTailLog(conn net.Conn, payload map[string]any) {
+	level, _ := payload["level"].(string)
+	minRank, err := levelRank(level)
+	if err != nil {
+		sendError(conn, err)
+		return
+	}
+
+	lines, unsubscribe := s.logs.subscribe()
+	defer unsubscribe()
+
+	encoder := json.NewEncoder(conn)
+	if err := encoder.Encode(ipc.NewResponse(true, nil, nil)); err != nil {
+		log.Printf("Failed to acknowledge log tail: %v", err)
+		return
+	}
+
+	// 客户端不再发送数据，读取返回即表示连接已断开
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(gone)
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case line := <-lines:
+			lineLevel := logLevel(line)
+			if rank, _ := levelRank(lineLevel); rank < minRank {
+				continue
+			}
+			// 写入失败时不能再输出日志，否则每条日志都会产生一条新的失败日志
+			if err := encoder.Encode(ipc.NewResponse(true, map[string]string{
+				"level": lineLevel,
+				"line":  line,
+			}, nil)); err != nil {
+				return
+			}
+		}
+	}
+}
+
 func (s *Server) handleDelete(payload map[string]any) *ipc.Response {
 	name, _ := payload["name"].(string)
 	if name == "" {
 		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
 	}
 
-	err := s.manager.DeleteTask(name)
-	return ipc.NewResponse(err == nil, nil, err)
+	task, err := s.manager.DeleteTask(name)
+	if err != nil {
+		return ipc.NewResponse(false, nil, err)
+	}
+	// 配置文件无法写入时删除已在内存中生效，save_error 说明它尚未保存
+	deleted := struct {
+		*backup.BackupTask
+		SaveError string `json:"save_error,omitempty"`
+	}{BackupTask: task}
+	if saveErr := s.manager.SaveError(); saveErr != nil {
+		deleted.SaveError = saveErr.Error()
+	}
+	return ipc.NewResponse(true, deleted, nil)
 }
 
 func (s *Server) handleStop(payload map[string]any) *ipc.Response {
@@ -167,10 +624,198 @@ func (s *Server) handleStop(payload map[string]any) *ipc.Response {
 		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
 	}
 
-	err := s.manager.StopTask(name)
+	if err := s.manager.StopTask(name); err != nil {
+		return ipc.NewResponse(false, nil, err)
+	}
+	// 返回停止后的任务，running 表示仍有备份在进行，会在完成后结束
+	detail, _ := s.manager.GetTask(name)
+	return ipc.NewResponse(true, detail, nil)
+}
+
+func (s *Server) handleRescan(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	now, _ := payload["now"].(bool)
+	if name == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
+	}
+
+	err := s.manager.RescanTask(name, now)
+	return ipc.NewResponse(err == nil, nil, err)
+}
+
+func (s *Server) handleFull(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	now, _ := payload["now"].(bool)
+	if name == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
+	}
+
+	err := s.manager.FullBackup(name, now)
+	return ipc.NewResponse(err == nil, nil, err)
+}
+
+func (s *Server) handleScrub(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	if name == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
+	}
+
+	err := s.manager.ScrubTask(name)
+	return ipc.NewResponse(err == nil, nil, err)
+}
+
+func (s *Server) handleSnooze(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	durationStr, _ := payload["duration"].(string)
+	if name == "" || durationStr == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("missing required fields"))
+	}
+
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		return ipc.NewResponse(false, nil, fmt.Errorf("invalid duration: %v", err))
+	}
+
+	err = s.manager.SnoozeTask(name, duration)
+	return ipc.NewResponse(err == nil, nil, err)
+}
+
+func (s *Server) handlePlan(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	if name == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
+	}
+
+	entries, err := s.manager.Plan(name)
+	if err != nil {
+		return ipc.NewResponse(false, nil, err)
+	}
+
+	return ipc.NewResponse(true, map[string]interface{}{
+		"count":   len(entries),
+		"entries": entries,
+	}, nil)
+}
+
+func (s *Server) handleUpcoming(payload map[string]any) *ipc.Response {
+	withinStr, _ := payload["within"].(string)
+	if withinStr == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("missing required fields"))
+	}
+
+	within, err := time.ParseDuration(withinStr)
+	if err != nil || within <= 0 {
+		return ipc.NewResponse(false, nil, fmt.Errorf("invalid duration: %s", withinStr))
+	}
+
+	runs := s.manager.Upcoming(within)
+	return ipc.NewResponse(true, map[string]interface{}{
+		"count": len(runs),
+		"runs":  runs,
+	}, nil)
+}
+
+func (s *Server) handleDebug(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	on, ok := payload["on"].(bool)
+	if name == "" || !ok {
+		return ipc.NewResponse(false, nil, fmt.Errorf("missing required fields"))
+	}
+
+	err := s.manager.SetDebug(name, on)
+	return ipc.NewResponse(err == nil, nil, err)
+}
+
+// handleSetTarget redirects a task to a temporary target, or restores its
+// original target when no path is given
+func (s *Server) handleSetTarget(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	path, _ := payload["path"].(string)
+	if name == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
+	}
+
+	if path == "" {
+		err := s.manager.RevertTarget(name)
+		return ipc.NewResponse(err == nil, nil, err)
+	}
+
+	var revertAfter time.Duration
+	if str, _ := payload["revert_after"].(string); str != "" {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return ipc.NewResponse(false, nil, fmt.Errorf("invalid duration: %v", err))
+		}
+		revertAfter = d
+	}
+
+	err := s.manager.SetTarget(name, path, revertAfter)
 	return ipc.NewResponse(err == nil, nil, err)
 }
 
+// handlePauseRun pauses or, with resume set, resumes a task's running backup
+func (s *Server) handlePauseRun(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	if name == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("task name is required"))
+	}
+
+	if resume, _ := payload["resume"].(bool); resume {
+		err := s.manager.ResumeRun(name)
+		return ipc.NewResponse(err == nil, nil, err)
+	}
+
+	var duration time.Duration
+	if str, _ := payload["duration"].(string); str != "" {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return ipc.NewResponse(false, nil, fmt.Errorf("invalid duration: %v", err))
+		}
+		duration = d
+	}
+
+	err := s.manager.PauseRun(name, duration)
+	return ipc.NewResponse(err == nil, nil, err)
+}
+
+// handleSetGlobal 修改一项全局设置，值为空时恢复为启动参数指定的值
+func (s *Server) handleSetGlobal(payload map[string]any) *ipc.Response {
+	key, _ := payload["key"].(string)
+	value, _ := payload["value"].(string)
+	if key == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("setting name is required"))
+	}
+
+	err := s.manager.SetGlobal(key, value)
+	return ipc.NewResponse(err == nil, nil, err)
+}
+
+func (s *Server) handleBoost(payload map[string]any) *ipc.Response {
+	name, _ := payload["name"].(string)
+	schedule, _ := payload["schedule"].(string)
+	durationStr, _ := payload["duration"].(string)
+	if name == "" || schedule == "" || durationStr == "" {
+		return ipc.NewResponse(false, nil, fmt.Errorf("missing required fields"))
+	}
+
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		return ipc.NewResponse(false, nil, fmt.Errorf("invalid duration: %v", err))
+	}
+
+	err = s.manager.BoostTask(name, schedule, duration)
+	return ipc.NewResponse(err == nil, nil, err)
+}
+
+// decodePayload converts a command payload into v using its json tags
+func decodePayload(payload map[string]any, v any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
 func sendError(conn net.Conn, err error) {
 	resp := ipc.NewResponse(false, nil, err)
 	if data, err := resp.Marshal(); err == nil {
@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// taskTag 匹配日志行中的任务标记，如 "[Task: mybackup]"
+var taskTag = regexp.MustCompile(`\[Task: ([^\]]+)\]`)
+
+// TaskLogs is an io.Writer that copies every log line tagged with a task
+// name into that task's own log file under a directory, rotating each file
+// once it reaches a maximum size. Lines without a task tag are ignored.
+type TaskLogs struct {
+	dir     string
+	maxSize int64
+	keep    int
+
+	mu    sync.Mutex
+	files map[string]*rotatingFile
+}
+
+// NewTaskLogs creates the log directory and returns a writer that keeps
+// each task's log below maxSize bytes plus keep rotated files
+func NewTaskLogs(dir string, maxSize int64, keep int) (*TaskLogs, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid max log size: %d", maxSize)
+	}
+	if keep < 0 {
+		return nil, fmt.Errorf("invalid number of rotated logs to keep: %d", keep)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+	return &TaskLogs{
+		dir:     dir,
+		maxSize: maxSize,
+		keep:    keep,
+		files:   make(map[string]*rotatingFile),
+	}, nil
+}
+
+// Write 将带任务标记的一行日志追加到该任务的日志文件；标准库 log 每次调用 Write 写入一整行
+// 写入失败只输出到标准错误，不能调用 log（会死锁），也不能返回错误（会中断 MultiWriter 中的其他输出）
+func (l *TaskLogs) Write(p []byte) (int, error) {
+	match := taskTag.FindSubmatch(p)
+	if match == nil {
+		return len(p), nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	name := string(match[1])
+	file, exists := l.files[name]
+	if !exists {
+		file = &rotatingFile{path: filepath.Join(l.dir, logFileName(name)), maxSize: l.maxSize, keep: l.keep}
+		l.files[name] = file
+	}
+	if err := file.write(p); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write log of task %s: %v\n", name, err)
+	}
+	return len(p), nil
+}
+
+// Close closes all open task log files
+func (l *TaskLogs) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, file := range l.files {
+		file.close()
+	}
+	l.files = make(map[string]*rotatingFile)
+	return nil
+}
+
+// logFileName 返回任务日志的文件名，任务名中的路径分隔符替换为下划线
+func logFileName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "." || name == ".." {
+		name = "_"
+	}
+	return name + ".log"
+}
+
+// rotatingFile 按大小轮转的日志文件：超过上限时 x.log 重命名为 x.log.1，
+// 已有的 x.log.N 依次重命名为 x.log.N+1，超出保留个数的删除
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	keep    int
+	file    *os.File
+	size    int64
+}
+
+// write 追加一行日志，写入后超过上限时先轮转
+func (f *rotatingFile) write(p []byte) error {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return err
+}
+
+// open 以追加方式打开日志文件，并记录其已有的大小
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate 关闭当前文件，依次重命名已轮转的文件，然后打开新的空文件
+func (f *rotatingFile) rotate() error {
+	f.close()
+	if f.keep == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		if err := os.Remove(fmt.Sprintf("%s.%d", f.path, f.keep)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for i := f.keep - 1; i >= 1; i-- {
+			if err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return f.open()
+}
+
+// close 关闭当前打开的日志文件
+func (f *rotatingFile) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
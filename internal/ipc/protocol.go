@@ -9,10 +9,30 @@ import (
 type CommandType string
 
 const (
-	CmdAdd    CommandType = "ADD"
-	CmdList   CommandType = "LIST"
-	CmdDelete CommandType = "DELETE"
-	CmdStop   CommandType = "STOP"
+	CmdAdd       CommandType = "ADD"
+	CmdAddBatch  CommandType = "ADD_BATCH"
+	CmdList      CommandType = "LIST"
+	CmdDelete    CommandType = "DELETE"
+	CmdStop      CommandType = "STOP"
+	CmdBoost     CommandType = "BOOST"
+	CmdGet       CommandType = "GET"
+	CmdHistory   CommandType = "HISTORY"
+	CmdWatch     CommandType = "WATCH"
+	CmdInspect   CommandType = "INSPECT"
+	CmdRescan    CommandType = "RESCAN"
+	CmdSnooze    CommandType = "SNOOZE"
+	CmdUsage     CommandType = "USAGE"
+	CmdSubscribe CommandType = "SUBSCRIBE"
+	CmdDebug     CommandType = "DEBUG"
+	CmdPlan      CommandType = "PLAN"
+	CmdFull      CommandType = "FULL"
+	CmdScrub     CommandType = "SCRUB"
+	CmdUpcoming  CommandType = "UPCOMING"
+	CmdSetTarget CommandType = "SET_TARGET"
+	CmdPauseRun  CommandType = "PAUSE_RUN"
+	CmdSetGlobal CommandType = "SET_GLOBAL"
+	CmdGetGlobal CommandType = "GET_GLOBAL"
+	CmdTailLog   CommandType = "TAIL"
 )
 
 // Command represents a command sent from CLI to daemon